@@ -1,11 +1,25 @@
 package main
 
 import (
+	"context"
 	"net"
+	"net/http"
+	"os"
 
+	"github.com/PharmaKart/order-svc/internal/address"
+	"github.com/PharmaKart/order-svc/internal/auth"
 	"github.com/PharmaKart/order-svc/internal/handlers"
+	"github.com/PharmaKart/order-svc/internal/inventory"
+	"github.com/PharmaKart/order-svc/internal/jobs"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
 	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/rbac"
 	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/services"
+	"github.com/PharmaKart/order-svc/internal/shipping"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/internal/tax"
 	"github.com/PharmaKart/order-svc/pkg/config"
 	"github.com/PharmaKart/order-svc/pkg/utils"
 	"google.golang.org/grpc"
@@ -28,8 +42,18 @@ func main() {
 	}
 
 	// Initialize repositories
-	orderRepo := repositories.NewOrderRepository(db)
+	orderStateMachine := statemachine.NewOrderStateMachine()
+	outbox.RegisterStateHooks(orderStateMachine)
+	orderStateMachine.OnEnter(models.OrderStatusApproved, repositories.RequireApprovedPrescription)
+	orderStateMachine.OnEnter(models.OrderStatusShipped, repositories.RequireApprovedPrescription)
+	orderStateMachine.OnEnter(models.OrderStatusPaid, repositories.CommitStockReservations)
+	orderStateMachine.OnEnter(models.OrderStatusCancelled, repositories.ReleaseStockReservations)
+	orderStateMachine.OnEnter(models.OrderStatusFailed, repositories.ReleaseStockReservations)
+	orderRepo := repositories.NewOrderRepository(db, orderStateMachine)
 	orderItemRepo := repositories.NewOrderItemRepository(db)
+	unitOfWork := repositories.NewUnitOfWork(db, orderStateMachine)
+	idempotencyKeyRepo := repositories.NewIdempotencyKeyRepository(db)
+	taxRateRepo := repositories.NewTaxRateRepository(db)
 
 	// Initialize product client
 	productConn, err := grpc.NewClient(cfg.ProductServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -41,6 +65,7 @@ func main() {
 
 	productClient := proto.NewProductServiceClient(productConn)
 	defer productConn.Close()
+	stockService := inventory.NewProductStockService(productClient)
 
 	// Initialize payment client
 	paymentConn, err := grpc.NewClient(cfg.PaymentServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -53,8 +78,78 @@ func main() {
 	paymentClient := proto.NewPaymentServiceClient(paymentConn)
 	defer paymentConn.Close()
 
+	// Load shipping rules
+	shippingRules, err := shipping.LoadRules(cfg.ShippingRulesPath)
+	if err != nil {
+		utils.Logger.Fatal("Failed to load shipping rules", map[string]interface{}{
+			"error": err,
+		})
+	}
+	shippingCalculator := shipping.NewRulesCalculator(shippingRules)
+	taxCalculator := tax.NewTableCalculator(taxRateRepo)
+
+	// Load access policy
+	accessPolicy, err := rbac.LoadPolicy(cfg.AccessPolicyPath)
+	if err != nil {
+		utils.Logger.Fatal("Failed to load access policy", map[string]interface{}{
+			"error": err,
+		})
+	}
+
+	// Initialize services
+	orderService := services.NewOrderService(orderRepo, orderItemRepo, unitOfWork, idempotencyKeyRepo, &productClient, &paymentClient, stockService, inventory.NewReserver(stockService, cfg.StockReservationTTL), accessPolicy, shippingCalculator, taxCalculator, address.NewValidator(), cfg.IdempotencyKeyTTL, cfg.PaymentPartialRefunds)
+
 	// Initialize handlers
-	orderHandler := handlers.NewOrderHandler(orderRepo, orderItemRepo, &productClient, &paymentClient)
+	orderHandler := handlers.NewOrderHandler(orderService)
+
+	// Start order event relay
+	var eventSink outbox.Sink
+	switch cfg.OutboxSink {
+	case "file":
+		eventFile, err := os.OpenFile(cfg.OutboxFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			utils.Logger.Fatal("Failed to open order event file", map[string]interface{}{
+				"error": err,
+			})
+		}
+		defer eventFile.Close()
+		eventSink = outbox.NewWriterSink(eventFile)
+	default:
+		eventSink = outbox.NewWriterSink(os.Stdout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := outbox.NewRelay(unitOfWork, eventSink, cfg.OutboxRelayInterval, cfg.OutboxBatchSize, cfg.OutboxMaxAttempts)
+	go relay.Run(ctx)
+
+	// Start stock reservation reconciliation
+	reconciler := inventory.NewReconciler(unitOfWork, stockService, cfg.ReservationSyncInterval, cfg.ReservationSyncBatchSize)
+	go reconciler.Run(ctx)
+
+	// Start unpaid order expiry
+	paymentExpiry := jobs.NewPaymentExpiryJob(orderService, cfg.PaymentExpiryInterval, cfg.PaymentTimeout, cfg.PaymentExpiryBatchSize)
+	go paymentExpiry.Run(ctx)
+
+	// Expose job metrics at /debug/vars
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddr, nil); err != nil {
+				utils.Error("Metrics server stopped", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
+
+	// Initialize caller authentication
+	tokenVerifier, err := auth.NewVerifier(cfg.AuthJWTAlgorithm, cfg.AuthJWTSecret, cfg.AuthJWTPublicKeyPath, cfg.AuthJWTIssuer, cfg.AuthJWTAudience)
+	if err != nil {
+		utils.Logger.Fatal("Failed to configure token verification", map[string]interface{}{
+			"error": err,
+		})
+	}
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", ":"+cfg.Port)
@@ -65,7 +160,10 @@ func main() {
 		})
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		auth.UnaryServerInterceptor(tokenVerifier),
+		rbac.UnaryServerInterceptor(accessPolicy),
+	))
 	proto.RegisterOrderServiceServer(grpcServer, orderHandler)
 
 	utils.Info("Starting order service", map[string]interface{}{
@@ -0,0 +1,108 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+)
+
+// Validator checks a shipping address and returns the failing fields keyed
+// by field name, e.g. "postal_code". An empty map means the address is valid.
+type Validator interface {
+	Validate(address models.Address) map[string]string
+}
+
+var (
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	phonePattern   = regexp.MustCompile(`^\+?[0-9 ().-]{7,20}$`)
+
+	postalCodePatterns = map[string]*regexp.Regexp{
+		"CA": regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] ?\d[ABCEGHJ-NPRSTV-Z]\d$`),
+		"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	}
+
+	regions = map[string]map[string]bool{
+		"CA": set("AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"),
+		"US": set("AL", "AK", "AZ", "AR", "CA", "CO", "CT", "DE", "DC", "FL", "GA", "HI", "ID", "IL", "IN", "IA", "KS", "KY", "LA",
+			"ME", "MD", "MA", "MI", "MN", "MS", "MO", "MT", "NE", "NV", "NH", "NJ", "NM", "NY", "NC", "ND", "OH", "OK", "OR", "PA",
+			"RI", "SC", "SD", "TN", "TX", "UT", "VT", "VA", "WA", "WV", "WI", "WY", "AS", "GU", "MP", "PR", "VI"),
+	}
+)
+
+type defaultValidator struct{}
+
+// NewValidator returns a validator with required-field checks and postal
+// code and region rules for the countries we know; other countries only get
+// the generic checks.
+func NewValidator() Validator {
+	return &defaultValidator{}
+}
+
+func (v *defaultValidator) Validate(address models.Address) map[string]string {
+	fields := map[string]string{}
+
+	required := map[string]string{
+		"recipient":   address.Recipient,
+		"line1":       address.Line1,
+		"city":        address.City,
+		"postal_code": address.PostalCode,
+		"country":     address.Country,
+		"phone":       address.Phone,
+	}
+	for field, value := range required {
+		if strings.TrimSpace(value) == "" {
+			fields[field] = "This field is required"
+		}
+	}
+
+	if address.Country != "" && !countryPattern.MatchString(address.Country) {
+		fields["country"] = "Country must be a two-letter ISO 3166 code"
+	}
+
+	if pattern, ok := postalCodePatterns[address.Country]; ok && address.PostalCode != "" && !pattern.MatchString(address.PostalCode) {
+		fields["postal_code"] = "Invalid postal code for " + address.Country
+	}
+
+	if known, ok := regions[address.Country]; ok {
+		if address.Region == "" {
+			fields["region"] = "This field is required"
+		} else if !known[address.Region] {
+			fields["region"] = "Invalid region for " + address.Country
+		}
+	}
+
+	if address.Phone != "" && !phonePattern.MatchString(address.Phone) {
+		fields["phone"] = "Invalid phone number"
+	}
+
+	return fields
+}
+
+// Normalize trims the address and upper-cases its codes so it is stored and
+// compared in one form.
+func Normalize(address models.Address) models.Address {
+	address.Recipient = strings.TrimSpace(address.Recipient)
+	address.Line1 = strings.TrimSpace(address.Line1)
+	if address.Line2 != nil {
+		line2 := strings.TrimSpace(*address.Line2)
+		address.Line2 = &line2
+		if line2 == "" {
+			address.Line2 = nil
+		}
+	}
+	address.City = strings.TrimSpace(address.City)
+	address.Region = strings.ToUpper(strings.TrimSpace(address.Region))
+	address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+	address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+	address.Phone = strings.TrimSpace(address.Phone)
+	return address
+}
+
+func set(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
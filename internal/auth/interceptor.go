@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor authenticates every call from the bearer token in
+// its "authorization" metadata and stores the principal in the context.
+// Calls without a valid token are rejected with codes.Unauthenticated before
+// they reach a handler.
+func UnaryServerInterceptor(verifier Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token, ok := bearerToken(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+
+		principal, err := verifier.Verify(token)
+		if err != nil {
+			utils.Warn("Rejected request with invalid token", map[string]interface{}{
+				"method": info.FullMethod,
+				"error":  err.Error(),
+			})
+			return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+		}
+
+		return handler(NewContext(ctx, principal), req)
+	}
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, value := range md.Get("authorization") {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "bearer") && token != "" {
+			return strings.TrimSpace(token), true
+		}
+	}
+
+	return "", false
+}
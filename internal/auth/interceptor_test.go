@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// stubVerifier accepts only the token "good" and records what it was given.
+type stubVerifier struct {
+	tokens []string
+}
+
+func (v *stubVerifier) Verify(token string) (*Principal, error) {
+	v.tokens = append(v.tokens, token)
+	if token != "good" {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+	return &Principal{Subject: "user-1", Roles: []string{RoleCustomer}}, nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		wantToken   string
+		wantMessage string
+	}{
+		{
+			name:      "bearer token",
+			ctx:       metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer good")),
+			wantToken: "good",
+		},
+		{
+			name:      "lowercase scheme",
+			ctx:       metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "bearer good")),
+			wantToken: "good",
+		},
+		{
+			name: "bearer token after another scheme",
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"authorization", "Basic dXNlcjpwYXNz",
+				"authorization", "Bearer good",
+			)),
+			wantToken: "good",
+		},
+		{
+			name:        "no metadata",
+			ctx:         context.Background(),
+			wantMessage: "missing bearer token",
+		},
+		{
+			name:        "no authorization header",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "abc")),
+			wantMessage: "missing bearer token",
+		},
+		{
+			name:        "basic scheme",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic dXNlcjpwYXNz")),
+			wantMessage: "missing bearer token",
+		},
+		{
+			name:        "token without scheme",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "good")),
+			wantMessage: "missing bearer token",
+		},
+		{
+			name:        "empty bearer token",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer ")),
+			wantMessage: "missing bearer token",
+		},
+		{
+			name:        "invalid token",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer forged")),
+			wantToken:   "forged",
+			wantMessage: "invalid bearer token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &stubVerifier{}
+			interceptor := UnaryServerInterceptor(verifier)
+			info := &grpc.UnaryServerInfo{FullMethod: "/order.OrderService/GetOrder"}
+
+			var called bool
+			var principal *Principal
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				principal = FromContext(ctx)
+				return "response", nil
+			}
+
+			resp, err := interceptor(tt.ctx, "request", info, handler)
+
+			if tt.wantToken == "" && len(verifier.tokens) != 0 {
+				t.Errorf("verifier called with %v, want no call", verifier.tokens)
+			}
+			if tt.wantToken != "" && (len(verifier.tokens) != 1 || verifier.tokens[0] != tt.wantToken) {
+				t.Errorf("verifier called with %v, want [%s]", verifier.tokens, tt.wantToken)
+			}
+
+			if tt.wantMessage != "" {
+				if status.Code(err) != codes.Unauthenticated {
+					t.Fatalf("error code = %v, want %v (err: %v)", status.Code(err), codes.Unauthenticated, err)
+				}
+				if got := status.Convert(err).Message(); got != tt.wantMessage {
+					t.Errorf("error message = %q, want %q", got, tt.wantMessage)
+				}
+				if called {
+					t.Error("handler called for an unauthenticated request")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("interceptor error = %v", err)
+			}
+			if resp != "response" {
+				t.Errorf("response = %v, want the handler's response", resp)
+			}
+			if principal == nil || principal.Subject != "user-1" {
+				t.Errorf("principal in handler context = %+v, want subject user-1", principal)
+			}
+		})
+	}
+}
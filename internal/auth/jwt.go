@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signing algorithms accepted for tokens.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// clockSkew is the leeway allowed when checking the exp and nbf claims.
+const clockSkew = 30 * time.Second
+
+// Verifier checks a bearer token and returns the principal it was issued to.
+type Verifier interface {
+	Verify(token string) (*Principal, error)
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Roles     []string `json:"roles"`
+	Service   string   `json:"service"`
+}
+
+// audience is the "aud" claim, which may be a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid aud claim")
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtVerifier struct {
+	algorithm string
+	verify    func(signingInput, signature []byte) error
+	issuer    string
+	audience  string
+	now       func() time.Time
+}
+
+// NewHMACVerifier returns a verifier for HS256 tokens signed with secret. An
+// empty issuer or audience is not checked.
+func NewHMACVerifier(secret []byte, issuer, audience string) Verifier {
+	return &jwtVerifier{
+		algorithm: AlgorithmHS256,
+		verify: func(signingInput, signature []byte) error {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(signingInput)
+			if !hmac.Equal(mac.Sum(nil), signature) {
+				return fmt.Errorf("invalid token signature")
+			}
+			return nil
+		},
+		issuer:   issuer,
+		audience: audience,
+		now:      time.Now,
+	}
+}
+
+// NewRSAVerifier returns a verifier for RS256 tokens signed with the private
+// half of key. An empty issuer or audience is not checked.
+func NewRSAVerifier(key *rsa.PublicKey, issuer, audience string) Verifier {
+	return &jwtVerifier{
+		algorithm: AlgorithmRS256,
+		verify: func(signingInput, signature []byte) error {
+			digest := sha256.Sum256(signingInput)
+			if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+				return fmt.Errorf("invalid token signature")
+			}
+			return nil
+		},
+		issuer:   issuer,
+		audience: audience,
+		now:      time.Now,
+	}
+}
+
+// NewVerifier returns the verifier for the configured algorithm: HS256 with
+// secret or RS256 with the public key stored at publicKeyPath.
+func NewVerifier(algorithm, secret, publicKeyPath, issuer, audience string) (Verifier, error) {
+	switch algorithm {
+	case AlgorithmHS256:
+		if secret == "" {
+			return nil, fmt.Errorf("an HMAC secret is required for %s tokens", AlgorithmHS256)
+		}
+		return NewHMACVerifier([]byte(secret), issuer, audience), nil
+	case AlgorithmRS256:
+		if publicKeyPath == "" {
+			return nil, fmt.Errorf("a public key is required for %s tokens", AlgorithmRS256)
+		}
+		key, err := LoadRSAPublicKey(publicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAVerifier(key, issuer, audience), nil
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm '%s'", algorithm)
+	}
+}
+
+// LoadRSAPublicKey reads a PEM encoded RSA public key, either PKIX
+// ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse public key: no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	default:
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is not an RSA key")
+		}
+		return key, nil
+	}
+}
+
+// Verify checks the token's signature and its exp, nbf, iss and aud claims.
+// Only the algorithm the verifier was built for is accepted, whatever the
+// token header says.
+func (v *jwtVerifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Algorithm != v.algorithm {
+		return nil, fmt.Errorf("unexpected signing algorithm '%s'", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	if err := v.verify([]byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if now.After(unixTime(*claims.ExpiresAt).Add(clockSkew)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(unixTime(*claims.NotBefore)) {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("unexpected token issuer '%s'", claims.Issuer)
+	}
+	if v.audience != "" && !claims.Audience.contains(v.audience) {
+		return nil, fmt.Errorf("token not issued for this audience")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Roles:   claims.Roles,
+		Service: claims.Service,
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
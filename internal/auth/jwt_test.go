@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "auth-svc"
+	testAudience = "order-svc"
+)
+
+var (
+	testSecret = []byte("test-secret")
+	testNow    = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode token segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func hmacSign(secret []byte, signingInput string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hmacToken returns an HS256 token for claims signed with secret, with alg in
+// its header.
+func hmacToken(t *testing.T, alg string, secret []byte, claims map[string]interface{}) string {
+	t.Helper()
+	signingInput := encodeSegment(t, map[string]string{"alg": alg, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	return signingInput + "." + hmacSign(secret, signingInput)
+}
+
+// validClaims returns claims that pass every check at testNow; overrides are
+// applied on top, and a nil override removes the claim.
+func validClaims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":   "user-1",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"nbf":   testNow.Add(-time.Minute).Unix(),
+		"roles": []string{RoleCustomer},
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func fixedClock(v Verifier) Verifier {
+	v.(*jwtVerifier).now = func() time.Time { return testNow }
+	return v
+}
+
+func TestHMACVerifierVerify(t *testing.T) {
+	validToken := hmacToken(t, AlgorithmHS256, testSecret, validClaims(nil))
+	validParts := strings.Split(validToken, ".")
+
+	tests := []struct {
+		name        string
+		token       string
+		wantErr     string
+		wantSubject string
+	}{
+		{
+			name:        "valid token",
+			token:       validToken,
+			wantSubject: "user-1",
+		},
+		{
+			name:        "audience list containing this service",
+			token:       hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"aud": []string{"other-svc", testAudience}})),
+			wantSubject: "user-1",
+		},
+		{
+			name:        "expired within clock skew",
+			token:       hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"exp": testNow.Add(-10 * time.Second).Unix()})),
+			wantSubject: "user-1",
+		},
+		{
+			name:        "not before within clock skew",
+			token:       hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"nbf": testNow.Add(10 * time.Second).Unix()})),
+			wantSubject: "user-1",
+		},
+		{
+			name:    "algorithm mismatch",
+			token:   hmacToken(t, AlgorithmRS256, testSecret, validClaims(nil)),
+			wantErr: "unexpected signing algorithm 'RS256'",
+		},
+		{
+			name:    "alg none without signature",
+			token:   encodeSegment(t, map[string]string{"alg": "none"}) + "." + validParts[1] + ".",
+			wantErr: "unexpected signing algorithm 'none'",
+		},
+		{
+			name:    "signed with another secret",
+			token:   hmacToken(t, AlgorithmHS256, []byte("other-secret"), validClaims(nil)),
+			wantErr: "invalid token signature",
+		},
+		{
+			name:    "claims changed after signing",
+			token:   validParts[0] + "." + encodeSegment(t, validClaims(map[string]interface{}{"roles": []string{RoleAdmin}})) + "." + validParts[2],
+			wantErr: "invalid token signature",
+		},
+		{
+			name:    "empty signature",
+			token:   validParts[0] + "." + validParts[1] + ".",
+			wantErr: "invalid token signature",
+		},
+		{
+			name:    "missing expiry",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"exp": nil})),
+			wantErr: "token has no expiry",
+		},
+		{
+			name:    "expired beyond clock skew",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()})),
+			wantErr: "token expired",
+		},
+		{
+			name:    "not before in the future",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()})),
+			wantErr: "token not valid yet",
+		},
+		{
+			name:    "wrong issuer",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"iss": "evil-svc"})),
+			wantErr: "unexpected token issuer 'evil-svc'",
+		},
+		{
+			name:    "missing issuer",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"iss": nil})),
+			wantErr: "unexpected token issuer ''",
+		},
+		{
+			name:    "wrong audience",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"aud": "payment-svc"})),
+			wantErr: "token not issued for this audience",
+		},
+		{
+			name:    "audience list without this service",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"aud": []string{"payment-svc"}})),
+			wantErr: "token not issued for this audience",
+		},
+		{
+			name:    "missing subject",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"sub": nil})),
+			wantErr: "token has no subject",
+		},
+		{
+			name:    "empty token",
+			token:   "",
+			wantErr: "malformed token",
+		},
+		{
+			name:    "two segments",
+			token:   validParts[0] + "." + validParts[1],
+			wantErr: "malformed token",
+		},
+		{
+			name:    "four segments",
+			token:   validToken + ".extra",
+			wantErr: "malformed token",
+		},
+		{
+			name:    "header not base64",
+			token:   "!!!." + validParts[1] + "." + validParts[2],
+			wantErr: "malformed token header",
+		},
+		{
+			name:    "header not JSON",
+			token:   base64.RawURLEncoding.EncodeToString([]byte("not-json")) + "." + validParts[1] + "." + validParts[2],
+			wantErr: "malformed token header",
+		},
+		{
+			name:    "signature not base64",
+			token:   validParts[0] + "." + validParts[1] + ".!!!",
+			wantErr: "malformed token signature",
+		},
+		{
+			name: "claims not base64",
+			token: func() string {
+				signingInput := validParts[0] + ".!!!"
+				return signingInput + "." + hmacSign(testSecret, signingInput)
+			}(),
+			wantErr: "malformed token claims",
+		},
+		{
+			name: "claims not JSON",
+			token: func() string {
+				signingInput := validParts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("not-json"))
+				return signingInput + "." + hmacSign(testSecret, signingInput)
+			}(),
+			wantErr: "malformed token claims",
+		},
+		{
+			name:    "audience of the wrong type",
+			token:   hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"aud": 42})),
+			wantErr: "malformed token claims",
+		},
+	}
+
+	verifier := fixedClock(NewHMACVerifier(testSecret, testIssuer, testAudience))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(tt.token)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Verify() accepted token, want error containing %q", tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %q, want it to contain %q", err, tt.wantErr)
+				}
+				if principal != nil {
+					t.Errorf("Verify() returned principal %+v with error", principal)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if principal.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", principal.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestHMACVerifierPrincipal(t *testing.T) {
+	verifier := fixedClock(NewHMACVerifier(testSecret, testIssuer, testAudience))
+	token := hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{
+		"sub":     "payment-1",
+		"roles":   []string{RoleSupport, RoleWarehouse},
+		"service": ServicePayment,
+	}))
+
+	principal, err := verifier.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if principal.Subject != "payment-1" || principal.Service != ServicePayment {
+		t.Errorf("principal = %+v, want subject payment-1 and service %s", principal, ServicePayment)
+	}
+	if len(principal.Roles) != 2 || principal.Roles[0] != RoleSupport || principal.Roles[1] != RoleWarehouse {
+		t.Errorf("Roles = %v, want [%s %s]", principal.Roles, RoleSupport, RoleWarehouse)
+	}
+}
+
+func TestHMACVerifierUncheckedIssuerAndAudience(t *testing.T) {
+	verifier := fixedClock(NewHMACVerifier(testSecret, "", ""))
+	token := hmacToken(t, AlgorithmHS256, testSecret, validClaims(map[string]interface{}{"iss": nil, "aud": nil}))
+
+	if _, err := verifier.Verify(token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+}
+
+func TestRSAVerifierVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	rsaToken := func(alg string, signer *rsa.PrivateKey) string {
+		signingInput := encodeSegment(t, map[string]string{"alg": alg}) + "." + encodeSegment(t, validClaims(nil))
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	// A token HMAC signed with the public key, as a verifier that trusted the
+	// header's alg would accept.
+	publicKeyBytes := key.PublicKey.N.Bytes()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{
+			name:  "valid token",
+			token: rsaToken(AlgorithmRS256, key),
+		},
+		{
+			name:    "signed with another key",
+			token:   rsaToken(AlgorithmRS256, otherKey),
+			wantErr: "invalid token signature",
+		},
+		{
+			name:    "HS256 signed with the public key",
+			token:   hmacToken(t, AlgorithmHS256, publicKeyBytes, validClaims(nil)),
+			wantErr: "unexpected signing algorithm 'HS256'",
+		},
+		{
+			name:    "alg none without signature",
+			token:   encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, validClaims(nil)) + ".",
+			wantErr: "unexpected signing algorithm 'none'",
+		},
+	}
+
+	verifier := fixedClock(NewRSAVerifier(&key.PublicKey, testIssuer, testAudience))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(tt.token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if principal.Subject != "user-1" {
+				t.Errorf("Subject = %q, want user-1", principal.Subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import "context"
+
+// Roles carried in the "roles" claim of user tokens.
+const (
+	RoleCustomer   = "customer"
+	RolePharmacist = "pharmacist"
+	RoleSupport    = "support"
+	RoleWarehouse  = "warehouse"
+	RoleAdmin      = "admin"
+)
+
+// Services that call this one, identified by the "service" claim of their
+// tokens.
+const (
+	ServicePayment = "payment_service"
+)
+
+// Principal is the verified caller of a request. A user has a subject and
+// roles; another service additionally carries its service identity.
+//
+// All methods are safe to call on a nil Principal, which has no rights.
+type Principal struct {
+	Subject string
+	Roles   []string
+	Service string
+}
+
+// IsCustomer reports whether the caller is the customer with the given ID.
+func (p *Principal) IsCustomer(customerID string) bool {
+	return p != nil && p.Service == "" && p.Subject != "" && p.Subject == customerID
+}
+
+// ID identifies the caller in audit records: the service identity for
+// services and the subject for users.
+func (p *Principal) ID() string {
+	if p == nil {
+		return ""
+	}
+	if p.Service != "" {
+		return p.Service
+	}
+	return p.Subject
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, or nil when the request
+// was not authenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
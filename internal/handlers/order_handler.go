@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/PharmaKart/order-svc/internal/auth"
 	"github.com/PharmaKart/order-svc/internal/models"
 	"github.com/PharmaKart/order-svc/internal/proto"
-	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/query"
 	"github.com/PharmaKart/order-svc/internal/services"
 	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
 	"github.com/PharmaKart/order-svc/pkg/utils"
 	"github.com/google/uuid"
 )
@@ -19,6 +23,19 @@ type OrderHandler interface {
 	ListAllOrders(ctx context.Context, req *proto.ListAllOrdersRequest) (*proto.ListAllOrdersResponse, error)
 	UpdateOrderStatus(ctx context.Context, req *proto.UpdateOrderStatusRequest) (*proto.UpdateOrderStatusResponse, error)
 	GenerateNewPaymentUrl(ctx context.Context, req *proto.GenerateNewPaymentUrlRequest) (*proto.GenerateNewPaymentUrlResponse, error)
+	ReviewPrescription(ctx context.Context, req *proto.ReviewPrescriptionRequest) (*proto.ReviewPrescriptionResponse, error)
+	ListPendingPrescriptions(ctx context.Context, req *proto.ListPendingPrescriptionsRequest) (*proto.ListPendingPrescriptionsResponse, error)
+	QuoteShipping(ctx context.Context, req *proto.QuoteShippingRequest) (*proto.QuoteShippingResponse, error)
+	UpdateShippingAddress(ctx context.Context, req *proto.UpdateShippingAddressRequest) (*proto.UpdateShippingAddressResponse, error)
+	CreateShipment(ctx context.Context, req *proto.CreateShipmentRequest) (*proto.CreateShipmentResponse, error)
+	RecordDeliveryEvent(ctx context.Context, req *proto.RecordDeliveryEventRequest) (*proto.RecordDeliveryEventResponse, error)
+	RequestReturn(ctx context.Context, req *proto.RequestReturnRequest) (*proto.RequestReturnResponse, error)
+	ApproveReturn(ctx context.Context, req *proto.ApproveReturnRequest) (*proto.ApproveReturnResponse, error)
+	ListRefunds(ctx context.Context, req *proto.ListRefundsRequest) (*proto.ListRefundsResponse, error)
+	RetryRefund(ctx context.Context, req *proto.RetryRefundRequest) (*proto.RetryRefundResponse, error)
+	CancelOrderItems(ctx context.Context, req *proto.CancelOrderItemsRequest) (*proto.CancelOrderItemsResponse, error)
+	AmendOrder(ctx context.Context, req *proto.AmendOrderRequest) (*proto.AmendOrderResponse, error)
+	GetOrderHistory(ctx context.Context, req *proto.GetOrderHistoryRequest) (*proto.GetOrderHistoryResponse, error)
 }
 
 type orderHandler struct {
@@ -26,14 +43,14 @@ type orderHandler struct {
 	orderService services.OrderService
 }
 
-func NewOrderHandler(orderRepo repositories.OrderRepository, orderItemRepo repositories.OrderItemRepository, productClient *proto.ProductServiceClient, paymentClient *proto.PaymentServiceClient) *orderHandler {
+func NewOrderHandler(orderService services.OrderService) *orderHandler {
 	return &orderHandler{
-		orderService: services.NewOrderService(orderRepo, orderItemRepo, productClient, paymentClient),
+		orderService: orderService,
 	}
 }
 
 func (h *orderHandler) PlaceOrder(ctx context.Context, req *proto.PlaceOrderRequest) (*proto.PlaceOrderResponse, error) {
-	customerId, err := uuid.Parse(req.CustomerId)
+	customerId, err := customerIDFrom(auth.FromContext(ctx))
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.PlaceOrderResponse{
@@ -56,8 +73,10 @@ func (h *orderHandler) PlaceOrder(ctx context.Context, req *proto.PlaceOrderRequ
 	}
 	order := &models.Order{
 		CustomerID:      customerId,
-		Status:          "payment_pending",
+		Status:          models.OrderStatusPaymentPending,
 		PrescriptionURL: req.PrescriptionUrl,
+		ShippingMethod:  req.GetShippingMethod(),
+		ShippingAddress: toModelAddress(req.ShippingAddress),
 	}
 	orderItems := make([]models.OrderItem, len(req.Items))
 
@@ -84,13 +103,14 @@ func (h *orderHandler) PlaceOrder(ctx context.Context, req *proto.PlaceOrderRequ
 			}, nil
 		}
 		orderItems[i] = models.OrderItem{
-			ProductID:   productId,
-			ProductName: item.ProductName,
-			Quantity:    int(item.Quantity),
+			ProductID:    productId,
+			ProductName:  item.ProductName,
+			Quantity:     int(item.Quantity),
+			Prescription: toModelPrescription(item.Prescription),
 		}
 	}
 
-	orderId, paymentUrl, err := h.orderService.CreateOrder(*order, orderItems)
+	orderId, paymentUrl, err := h.orderService.CreateOrder(*order, orderItems, req.GetIdempotencyKey())
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.PlaceOrderResponse{
@@ -120,10 +140,7 @@ func (h *orderHandler) PlaceOrder(ctx context.Context, req *proto.PlaceOrderRequ
 }
 
 func (h *orderHandler) GenerateNewPaymentUrl(ctx context.Context, req *proto.GenerateNewPaymentUrlRequest) (*proto.GenerateNewPaymentUrlResponse, error) {
-	orderId := req.OrderId
-	customerId := req.CustomerId
-
-	paymentUrl, err := h.orderService.GenerateNewPaymentUrl(orderId, customerId)
+	paymentUrl, err := h.orderService.GenerateNewPaymentUrl(req.OrderId, auth.FromContext(ctx))
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.GenerateNewPaymentUrlResponse{
@@ -152,7 +169,7 @@ func (h *orderHandler) GenerateNewPaymentUrl(ctx context.Context, req *proto.Gen
 }
 
 func (h *orderHandler) GetOrder(ctx context.Context, req *proto.GetOrderRequest) (*proto.GetOrderResponse, error) {
-	order, orderItems, err := h.orderService.GetOrderByID(req.OrderId)
+	order, orderItems, err := h.orderService.GetOrderByID(req.OrderId, auth.FromContext(ctx))
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.GetOrderResponse{
@@ -174,52 +191,53 @@ func (h *orderHandler) GetOrder(ctx context.Context, req *proto.GetOrderRequest)
 		}, nil
 	}
 
-	customerId := req.CustomerId
-
-	if customerId != "admin" && order.CustomerID.String() != customerId {
-		return &proto.GetOrderResponse{
-			Success: false,
-			Error: &proto.Error{
-				Type:    string(errors.AuthError),
-				Message: "You are not authorized to view this order",
-			},
-		}, nil
-	}
-
 	protoOrderItems := make([]*proto.OrderItem, len(*orderItems))
 	for i, item := range *orderItems {
-		protoOrderItems[i] = &proto.OrderItem{
-			ProductId:   item.ProductID.String(),
-			ProductName: item.ProductName,
-			Quantity:    int32(item.Quantity),
-			Price:       item.Price,
-		}
+		protoOrderItems[i] = toProtoOrderItem(item, order.Currency)
 	}
 
 	return &proto.GetOrderResponse{
-		Success:         true,
-		OrderId:         order.ID.String(),
-		CustomerId:      order.CustomerID.String(),
-		Status:          order.Status,
-		PrescriptionUrl: order.PrescriptionURL,
-		ShippingCost:    order.ShippingCost,
-		Subtotal:        order.Subtotal,
-		Items:           protoOrderItems,
-		CreatedAt:       order.CreatedAt.UnixMilli(),
-		UpdatedAt:       order.UpdatedAt.UnixMilli(),
+		Success:              true,
+		OrderId:              order.ID.String(),
+		CustomerId:           order.CustomerID.String(),
+		Status:               order.Status,
+		PrescriptionUrl:      order.PrescriptionURL,
+		RequiresPrescription: order.RequiresPrescription,
+		ShippingMethod:       order.ShippingMethod,
+		ShippingCost:         order.ShippingCost.Float64(),
+		Subtotal:             order.Subtotal.Float64(),
+		ShippingCostMoney:    toProtoMoney(order.ShippingCost, order.Currency),
+		SubtotalMoney:        toProtoMoney(order.Subtotal, order.Currency),
+		TaxTotalMoney:        toProtoMoney(order.TaxTotal, order.Currency),
+		GrandTotalMoney:      toProtoMoney(order.GrandTotal(), order.Currency),
+		TaxLines:             toProtoTaxLines(order.TaxLines, *orderItems, order.Currency),
+		ShippingAddress:      toProtoAddress(order.ShippingAddress),
+		Shipments:            toProtoShipments(order.Shipments, *orderItems),
+		Returns:              toProtoReturns(order.Returns, *orderItems),
+		RefundedTotalMoney:   toProtoMoney(order.RefundedTotal, order.Currency),
+		CancellationReason:   order.CancellationReason,
+		Items:                protoOrderItems,
+		CreatedAt:            order.CreatedAt.UnixMilli(),
+		UpdatedAt:            order.UpdatedAt.UnixMilli(),
 	}, nil
 }
 
 func (h *orderHandler) ListCustomersOrders(ctx context.Context, req *proto.ListCustomersOrdersRequest) (*proto.ListCustomersOrdersResponse, error) {
-	var filter models.Filter
-	if req.Filter != nil {
-		filter = models.Filter{
-			Column:   req.Filter.Column,
-			Operator: req.Filter.Operator,
-			Value:    req.Filter.Value,
-		}
+	filter := toModelFilterExpression(req.Filter, req.FilterGroup)
+	caller := auth.FromContext(ctx)
+	customerId := req.CustomerId
+	if customerId == "" {
+		customerId = caller.ID()
 	}
-	orders, total, err := h.orderService.ListCustomersOrders(req.CustomerId, filter, req.SortBy, req.SortOrder, req.Page, req.Limit)
+
+	orders, total, nextCursor, err := h.orderService.ListCustomersOrders(caller, customerId, query.Spec{
+		Filter:    filter,
+		SortBy:    req.SortBy,
+		SortOrder: req.SortOrder,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.ListCustomersOrdersResponse{
@@ -240,52 +258,460 @@ func (h *orderHandler) ListCustomersOrders(ctx context.Context, req *proto.ListC
 		}, nil
 	}
 
-	protoOrders := make([]*proto.Order, len(*orders))
-	for i, order := range *orders {
+	protoOrders := toProtoOrders(*orders)
+
+	return &proto.ListCustomersOrdersResponse{
+		Success:    true,
+		Orders:     protoOrders,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// toModelFilterExpression combines the legacy single filter and the filter
+// group of a list request into one expression joined with AND.
+func toModelFilterExpression(filter *proto.Filter, group *proto.FilterGroup) models.FilterExpression {
+	expr := toModelFilterGroup(group)
+	if filter == nil || toModelFilter(filter) == (models.Filter{}) {
+		return expr
+	}
+
+	return models.FilterExpression{
+		Operator:   models.FilterAnd,
+		Conditions: []models.Filter{toModelFilter(filter)},
+		Groups:     []models.FilterExpression{expr},
+	}
+}
+
+func toModelFilterGroup(group *proto.FilterGroup) models.FilterExpression {
+	if group == nil {
+		return models.FilterExpression{}
+	}
+
+	expr := models.FilterExpression{
+		Operator:   group.Operator,
+		Conditions: make([]models.Filter, len(group.Conditions)),
+		Groups:     make([]models.FilterExpression, len(group.Groups)),
+	}
+	for i, condition := range group.Conditions {
+		expr.Conditions[i] = toModelFilter(condition)
+	}
+	for i, nested := range group.Groups {
+		expr.Groups[i] = toModelFilterGroup(nested)
+	}
+
+	return expr
+}
+
+func toModelFilter(filter *proto.Filter) models.Filter {
+	return models.Filter{
+		Column:   filter.Column,
+		Operator: filter.Operator,
+		Value:    filter.Value,
+	}
+}
+
+// customerIDFrom returns the ID of the customer a request is made by.
+func customerIDFrom(caller *auth.Principal) (uuid.UUID, error) {
+	if caller == nil || caller.Service != "" {
+		return uuid.Nil, errors.NewAuthError("Only customers can place orders")
+	}
+
+	customerID, err := uuid.Parse(caller.Subject)
+	if err != nil {
+		return uuid.Nil, errors.NewAuthError("Invalid customer ID")
+	}
+
+	return customerID, nil
+}
+
+func toProtoMoney(amount money.Amount, currency string) *proto.Money {
+	return &proto.Money{
+		CurrencyCode: currency,
+		AmountMinor:  amount.Minor(),
+	}
+}
+
+func toProtoOrderItem(item models.OrderItem, currency string) *proto.OrderItem {
+	protoItem := &proto.OrderItem{
+		ItemId:            item.ID.String(),
+		ProductId:         item.ProductID.String(),
+		ProductName:       item.ProductName,
+		Quantity:          int32(item.Quantity),
+		CancelledQuantity: int32(item.CancelledQuantity),
+		Price:             item.Price.Float64(),
+		PriceMoney:        toProtoMoney(item.Price, currency),
+	}
+
+	if item.Prescription != nil {
+		protoItem.Prescription = &proto.Prescription{
+			PrescriptionId:    item.Prescription.ID.String(),
+			PrescriberName:    item.Prescription.PrescriberName,
+			PrescriberLicense: item.Prescription.PrescriberLicense,
+			IssuedAt:          item.Prescription.IssuedAt.UnixMilli(),
+			ExpiresAt:         item.Prescription.ExpiresAt.UnixMilli(),
+			RefillsAllowed:    int32(item.Prescription.RefillsAllowed),
+			FileUrl:           item.Prescription.FileURL,
+		}
+	}
+
+	return protoItem
+}
+
+func toModelPrescription(prescription *proto.Prescription) *models.Prescription {
+	if prescription == nil {
+		return nil
+	}
+
+	modelPrescription := &models.Prescription{
+		PrescriberName:    prescription.PrescriberName,
+		PrescriberLicense: prescription.PrescriberLicense,
+		RefillsAllowed:    int(prescription.RefillsAllowed),
+		FileURL:           prescription.FileUrl,
+	}
+	if prescription.IssuedAt > 0 {
+		modelPrescription.IssuedAt = time.UnixMilli(prescription.IssuedAt)
+	}
+	if prescription.ExpiresAt > 0 {
+		modelPrescription.ExpiresAt = time.UnixMilli(prescription.ExpiresAt)
+	}
+
+	return modelPrescription
+}
+
+func toProtoAddress(address models.Address) *proto.Address {
+	return &proto.Address{
+		Recipient:  address.Recipient,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+		Phone:      address.Phone,
+	}
+}
+
+func toModelAddress(address *proto.Address) models.Address {
+	if address == nil {
+		return models.Address{}
+	}
+
+	return models.Address{
+		Recipient:  address.Recipient,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+		Phone:      address.Phone,
+	}
+}
+
+func toProtoTaxLines(lines []models.OrderTaxLine, items []models.OrderItem, currency string) []*proto.TaxLine {
+	productIDs := make(map[uuid.UUID]string, len(items))
+	for _, item := range items {
+		productIDs[item.ID] = item.ProductID.String()
+	}
+
+	protoLines := make([]*proto.TaxLine, len(lines))
+	for i, line := range lines {
+		protoLines[i] = &proto.TaxLine{
+			ProductId:   productIDs[line.OrderItemID],
+			Name:        line.Name,
+			Region:      line.Region,
+			Category:    line.Category,
+			RatePpm:     line.RatePPM,
+			AmountMoney: toProtoMoney(line.Amount, currency),
+		}
+	}
+	return protoLines
+}
+
+func toProtoShipments(shipments []models.Shipment, items []models.OrderItem) []*proto.Shipment {
+	productIDs := make(map[uuid.UUID]string, len(items))
+	for _, item := range items {
+		productIDs[item.ID] = item.ProductID.String()
+	}
+
+	protoShipments := make([]*proto.Shipment, len(shipments))
+	for i, shipment := range shipments {
+		protoShipment := &proto.Shipment{
+			ShipmentId:     shipment.ID.String(),
+			Carrier:        shipment.Carrier,
+			TrackingNumber: shipment.TrackingNumber,
+			ShippedAt:      shipment.ShippedAt.UnixMilli(),
+		}
+		if shipment.EstimatedDelivery != nil {
+			estimatedDelivery := shipment.EstimatedDelivery.UnixMilli()
+			protoShipment.EstimatedDelivery = &estimatedDelivery
+		}
+		if shipment.DeliveredAt != nil {
+			deliveredAt := shipment.DeliveredAt.UnixMilli()
+			protoShipment.DeliveredAt = &deliveredAt
+		}
+		for _, item := range shipment.Items {
+			protoShipment.Items = append(protoShipment.Items, &proto.ShipmentItem{
+				ProductId: productIDs[item.OrderItemID],
+				Quantity:  int32(item.Quantity),
+				ItemId:    item.OrderItemID.String(),
+			})
+		}
+		for _, event := range shipment.Events {
+			protoShipment.Events = append(protoShipment.Events, &proto.ShipmentEvent{
+				Status:      event.Status,
+				Location:    event.Location,
+				Description: event.Description,
+				OccurredAt:  event.OccurredAt.UnixMilli(),
+			})
+		}
+		protoShipments[i] = protoShipment
+	}
+	return protoShipments
+}
+
+func toProtoReturns(returns []models.OrderReturn, items []models.OrderItem) []*proto.Return {
+	productIDs := make(map[uuid.UUID]string, len(items))
+	for _, item := range items {
+		productIDs[item.ID] = item.ProductID.String()
+	}
+
+	protoReturns := make([]*proto.Return, len(returns))
+	for i, orderReturn := range returns {
+		protoReturn := &proto.Return{
+			ReturnId:        orderReturn.ID.String(),
+			Status:          orderReturn.Status,
+			RejectionReason: orderReturn.RejectionReason,
+			Refund:          toProtoRefund(orderReturn.Refund),
+			CreatedAt:       orderReturn.CreatedAt.UnixMilli(),
+		}
+		for _, item := range orderReturn.Items {
+			protoReturn.Items = append(protoReturn.Items, &proto.ReturnItem{
+				ProductId: productIDs[item.OrderItemID],
+				Quantity:  int32(item.Quantity),
+				Reason:    item.Reason,
+				ItemId:    item.OrderItemID.String(),
+			})
+		}
+		protoReturns[i] = protoReturn
+	}
+	return protoReturns
+}
+
+func toProtoRefund(refund *models.Refund) *proto.Refund {
+	if refund == nil {
+		return nil
+	}
+
+	return &proto.Refund{
+		RefundId:  refund.ID.String(),
+		OrderId:   refund.OrderID.String(),
+		Reason:    refund.Reason,
+		Status:    refund.Status,
+		Amount:    toProtoMoney(refund.Amount, refund.Currency),
+		Error:     refund.LastError,
+		Attempts:  int32(refund.Attempts),
+		CreatedAt: refund.CreatedAt.UnixMilli(),
+		UpdatedAt: refund.UpdatedAt.UnixMilli(),
+	}
+}
+
+func toProtoStatusChange(change models.OrderStatusChange) *proto.OrderStatusChange {
+	return &proto.OrderStatusChange{
+		FromStatus: change.FromStatus,
+		ToStatus:   change.ToStatus,
+		Actor:      change.Actor,
+		ActorRole:  change.ActorRole,
+		Reason:     change.Reason,
+		ChangedAt:  change.ChangedAt.UnixMilli(),
+	}
+}
+
+func toProtoOrders(orders []services.OrderResponse) []*proto.Order {
+	protoOrders := make([]*proto.Order, len(orders))
+	for i, order := range orders {
 		protoOrders[i] = &proto.Order{
-			OrderId:         order.OrderID,
-			CustomerId:      order.CustomerID,
-			Status:          order.Status,
-			PrescriptionUrl: order.PrescriptionURL,
-			ShippingCost:    float64(order.ShippingCost),
-			Subtotal:        float64(order.Subtotal),
-			CreatedAt:       order.CreatedAt.UnixMilli(),
-			UpdatedAt:       order.UpdatedAt.UnixMilli(),
+			OrderId:              order.OrderID,
+			CustomerId:           order.CustomerID,
+			Status:               order.Status,
+			PrescriptionUrl:      order.PrescriptionURL,
+			RequiresPrescription: order.RequiresPrescription,
+			ShippingMethod:       order.ShippingMethod,
+			ShippingCost:         order.ShippingCost.Float64(),
+			Subtotal:             order.Subtotal.Float64(),
+			ShippingCostMoney:    toProtoMoney(order.ShippingCost, order.Currency),
+			SubtotalMoney:        toProtoMoney(order.Subtotal, order.Currency),
+			TaxTotalMoney:        toProtoMoney(order.TaxTotal, order.Currency),
+			GrandTotalMoney:      toProtoMoney(order.GrandTotal, order.Currency),
+			ShippingAddress:      toProtoAddress(order.ShippingAddress),
+			CreatedAt:            order.CreatedAt.UnixMilli(),
+			UpdatedAt:            order.UpdatedAt.UnixMilli(),
 		}
 		protoOrderItems := make([]*proto.OrderItem, len(order.Items))
 		for j, item := range order.Items {
-			protoOrderItems[j] = &proto.OrderItem{
-				ProductId:   item.ProductID.String(),
-				ProductName: item.ProductName,
-				Quantity:    int32(item.Quantity),
-				Price:       float64(item.Price),
-			}
+			protoOrderItems[j] = toProtoOrderItem(item, order.Currency)
 		}
 		protoOrders[i].Items = protoOrderItems
 	}
+	return protoOrders
+}
 
-	return &proto.ListCustomersOrdersResponse{
+func (h *orderHandler) ListAllOrders(ctx context.Context, req *proto.ListAllOrdersRequest) (*proto.ListAllOrdersResponse, error) {
+	filter := toModelFilterExpression(req.Filter, req.FilterGroup)
+	orders, total, nextCursor, err := h.orderService.ListAllOrders(auth.FromContext(ctx), query.Spec{
+		Filter:    filter,
+		SortBy:    req.SortBy,
+		SortOrder: req.SortOrder,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ListAllOrdersResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+		return &proto.ListAllOrdersResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	protoOrders := toProtoOrders(*orders)
+
+	return &proto.ListAllOrdersResponse{
+		Success:    true,
+		Orders:     protoOrders,
+		Total:      total,
+		Page:       req.Page,
+		Limit:      req.Limit,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+func (h *orderHandler) UpdateOrderStatus(ctx context.Context, req *proto.UpdateOrderStatusRequest) (*proto.UpdateOrderStatusResponse, error) {
+	err := h.orderService.UpdateOrderStatus(req.OrderId, auth.FromContext(ctx), req.Status)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.UpdateOrderStatusResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+		return &proto.UpdateOrderStatusResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.UpdateOrderStatusResponse{
 		Success: true,
-		Orders:  protoOrders,
+	}, nil
+}
+
+func (h *orderHandler) ReviewPrescription(ctx context.Context, req *proto.ReviewPrescriptionRequest) (*proto.ReviewPrescriptionResponse, error) {
+	err := h.orderService.ReviewPrescription(req.OrderId, auth.FromContext(ctx), req.Decision, req.Reason)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ReviewPrescriptionResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+		return &proto.ReviewPrescriptionResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.ReviewPrescriptionResponse{
+		Success: true,
+		Message: "Prescription " + req.Decision,
+	}, nil
+}
+
+func (h *orderHandler) ListPendingPrescriptions(ctx context.Context, req *proto.ListPendingPrescriptionsRequest) (*proto.ListPendingPrescriptionsResponse, error) {
+	orders, total, err := h.orderService.ListPendingPrescriptions(auth.FromContext(ctx), req.Page, req.Limit)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ListPendingPrescriptionsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+		return &proto.ListPendingPrescriptionsResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.ListPendingPrescriptionsResponse{
+		Success: true,
+		Orders:  toProtoOrders(*orders),
 		Total:   total,
 		Page:    req.Page,
 		Limit:   req.Limit,
 	}, nil
 }
 
-func (h *orderHandler) ListAllOrders(ctx context.Context, req *proto.ListAllOrdersRequest) (*proto.ListAllOrdersResponse, error) {
-	var filter models.Filter
-	if req.Filter != nil {
-		filter = models.Filter{
-			Column:   req.Filter.Column,
-			Operator: req.Filter.Operator,
-			Value:    req.Filter.Value,
+func (h *orderHandler) QuoteShipping(ctx context.Context, req *proto.QuoteShippingRequest) (*proto.QuoteShippingResponse, error) {
+	orderItems := make([]models.OrderItem, len(req.Items))
+	for i, item := range req.Items {
+		productId, err := uuid.Parse(item.ProductId)
+		if err != nil {
+			return &proto.QuoteShippingResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.ValidationError),
+					Message: "Validation failed",
+					Details: utils.ConvertMapToKeyValuePairs(map[string]string{"product_id": "Invalid product ID"}),
+				},
+			}, nil
+		}
+		orderItems[i] = models.OrderItem{
+			ProductID:   productId,
+			ProductName: item.ProductName,
+			Quantity:    int(item.Quantity),
 		}
 	}
-	orders, total, err := h.orderService.ListAllOrders(filter, req.SortBy, req.SortOrder, req.Page, req.Limit)
+
+	quote, subtotal, err := h.orderService.QuoteShipping(orderItems, req.GetShippingMethod(), req.GetRegion())
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
-			return &proto.ListAllOrdersResponse{
+			return &proto.QuoteShippingResponse{
 				Success: false,
 				Error: &proto.Error{
 					Type:    string(appErr.Type),
@@ -294,7 +720,7 @@ func (h *orderHandler) ListAllOrders(ctx context.Context, req *proto.ListAllOrde
 				},
 			}, nil
 		}
-		return &proto.ListAllOrdersResponse{
+		return &proto.QuoteShippingResponse{
 			Success: false,
 			Error: &proto.Error{
 				Type:    string(errors.InternalError),
@@ -303,44 +729,279 @@ func (h *orderHandler) ListAllOrders(ctx context.Context, req *proto.ListAllOrde
 		}, nil
 	}
 
-	protoOrders := make([]*proto.Order, len(*orders))
-	for i, order := range *orders {
-		protoOrders[i] = &proto.Order{
-			OrderId:         order.OrderID,
-			CustomerId:      order.CustomerID,
-			Status:          order.Status,
-			PrescriptionUrl: order.PrescriptionURL,
-			ShippingCost:    float64(order.ShippingCost),
-			Subtotal:        float64(order.Subtotal),
-			CreatedAt:       order.CreatedAt.UnixMilli(),
-			UpdatedAt:       order.UpdatedAt.UnixMilli(),
+	return &proto.QuoteShippingResponse{
+		Success:           true,
+		ShippingMethod:    quote.Method,
+		ShippingCost:      quote.Cost.Float64(),
+		Subtotal:          subtotal.Float64(),
+		ShippingCostMoney: toProtoMoney(quote.Cost, money.DefaultCurrency),
+		SubtotalMoney:     toProtoMoney(subtotal, money.DefaultCurrency),
+	}, nil
+}
+
+func (h *orderHandler) UpdateShippingAddress(ctx context.Context, req *proto.UpdateShippingAddressRequest) (*proto.UpdateShippingAddressResponse, error) {
+	err := h.orderService.UpdateShippingAddress(req.OrderId, auth.FromContext(ctx), toModelAddress(req.ShippingAddress))
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.UpdateShippingAddressResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
 		}
-		protoOrderItems := make([]*proto.OrderItem, len(order.Items))
-		for j, item := range order.Items {
-			protoOrderItems[j] = &proto.OrderItem{
-				ProductId:   item.ProductID.String(),
-				ProductName: item.ProductName,
-				Quantity:    int32(item.Quantity),
-				Price:       float64(item.Price),
-			}
+		return &proto.UpdateShippingAddressResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.UpdateShippingAddressResponse{
+		Success: true,
+		Message: "Shipping address updated",
+	}, nil
+}
+
+func (h *orderHandler) CreateShipment(ctx context.Context, req *proto.CreateShipmentRequest) (*proto.CreateShipmentResponse, error) {
+	shipment := &models.Shipment{
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+	}
+	if req.EstimatedDelivery != nil {
+		estimatedDelivery := time.UnixMilli(req.GetEstimatedDelivery())
+		shipment.EstimatedDelivery = &estimatedDelivery
+	}
+
+	items := make([]services.ShipmentItemRequest, len(req.Items))
+	for i, item := range req.Items {
+		itemId, err := uuid.Parse(item.ItemId)
+		if err != nil {
+			return &proto.CreateShipmentResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.ValidationError),
+					Message: "Validation failed",
+					Details: utils.ConvertMapToKeyValuePairs(map[string]string{fmt.Sprintf("items[%d].item_id", i): "Invalid item ID"}),
+				},
+			}, nil
+		}
+		items[i] = services.ShipmentItemRequest{
+			ItemID:   itemId,
+			Quantity: int(item.Quantity),
 		}
-		protoOrders[i].Items = protoOrderItems
 	}
 
-	return &proto.ListAllOrdersResponse{
+	err := h.orderService.CreateShipment(req.OrderId, auth.FromContext(ctx), shipment, items)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.CreateShipmentResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.CreateShipmentResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.CreateShipmentResponse{
+		Success:    true,
+		ShipmentId: shipment.ID.String(),
+	}, nil
+}
+
+func (h *orderHandler) RecordDeliveryEvent(ctx context.Context, req *proto.RecordDeliveryEventRequest) (*proto.RecordDeliveryEventResponse, error) {
+	if req.Event == nil {
+		return &proto.RecordDeliveryEventResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.ValidationError),
+				Message: "Validation failed",
+				Details: utils.ConvertMapToKeyValuePairs(map[string]string{"event": "Event is required"}),
+			},
+		}, nil
+	}
+
+	event := models.ShipmentEvent{
+		Status:      req.Event.Status,
+		Location:    req.Event.Location,
+		Description: req.Event.Description,
+	}
+	if req.Event.OccurredAt > 0 {
+		event.OccurredAt = time.UnixMilli(req.Event.OccurredAt)
+	}
+
+	err := h.orderService.RecordDeliveryEvent(req.ShipmentId, auth.FromContext(ctx), event)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.RecordDeliveryEventResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.RecordDeliveryEventResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.RecordDeliveryEventResponse{
 		Success: true,
-		Orders:  protoOrders,
+		Message: "Delivery event recorded",
+	}, nil
+}
+
+func (h *orderHandler) RequestReturn(ctx context.Context, req *proto.RequestReturnRequest) (*proto.RequestReturnResponse, error) {
+	items := make([]services.ReturnItemRequest, len(req.Items))
+	for i, item := range req.Items {
+		itemId, err := uuid.Parse(item.ItemId)
+		if err != nil {
+			return &proto.RequestReturnResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.ValidationError),
+					Message: "Validation failed",
+					Details: utils.ConvertMapToKeyValuePairs(map[string]string{fmt.Sprintf("items[%d].item_id", i): "Invalid item ID"}),
+				},
+			}, nil
+		}
+		items[i] = services.ReturnItemRequest{
+			ItemID:   itemId,
+			Quantity: int(item.Quantity),
+			Reason:   item.Reason,
+		}
+	}
+
+	orderReturn, err := h.orderService.RequestReturn(req.OrderId, auth.FromContext(ctx), items)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.RequestReturnResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.RequestReturnResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.RequestReturnResponse{
+		Success:  true,
+		ReturnId: orderReturn.ID.String(),
+	}, nil
+}
+
+func (h *orderHandler) ApproveReturn(ctx context.Context, req *proto.ApproveReturnRequest) (*proto.ApproveReturnResponse, error) {
+	refund, err := h.orderService.ApproveReturn(req.ReturnId, auth.FromContext(ctx), req.Decision, req.Reason)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ApproveReturnResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.ApproveReturnResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	message := "Return rejected"
+	if refund != nil {
+		message = "Return approved"
+		if refund.Status == models.RefundStatusFailed {
+			message = "Return approved, refund failed"
+		}
+	}
+
+	return &proto.ApproveReturnResponse{
+		Success: true,
+		Message: message,
+		Refund:  toProtoRefund(refund),
+	}, nil
+}
+
+func (h *orderHandler) ListRefunds(ctx context.Context, req *proto.ListRefundsRequest) (*proto.ListRefundsResponse, error) {
+	refunds, total, err := h.orderService.ListRefunds(auth.FromContext(ctx), req.GetStatus(), req.Page, req.Limit)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ListRefundsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.ListRefundsResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	protoRefunds := make([]*proto.Refund, len(refunds))
+	for i := range refunds {
+		protoRefunds[i] = toProtoRefund(&refunds[i])
+	}
+
+	return &proto.ListRefundsResponse{
+		Success: true,
+		Refunds: protoRefunds,
 		Total:   total,
 		Page:    req.Page,
 		Limit:   req.Limit,
 	}, nil
 }
 
-func (h *orderHandler) UpdateOrderStatus(ctx context.Context, req *proto.UpdateOrderStatusRequest) (*proto.UpdateOrderStatusResponse, error) {
-	err := h.orderService.UpdateOrderStatus(req.OrderId, req.CustomerId, req.Status)
+func (h *orderHandler) RetryRefund(ctx context.Context, req *proto.RetryRefundRequest) (*proto.RetryRefundResponse, error) {
+	refund, err := h.orderService.RetryRefund(req.RefundId, auth.FromContext(ctx))
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
-			return &proto.UpdateOrderStatusResponse{
+			return &proto.RetryRefundResponse{
 				Success: false,
 				Error: &proto.Error{
 					Type:    string(appErr.Type),
@@ -349,7 +1010,8 @@ func (h *orderHandler) UpdateOrderStatus(ctx context.Context, req *proto.UpdateO
 				},
 			}, nil
 		}
-		return &proto.UpdateOrderStatusResponse{
+
+		return &proto.RetryRefundResponse{
 			Success: false,
 			Error: &proto.Error{
 				Type:    string(errors.InternalError),
@@ -358,7 +1020,165 @@ func (h *orderHandler) UpdateOrderStatus(ctx context.Context, req *proto.UpdateO
 		}, nil
 	}
 
-	return &proto.UpdateOrderStatusResponse{
+	message := "Refund succeeded"
+	switch refund.Status {
+	case models.RefundStatusFailed:
+		message = "Refund failed again"
+	case models.RefundStatusNotRequired:
+		message = "Refund not required, no payment was captured"
+	}
+
+	return &proto.RetryRefundResponse{
+		Success: true,
+		Message: message,
+		Refund:  toProtoRefund(refund),
+	}, nil
+}
+
+func (h *orderHandler) CancelOrderItems(ctx context.Context, req *proto.CancelOrderItemsRequest) (*proto.CancelOrderItemsResponse, error) {
+	items := make([]services.CancelItemRequest, len(req.Items))
+	for i, item := range req.Items {
+		itemId, err := uuid.Parse(item.ItemId)
+		if err != nil {
+			return &proto.CancelOrderItemsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.ValidationError),
+					Message: "Validation failed",
+					Details: utils.ConvertMapToKeyValuePairs(map[string]string{fmt.Sprintf("items[%d].item_id", i): "Invalid item ID"}),
+				},
+			}, nil
+		}
+		items[i] = services.CancelItemRequest{
+			ItemID:   itemId,
+			Quantity: int(item.Quantity),
+		}
+	}
+
+	refund, paymentUrl, err := h.orderService.CancelOrderItems(req.OrderId, auth.FromContext(ctx), items)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.CancelOrderItemsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.CancelOrderItemsResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	message := "Items cancelled"
+	if refund != nil && refund.Status == models.RefundStatusFailed {
+		message = "Items cancelled, refund failed"
+	}
+
+	return &proto.CancelOrderItemsResponse{
+		Success:    true,
+		Message:    message,
+		Refund:     toProtoRefund(refund),
+		PaymentUrl: paymentUrl,
+	}, nil
+}
+
+func (h *orderHandler) AmendOrder(ctx context.Context, req *proto.AmendOrderRequest) (*proto.AmendOrderResponse, error) {
+	orderItems := make([]models.OrderItem, len(req.Items))
+	for i, item := range req.Items {
+		orderItems[i] = models.OrderItem{
+			Quantity:     int(item.Quantity),
+			Prescription: toModelPrescription(item.Prescription),
+		}
+
+		// Existing lines are referenced by item ID; new lines by product ID.
+		field, value, message := "product_id", item.ProductId, "Invalid product ID"
+		if item.ItemId != "" {
+			field, value, message = "item_id", item.ItemId, "Invalid item ID"
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return &proto.AmendOrderResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.ValidationError),
+					Message: "Validation failed",
+					Details: utils.ConvertMapToKeyValuePairs(map[string]string{fmt.Sprintf("items[%d].%s", i, field): message}),
+				},
+			}, nil
+		}
+		if item.ItemId != "" {
+			orderItems[i].ID = id
+		} else {
+			orderItems[i].ProductID = id
+		}
+	}
+
+	paymentUrl, err := h.orderService.AmendOrder(req.OrderId, auth.FromContext(ctx), orderItems)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.AmendOrderResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.AmendOrderResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	return &proto.AmendOrderResponse{
+		Success:    true,
+		PaymentUrl: paymentUrl,
+	}, nil
+}
+
+func (h *orderHandler) GetOrderHistory(ctx context.Context, req *proto.GetOrderHistoryRequest) (*proto.GetOrderHistoryResponse, error) {
+	history, err := h.orderService.GetOrderHistory(req.OrderId, auth.FromContext(ctx))
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.GetOrderHistoryResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.GetOrderHistoryResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	protoHistory := make([]*proto.OrderStatusChange, len(history))
+	for i, change := range history {
+		protoHistory[i] = toProtoStatusChange(change)
+	}
+
+	return &proto.GetOrderHistoryResponse{
 		Success: true,
+		History: protoHistory,
 	}, nil
 }
@@ -0,0 +1,199 @@
+package inventory
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+var (
+	reservationsExpired          = expvar.NewInt("stock_reservations_expired")
+	reservationsDeducted         = expvar.NewInt("stock_reservations_deducted")
+	reservationDeductionFailures = expvar.NewInt("stock_reservation_deduction_failures")
+	reservationsNeedingReview    = expvar.NewInt("stock_reservations_needs_review")
+)
+
+const (
+	// deductionTimeout bounds a call to the product service to deduct stock.
+	deductionTimeout = time.Minute
+
+	// staleDeductionAfter is how long a reservation may stay deducting before
+	// it is flagged for review. It is well above deductionTimeout, so the
+	// deduction of a flagged reservation is no longer running.
+	staleDeductionAfter = 10 * time.Minute
+
+	// outcomeAttempts is how often the outcome of a deduction is written
+	// before it is given up and left for the review sweep.
+	outcomeAttempts   = 3
+	outcomeRetryDelay = 100 * time.Millisecond
+)
+
+// Reconciler periodically releases expired stock holds and deducts the
+// stock of paid orders from the product service. Several reconcilers may
+// run against the same database.
+type Reconciler struct {
+	unitOfWork repositories.UnitOfWork
+	stock      StockService
+	interval   time.Duration
+	batchSize  int
+}
+
+func NewReconciler(unitOfWork repositories.UnitOfWork, stock StockService, interval time.Duration, batchSize int) *Reconciler {
+	return &Reconciler{
+		unitOfWork: unitOfWork,
+		stock:      stock,
+		interval:   interval,
+		batchSize:  batchSize,
+	}
+}
+
+// Run reconciles reservations every interval until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.ReconcileOnce(ctx); err != nil {
+				utils.Error("Failed to reconcile stock reservations", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// ReconcileOnce releases expired holds, flags reservations stuck deducting
+// for review and deducts up to one batch of committed reservations. A failed
+// deduction stays committed and is retried on the next run.
+func (r *Reconciler) ReconcileOnce(ctx context.Context) error {
+	err := r.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		released, err := repos.StockReservations.ReleaseExpired(time.Now())
+		if err != nil {
+			return err
+		}
+
+		if released > 0 {
+			reservationsExpired.Add(released)
+			utils.Info("Released expired stock reservations", map[string]interface{}{
+				"count": released,
+			})
+		}
+
+		flagged, err := repos.StockReservations.FlagStaleDeductions(time.Now().Add(-staleDeductionAfter))
+		if err != nil {
+			return err
+		}
+
+		if flagged > 0 {
+			reservationsNeedingReview.Add(flagged)
+			utils.Warn("Stock reservations need review, their deduction outcome was lost", map[string]interface{}{
+				"count":  flagged,
+				"status": models.ReservationStatusNeedsReview,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reservations that fail during this run are touched again and are left
+	// for the next one.
+	startedAt := time.Now()
+	for i := 0; i < r.batchSize && ctx.Err() == nil; i++ {
+		deducted, err := r.deductNext(ctx, startedAt)
+		if err != nil {
+			return err
+		}
+		if !deducted {
+			break
+		}
+	}
+
+	return nil
+}
+
+// deductNext deducts the stock of one committed reservation and reports
+// whether there was one to process. The reservation is claimed and marked
+// deducting in one transaction, the product service is called with no
+// transaction open and the outcome is recorded in a second one, which is
+// retried a few times. A reservation left deducting by a crash in between is
+// not deducted again; the review sweep in ReconcileOnce picks it up.
+func (r *Reconciler) deductNext(ctx context.Context, updatedBefore time.Time) (bool, error) {
+	var reservation *models.StockReservation
+
+	err := r.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		reservations, err := repos.StockReservations.ClaimCommitted(updatedBefore, 1)
+		if err != nil || len(reservations) == 0 {
+			return err
+		}
+		reservation = &reservations[0]
+
+		return repos.StockReservations.MarkDeducting(reservation.ID.String())
+	})
+	if err != nil || reservation == nil {
+		return false, err
+	}
+
+	productID := reservation.ProductID.String()
+	deductCtx, cancel := context.WithTimeout(ctx, deductionTimeout)
+	deductErr := r.stock.AdjustStock(deductCtx, productID, -reservation.Quantity, "order_placed")
+	cancel()
+
+	for attempt := 1; ; attempt++ {
+		err = r.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+			if deductErr != nil {
+				return repos.StockReservations.MarkDeductionFailed(reservation.ID.String(), deductErr)
+			}
+
+			// Availability checks read the product's stock and then its
+			// reservations under this lock; waiting for it keeps one from
+			// seeing the lower stock without this reservation.
+			if err := repos.StockReservations.LockProduct(productID); err != nil {
+				return err
+			}
+			return repos.StockReservations.MarkDeducted(reservation.ID.String())
+		})
+		if err == nil {
+			break
+		}
+		if attempt == outcomeAttempts {
+			// Logged with the outcome so the reviewing operator knows it.
+			utils.Error("Failed to record stock deduction outcome", map[string]interface{}{
+				"reservation_id": reservation.ID.String(),
+				"order_id":       reservation.OrderID.String(),
+				"product_id":     productID,
+				"quantity":       reservation.Quantity,
+				"deducted":       deductErr == nil,
+				"error":          err.Error(),
+			})
+			return true, err
+		}
+		time.Sleep(outcomeRetryDelay)
+	}
+
+	if deductErr != nil {
+		reservationDeductionFailures.Add(1)
+		utils.Warn("Failed to deduct reserved stock", map[string]interface{}{
+			"reservation_id": reservation.ID.String(),
+			"order_id":       reservation.OrderID.String(),
+			"product_id":     productID,
+			"quantity":       reservation.Quantity,
+			"attempts":       reservation.Attempts + 1,
+			"error":          deductErr.Error(),
+		})
+		return true, nil
+	}
+
+	reservationsDeducted.Add(1)
+	return true, nil
+}
@@ -0,0 +1,316 @@
+package inventory
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// memReservations is the stock_reservations table in memory. recordFailures
+// makes that many calls to MarkDeducted and MarkDeductionFailed fail.
+type memReservations struct {
+	repositories.StockReservationRepository
+	reservations   []*models.StockReservation
+	recordFailures int
+}
+
+func (r *memReservations) add(status string, quantity int, updatedAt time.Time) *models.StockReservation {
+	reservation := &models.StockReservation{
+		ID:        uuid.New(),
+		OrderID:   uuid.New(),
+		ProductID: uuid.New(),
+		Quantity:  quantity,
+		Status:    status,
+		ExpiresAt: updatedAt.Add(time.Hour),
+		UpdatedAt: updatedAt,
+	}
+	r.reservations = append(r.reservations, reservation)
+	return reservation
+}
+
+func (r *memReservations) find(reservationID string) *models.StockReservation {
+	for _, reservation := range r.reservations {
+		if reservation.ID.String() == reservationID {
+			return reservation
+		}
+	}
+	return nil
+}
+
+func (r *memReservations) LockProduct(productID string) error {
+	return nil
+}
+
+func (r *memReservations) ReleaseExpired(now time.Time) (int64, error) {
+	var released int64
+	for _, reservation := range r.reservations {
+		if reservation.Status == models.ReservationStatusHeld && !reservation.ExpiresAt.After(now) {
+			reservation.Status = models.ReservationStatusReleased
+			released++
+		}
+	}
+	return released, nil
+}
+
+func (r *memReservations) ClaimCommitted(updatedBefore time.Time, limit int) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	for _, reservation := range r.reservations {
+		if len(reservations) < limit && reservation.Status == models.ReservationStatusCommitted && reservation.UpdatedAt.Before(updatedBefore) {
+			reservations = append(reservations, *reservation)
+		}
+	}
+	return reservations, nil
+}
+
+func (r *memReservations) MarkDeducting(reservationID string) error {
+	reservation := r.find(reservationID)
+	reservation.Status = models.ReservationStatusDeducting
+	reservation.Attempts++
+	reservation.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memReservations) failRecord() error {
+	if r.recordFailures > 0 {
+		r.recordFailures--
+		return stderrors.New("connection reset")
+	}
+	return nil
+}
+
+func (r *memReservations) MarkDeducted(reservationID string) error {
+	if err := r.failRecord(); err != nil {
+		return err
+	}
+	reservation := r.find(reservationID)
+	now := time.Now()
+	reservation.Status = models.ReservationStatusDeducted
+	reservation.DeductedAt = &now
+	reservation.LastError = nil
+	reservation.UpdatedAt = now
+	return nil
+}
+
+func (r *memReservations) MarkDeductionFailed(reservationID string, cause error) error {
+	if err := r.failRecord(); err != nil {
+		return err
+	}
+	reservation := r.find(reservationID)
+	reason := cause.Error()
+	reservation.Status = models.ReservationStatusCommitted
+	reservation.LastError = &reason
+	reservation.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memReservations) FlagStaleDeductions(updatedBefore time.Time) (int64, error) {
+	var flagged int64
+	for _, reservation := range r.reservations {
+		if reservation.Status == models.ReservationStatusDeducting && reservation.UpdatedAt.Before(updatedBefore) {
+			reservation.Status = models.ReservationStatusNeedsReview
+			reservation.UpdatedAt = time.Now()
+			flagged++
+		}
+	}
+	return flagged, nil
+}
+
+// memUnitOfWork runs fn against the reservations and records whether a
+// transaction is open.
+type memUnitOfWork struct {
+	reservations *memReservations
+	inTx         bool
+}
+
+func (u *memUnitOfWork) WithTx(fn func(repos repositories.TxRepositories) error) error {
+	u.inTx = true
+	defer func() { u.inTx = false }()
+	return fn(repositories.TxRepositories{StockReservations: u.reservations})
+}
+
+// fakeStock is a product service that records stock adjustments.
+type fakeStock struct {
+	unitOfWork  *memUnitOfWork
+	err         error
+	adjustments []int
+	calledInTx  bool
+}
+
+func (s *fakeStock) GetStock(ctx context.Context, productID string) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStock) AdjustStock(ctx context.Context, productID string, delta int, reason string) error {
+	s.calledInTx = s.calledInTx || s.unitOfWork.inTx
+	if s.err != nil {
+		return s.err
+	}
+	s.adjustments = append(s.adjustments, delta)
+	return nil
+}
+
+func newTestReconciler() (*Reconciler, *memReservations, *fakeStock) {
+	reservations := &memReservations{}
+	unitOfWork := &memUnitOfWork{reservations: reservations}
+	stock := &fakeStock{unitOfWork: unitOfWork}
+	return NewReconciler(unitOfWork, stock, time.Minute, 10), reservations, stock
+}
+
+func TestReconcileOnceDeductsCommittedReservations(t *testing.T) {
+	reconciler, reservations, stock := newTestReconciler()
+	committed := reservations.add(models.ReservationStatusCommitted, 3, time.Now().Add(-time.Minute))
+	held := reservations.add(models.ReservationStatusHeld, 2, time.Now().Add(-time.Minute))
+
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("ReconcileOnce: %v", err)
+	}
+
+	if len(stock.adjustments) != 1 || stock.adjustments[0] != -3 {
+		t.Fatalf("stock adjustments = %v, want [-3]", stock.adjustments)
+	}
+	if stock.calledInTx {
+		t.Error("the product service was called inside a transaction")
+	}
+	if committed.Status != models.ReservationStatusDeducted || committed.DeductedAt == nil || committed.Attempts != 1 {
+		t.Errorf("committed reservation = %+v, want it deducted after one attempt", committed)
+	}
+	if held.Status != models.ReservationStatusHeld {
+		t.Errorf("held reservation status = %s, want it left %s", held.Status, models.ReservationStatusHeld)
+	}
+}
+
+func TestReconcileOnceRecommitsFailedDeductions(t *testing.T) {
+	reconciler, reservations, stock := newTestReconciler()
+	reservation := reservations.add(models.ReservationStatusCommitted, 3, time.Now().Add(-time.Minute))
+	stock.err = stderrors.New("product service unavailable")
+
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("ReconcileOnce: %v", err)
+	}
+
+	if reservation.Status != models.ReservationStatusCommitted || reservation.Attempts != 1 {
+		t.Fatalf("reservation = %+v, want it committed again after one attempt", reservation)
+	}
+	if reservation.LastError == nil || *reservation.LastError != "product service unavailable" {
+		t.Errorf("last error = %v, want the product service error", reservation.LastError)
+	}
+
+	// Retried on a later run once the product service is back.
+	stock.err = nil
+	reservation.UpdatedAt = time.Now().Add(-time.Minute)
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("second ReconcileOnce: %v", err)
+	}
+	if reservation.Status != models.ReservationStatusDeducted || reservation.Attempts != 2 || reservation.LastError != nil {
+		t.Errorf("reservation = %+v, want it deducted on the second attempt", reservation)
+	}
+}
+
+func TestReconcileOnceSkipsReservationsBeingDeducted(t *testing.T) {
+	reconciler, reservations, stock := newTestReconciler()
+	reservation := reservations.add(models.ReservationStatusDeducting, 3, time.Now().Add(-time.Minute))
+
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("ReconcileOnce: %v", err)
+	}
+
+	if len(stock.adjustments) != 0 {
+		t.Errorf("stock adjustments = %v, want none for a deduction whose outcome is unknown", stock.adjustments)
+	}
+	if reservation.Status != models.ReservationStatusDeducting {
+		t.Errorf("reservation status = %s, want %s", reservation.Status, models.ReservationStatusDeducting)
+	}
+}
+
+func TestReconcileOnceFlagsStaleDeductionsForReview(t *testing.T) {
+	reconciler, reservations, stock := newTestReconciler()
+	stale := reservations.add(models.ReservationStatusDeducting, 3, time.Now().Add(-staleDeductionAfter-time.Minute))
+	recent := reservations.add(models.ReservationStatusDeducting, 2, time.Now().Add(-time.Minute))
+	flagged := reservationsNeedingReview.Value()
+
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("ReconcileOnce: %v", err)
+	}
+
+	if stale.Status != models.ReservationStatusNeedsReview {
+		t.Errorf("stale reservation status = %s, want %s", stale.Status, models.ReservationStatusNeedsReview)
+	}
+	if recent.Status != models.ReservationStatusDeducting {
+		t.Errorf("recent reservation status = %s, want it left %s", recent.Status, models.ReservationStatusDeducting)
+	}
+	if got := reservationsNeedingReview.Value() - flagged; got != 1 {
+		t.Errorf("stock_reservations_needs_review grew by %d, want 1", got)
+	}
+
+	// A flagged reservation is never deducted by the loop.
+	stale.UpdatedAt = time.Now().Add(-time.Hour)
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("second ReconcileOnce: %v", err)
+	}
+	if len(stock.adjustments) != 0 || stale.Status != models.ReservationStatusNeedsReview {
+		t.Errorf("stock adjustments = %v, status = %s; want the flagged reservation left alone", stock.adjustments, stale.Status)
+	}
+}
+
+func TestReconcileOnceRetriesRecordingTheOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantErr    bool
+		wantStatus string
+	}{
+		{"recorded after a retry", outcomeAttempts - 1, false, models.ReservationStatusDeducted},
+		{"left for review when every attempt fails", outcomeAttempts, true, models.ReservationStatusDeducting},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reconciler, reservations, stock := newTestReconciler()
+			reservation := reservations.add(models.ReservationStatusCommitted, 3, time.Now().Add(-time.Minute))
+			reservations.recordFailures = tt.failures
+
+			err := reconciler.ReconcileOnce(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReconcileOnce error = %v, want an error: %v", err, tt.wantErr)
+			}
+
+			if len(stock.adjustments) != 1 {
+				t.Errorf("stock adjustments = %v, want the stock deducted once", stock.adjustments)
+			}
+			if reservation.Status != tt.wantStatus {
+				t.Errorf("reservation status = %s, want %s", reservation.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReconcileOnceReleasesExpiredHolds(t *testing.T) {
+	reconciler, reservations, _ := newTestReconciler()
+	expired := reservations.add(models.ReservationStatusHeld, 1, time.Now().Add(-2*time.Hour))
+	current := reservations.add(models.ReservationStatusHeld, 1, time.Now())
+
+	if err := reconciler.ReconcileOnce(context.Background()); err != nil {
+		t.Fatalf("ReconcileOnce: %v", err)
+	}
+
+	if expired.Status != models.ReservationStatusReleased {
+		t.Errorf("expired hold status = %s, want %s", expired.Status, models.ReservationStatusReleased)
+	}
+	if current.Status != models.ReservationStatusHeld {
+		t.Errorf("current hold status = %s, want %s", current.Status, models.ReservationStatusHeld)
+	}
+}
@@ -0,0 +1,93 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+)
+
+// Reserver places and changes stock holds for orders. All of its methods
+// run inside the caller's transaction.
+type Reserver struct {
+	stock StockService
+	ttl   time.Duration
+}
+
+func NewReserver(stock StockService, ttl time.Duration) *Reserver {
+	return &Reserver{stock: stock, ttl: ttl}
+}
+
+// Reserve holds stock for every item of the order. The items must already
+// be stored. A product whose available stock, i.e. its stock less what other
+// orders hold, is too low fails the whole reservation.
+func (r *Reserver) Reserve(ctx context.Context, repos repositories.TxRepositories, order *models.Order, items []models.OrderItem) error {
+	expiresAt := time.Now().Add(r.ttl)
+
+	for _, item := range items {
+		if err := r.checkAvailable(ctx, repos, item.ProductID.String(), item.ProductName, item.Quantity); err != nil {
+			return err
+		}
+
+		err := repos.StockReservations.CreateReservation(&models.StockReservation{
+			OrderID:     order.ID,
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Status:      models.ReservationStatusHeld,
+			ExpiresAt:   expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Increase adds quantity to the hold on a reservation, checking that the
+// product has enough available stock.
+func (r *Reserver) Increase(ctx context.Context, repos repositories.TxRepositories, reservation models.StockReservation, productName string, quantity int) error {
+	if err := r.checkAvailable(ctx, repos, reservation.ProductID.String(), productName, quantity); err != nil {
+		return err
+	}
+
+	return repos.StockReservations.AdjustQuantity(reservation.ID.String(), quantity)
+}
+
+// Renew holds the stock of a reservation whose hold expired again, checking
+// that the product still has enough available stock for it.
+func (r *Reserver) Renew(ctx context.Context, repos repositories.TxRepositories, reservation models.StockReservation, productName string) error {
+	if err := r.checkAvailable(ctx, repos, reservation.ProductID.String(), productName, reservation.Quantity); err != nil {
+		return err
+	}
+
+	return repos.StockReservations.Renew(reservation.ID.String(), time.Now().Add(r.ttl))
+}
+
+// checkAvailable locks the product and fails unless quantity more of it can
+// be held. The lock is kept until the transaction ends.
+func (r *Reserver) checkAvailable(ctx context.Context, repos repositories.TxRepositories, productID, productName string, quantity int) error {
+	if err := repos.StockReservations.LockProduct(productID); err != nil {
+		return err
+	}
+
+	stock, err := r.stock.GetStock(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	reserved, err := repos.StockReservations.ReservedQuantity(productID)
+	if err != nil {
+		return err
+	}
+
+	if stock-reserved < quantity {
+		return errors.NewValidationError("stock", fmt.Sprintf("Not enough stock for product %s", productName))
+	}
+
+	return nil
+}
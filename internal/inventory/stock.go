@@ -0,0 +1,62 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+)
+
+// StockService is the part of the product service the order service needs
+// to manage stock. Tests can replace it with an in-memory implementation.
+type StockService interface {
+	GetStock(ctx context.Context, productID string) (int, error)
+	AdjustStock(ctx context.Context, productID string, delta int, reason string) error
+}
+
+type productStockService struct {
+	productClient proto.ProductServiceClient
+}
+
+func NewProductStockService(productClient proto.ProductServiceClient) StockService {
+	return &productStockService{productClient}
+}
+
+func (s *productStockService) GetStock(ctx context.Context, productID string) (int, error) {
+	resp, err := s.productClient.GetProduct(ctx, &proto.GetProductRequest{ProductId: productID})
+	if err != nil {
+		return 0, err
+	}
+
+	if !resp.Success || resp.Product == nil {
+		return 0, errors.NewNotFoundError(fmt.Sprintf("Product with ID '%s' not found", productID))
+	}
+
+	return int(resp.Product.Stock), nil
+}
+
+// AdjustStock adds delta to the product's stock; a negative delta deducts.
+func (s *productStockService) AdjustStock(ctx context.Context, productID string, delta int, reason string) error {
+	resp, err := s.productClient.UpdateStock(ctx, &proto.UpdateStockRequest{
+		ProductId:      productID,
+		QuantityChange: int32(delta),
+		Reason:         reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		message := fmt.Sprintf("Failed to update stock for product %s", productID)
+		if resp.Error != nil {
+			message = resp.Error.Message
+		}
+		return &errors.AppError{
+			Type:    errors.InternalError,
+			Message: message,
+		}
+	}
+
+	return nil
+}
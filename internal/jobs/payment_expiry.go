@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+var (
+	paymentExpiryRuns      = expvar.NewInt("payment_expiry_runs")
+	paymentExpiryFailures  = expvar.NewInt("payment_expiry_failures")
+	paymentExpiryCancelled = expvar.NewInt("payment_expiry_cancelled_orders")
+)
+
+// PendingOrderExpirer cancels orders that were never paid.
+type PendingOrderExpirer interface {
+	ExpirePendingOrders(ctx context.Context, createdBefore time.Time, limit int) (int, error)
+}
+
+// PaymentExpiryJob periodically cancels orders that have been waiting for
+// payment longer than the timeout, releasing the stock they hold. It is safe
+// to run on every replica; orders are claimed with row locks.
+type PaymentExpiryJob struct {
+	expirer   PendingOrderExpirer
+	interval  time.Duration
+	timeout   time.Duration
+	batchSize int
+}
+
+func NewPaymentExpiryJob(expirer PendingOrderExpirer, interval, timeout time.Duration, batchSize int) *PaymentExpiryJob {
+	return &PaymentExpiryJob{
+		expirer:   expirer,
+		interval:  interval,
+		timeout:   timeout,
+		batchSize: batchSize,
+	}
+}
+
+// Run expires orders every interval until ctx is cancelled.
+func (j *PaymentExpiryJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := j.RunOnce(ctx); err != nil {
+				utils.Error("Failed to expire unpaid orders", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// RunOnce cancels expired orders in batches until none are left and returns
+// how many were cancelled.
+func (j *PaymentExpiryJob) RunOnce(ctx context.Context) (int, error) {
+	paymentExpiryRuns.Add(1)
+
+	cancelled := 0
+	createdBefore := time.Now().Add(-j.timeout)
+	for ctx.Err() == nil {
+		count, err := j.expirer.ExpirePendingOrders(ctx, createdBefore, j.batchSize)
+		cancelled += count
+		paymentExpiryCancelled.Add(int64(count))
+		if err != nil {
+			paymentExpiryFailures.Add(1)
+			return cancelled, err
+		}
+
+		if count < j.batchSize {
+			break
+		}
+	}
+
+	if cancelled > 0 {
+		utils.Info("Cancelled unpaid orders", map[string]interface{}{
+			"count":          cancelled,
+			"created_before": createdBefore,
+			"reason":         "payment_timeout",
+		})
+	}
+
+	return cancelled, nil
+}
@@ -0,0 +1,14 @@
+package models
+
+// Address is a postal address. Orders embed a snapshot of the shipping
+// address taken when the order was placed.
+type Address struct {
+	Recipient  string  `gorm:"type:varchar(255)"`
+	Line1      string  `gorm:"type:varchar(255)"`
+	Line2      *string `gorm:"type:varchar(255)"`
+	City       string  `gorm:"type:varchar(100)"`
+	Region     string  `gorm:"type:varchar(10)"`
+	PostalCode string  `gorm:"type:varchar(20)"`
+	Country    string  `gorm:"type:char(2)"`
+	Phone      string  `gorm:"type:varchar(30)"`
+}
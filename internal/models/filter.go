@@ -6,3 +6,19 @@ type Filter struct {
 	Operator string `json:"operator"`
 	Value    string `json:"value"`
 }
+
+// Logical operators joining the parts of a FilterExpression.
+const (
+	FilterAnd = "and"
+	FilterOr  = "or"
+)
+
+// FilterExpression is a group of conditions and nested groups joined by one
+// logical operator, e.g. status IN (paid, approved) AND (created_at >= X OR
+// subtotal > 100). An empty operator means "and"; an empty expression
+// matches everything.
+type FilterExpression struct {
+	Operator   string             `json:"operator"`
+	Conditions []Filter           `json:"conditions"`
+	Groups     []FilterExpression `json:"groups"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey remembers the outcome of a PlaceOrder call so that a retry
+// with the same key returns the original order instead of creating a new one.
+type IdempotencyKey struct {
+	CustomerID  uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Key         string     `gorm:"type:varchar(255);primaryKey"`
+	RequestHash string     `gorm:"type:varchar(64);not null"`
+	OrderID     *uuid.UUID `gorm:"type:uuid"`
+	PaymentURL  *string    `gorm:"type:text"`
+	CreatedAt   time.Time  `gorm:"type:timestamptz;default:now()"`
+	ExpiresAt   time.Time  `gorm:"type:timestamptz;not null;index"`
+}
@@ -3,22 +3,65 @@ package models
 import (
 	"time"
 
+	"github.com/PharmaKart/order-svc/pkg/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Order statuses. The allowed transitions between them are declared in the
+// statemachine package.
+const (
+	OrderStatusPending        = "pending"
+	OrderStatusPaymentPending = "payment_pending"
+	OrderStatusPaid           = "paid"
+	OrderStatusApproved       = "approved"
+	OrderStatusShipped        = "shipped"
+	OrderStatusCompleted      = "completed"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusFailed         = "failed"
+)
+
+// Reasons recorded when an order is cancelled.
+const (
+	CancellationReasonCustomerRequest      = "customer_request"
+	CancellationReasonAdminRequest         = "admin_request"
+	CancellationReasonPrescriptionRejected = "prescription_rejected"
+	CancellationReasonPaymentTimeout       = "payment_timeout"
+	CancellationReasonOutOfStock           = "out_of_stock"
+)
+
 type Order struct {
-	ID              uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	CustomerID      uuid.UUID `gorm:"not null"`
-	Status          string    `gorm:"type:varchar(50);not null;check:status IN ('pending', 'approved', 'paid', 'shipped', 'completed', 'cancelled')"`
-	PrescriptionURL *string   `gorm:"type:text"`
-	ShippingCost    float64   `gorm:"type:numeric(10,2);default:0.00"`
-	Subtotal        float64   `gorm:"type:numeric(10,2);default:0.00"`
-	CreatedAt       time.Time `gorm:"type:timestamptz;default:now()"`
-	UpdatedAt       time.Time `gorm:"type:timestamptz;default:now()"`
+	ID                   uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	CustomerID           uuid.UUID    `gorm:"not null"`
+	Status               string       `gorm:"type:varchar(50);not null;check:status IN ('pending', 'payment_pending', 'approved', 'paid', 'shipped', 'completed', 'cancelled', 'failed')"`
+	PrescriptionURL      *string      `gorm:"type:text"`
+	RequiresPrescription bool         `gorm:"not null;default:false"`
+	ShippingMethod       string       `gorm:"type:varchar(50);not null;default:'standard'"`
+	ShippingAddress      Address      `gorm:"embedded;embeddedPrefix:shipping_"`
+	ShippingCost         money.Amount `gorm:"type:numeric(10,2);default:0.00"`
+	Subtotal             money.Amount `gorm:"type:numeric(10,2);default:0.00"`
+	TaxTotal             money.Amount `gorm:"type:numeric(10,2);default:0.00"`
+	PaidTotal            money.Amount `gorm:"type:numeric(10,2);not null;default:0.00"`
+	RefundedTotal        money.Amount `gorm:"type:numeric(10,2);not null;default:0.00"`
+	Currency             string       `gorm:"type:char(3);not null;default:'CAD'"`
+	CancellationReason   *string      `gorm:"type:varchar(50)"`
+	IdempotencyKey       *string      `gorm:"type:varchar(255);index"`
+	ExpiryFailedAt       *time.Time   `gorm:"type:timestamptz"`
+	CreatedAt            time.Time    `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt            time.Time    `gorm:"type:timestamptz;default:now()"`
+
+	Items     []OrderItem    `gorm:"foreignKey:OrderID"`
+	TaxLines  []OrderTaxLine `gorm:"foreignKey:OrderID"`
+	Shipments []Shipment     `gorm:"foreignKey:OrderID"`
+	Returns   []OrderReturn  `gorm:"foreignKey:OrderID"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
 	o.ID = uuid.New()
 	return
 }
+
+// GrandTotal is the amount the customer pays: subtotal, shipping and tax.
+func (o *Order) GrandTotal() money.Amount {
+	return o.Subtotal + o.ShippingCost + o.TaxTotal
+}
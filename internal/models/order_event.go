@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Order domain event types published through the outbox.
+const (
+	OrderEventPlaced    = "OrderPlaced"
+	OrderEventPaid      = "OrderPaid"
+	OrderEventApproved  = "OrderApproved"
+	OrderEventShipped   = "OrderShipped"
+	OrderEventCompleted = "OrderCompleted"
+	OrderEventCancelled = "OrderCancelled"
+	OrderEventFailed    = "OrderFailed"
+
+	OrderEventAmended                = "OrderAmended"
+	OrderEventItemsCancelled         = "OrderItemsCancelled"
+	OrderEventShippingAddressChanged = "ShippingAddressChanged"
+	OrderEventRefundSucceeded        = "RefundSucceeded"
+	OrderEventRefundFailed           = "RefundFailed"
+	OrderEventRefundNotRequired      = "RefundNotRequired"
+)
+
+// OrderEvent is an outbox row. It is written in the same transaction as the
+// order change it describes and published later by the outbox relay. An
+// event that could not be delivered in the allowed number of attempts is
+// marked dead and left for an operator.
+type OrderEvent struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	EventType     string     `gorm:"type:varchar(50);not null"`
+	Payload       string     `gorm:"type:jsonb;not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     *string    `gorm:"type:text"`
+	NextAttemptAt time.Time  `gorm:"type:timestamptz;default:now()"`
+	PublishedAt   *time.Time `gorm:"type:timestamptz"`
+	DeadAt        *time.Time `gorm:"type:timestamptz"`
+	CreatedAt     time.Time  `gorm:"type:timestamptz;default:now()"`
+}
+
+func (oe *OrderEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	oe.ID = uuid.New()
+	return
+}
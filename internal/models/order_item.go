@@ -3,18 +3,24 @@ package models
 import (
 	"time"
 
+	"github.com/PharmaKart/order-svc/pkg/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type OrderItem struct {
-	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	OrderID     uuid.UUID `gorm:"not null"`
-	ProductID   uuid.UUID `gorm:"not null"`
-	ProductName string    `gorm:"not null"`
-	Quantity    int       `gorm:"not null;check:quantity > 0"`
-	Price       float64   `gorm:"not null"`
-	CreatedAt   time.Time `gorm:"type:timestamptz;default:now()"`
+	ID                uuid.UUID     `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID           uuid.UUID     `gorm:"not null"`
+	ProductID         uuid.UUID     `gorm:"not null"`
+	ProductName       string        `gorm:"not null"`
+	Quantity          int           `gorm:"not null;check:quantity >= 0"`
+	CancelledQuantity int           `gorm:"not null;default:0"`
+	Price             money.Amount  `gorm:"type:numeric(10,2);not null"`
+	WeightGrams       int           `gorm:"not null;default:0"`
+	TaxCategory       string        `gorm:"type:varchar(30);not null;default:'otc'"`
+	PrescriptionID    *uuid.UUID    `gorm:"type:uuid"`
+	Prescription      *Prescription `gorm:"foreignKey:PrescriptionID"`
+	CreatedAt         time.Time     `gorm:"type:timestamptz;default:now()"`
 }
 
 func (oi *OrderItem) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Order return statuses.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+)
+
+// OrderReturn is a customer's request to send back part of a shipped order.
+type OrderReturn struct {
+	ID              uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID         uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CustomerID      uuid.UUID  `gorm:"type:uuid;not null"`
+	Status          string     `gorm:"type:varchar(20);not null;check:status IN ('requested', 'approved', 'rejected')"`
+	RejectionReason *string    `gorm:"type:text"`
+	ReviewedAt      *time.Time `gorm:"type:timestamptz"`
+	CreatedAt       time.Time  `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt       time.Time  `gorm:"type:timestamptz;default:now()"`
+
+	Items  []OrderReturnItem `gorm:"foreignKey:ReturnID"`
+	Refund *Refund           `gorm:"foreignKey:ReturnID"`
+}
+
+func (or *OrderReturn) BeforeCreate(tx *gorm.DB) (err error) {
+	or.ID = uuid.New()
+	return
+}
+
+type OrderReturnItem struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ReturnID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	OrderItemID uuid.UUID `gorm:"type:uuid;not null"`
+	Quantity    int       `gorm:"not null;check:quantity > 0"`
+	Reason      string    `gorm:"type:text;not null"`
+}
+
+func (ori *OrderReturnItem) BeforeCreate(tx *gorm.DB) (err error) {
+	ori.ID = uuid.New()
+	return
+}
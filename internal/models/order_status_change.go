@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OrderStatusChange is one entry of an order's status history. FromStatus is
+// nil for the entry recorded when the order is created.
+type OrderStatusChange struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	FromStatus *string   `gorm:"type:varchar(50)"`
+	ToStatus   string    `gorm:"type:varchar(50);not null"`
+	Actor      string    `gorm:"type:varchar(100);not null"` // caller's subject, calling service or "system"
+	ActorRole  string    `gorm:"type:varchar(50);not null"`
+	Reason     *string   `gorm:"type:text"`
+	ChangedAt  time.Time `gorm:"type:timestamptz;not null;default:now()"`
+}
+
+func (OrderStatusChange) TableName() string {
+	return "order_status_history"
+}
+
+func (c *OrderStatusChange) BeforeCreate(tx *gorm.DB) (err error) {
+	c.ID = uuid.New()
+	return
+}
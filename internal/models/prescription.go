@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Prescription is a prescriber's script attached to the order items it covers.
+type Prescription struct {
+	ID                uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID           uuid.UUID `gorm:"type:uuid;not null;index"`
+	PrescriberName    string    `gorm:"not null"`
+	PrescriberLicense *string   `gorm:"type:varchar(100)"`
+	IssuedAt          time.Time `gorm:"type:date;not null"`
+	ExpiresAt         time.Time `gorm:"type:date;not null"`
+	RefillsAllowed    int       `gorm:"not null;default:0;check:refills_allowed >= 0"`
+	FileURL           string    `gorm:"type:text;not null"`
+	CreatedAt         time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+func (p *Prescription) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Prescription review decisions.
+const (
+	PrescriptionDecisionApproved = "approved"
+	PrescriptionDecisionRejected = "rejected"
+)
+
+type PrescriptionReview struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	ReviewerID uuid.UUID `gorm:"type:uuid;not null"`
+	Decision   string    `gorm:"type:varchar(20);not null;check:decision IN ('approved', 'rejected')"`
+	Reason     *string   `gorm:"type:text"`
+	ReviewedAt time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+func (pr *PrescriptionReview) BeforeCreate(tx *gorm.DB) (err error) {
+	pr.ID = uuid.New()
+	return
+}
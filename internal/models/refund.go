@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Refund statuses. A refund is not required when the payment service holds
+// no captured payment for the order, so there was no money to send back.
+const (
+	RefundStatusPending     = "pending"
+	RefundStatusSucceeded   = "succeeded"
+	RefundStatusFailed      = "failed"
+	RefundStatusNotRequired = "not_required"
+)
+
+// Refund reasons.
+const (
+	RefundReasonReturn         = "return"
+	RefundReasonOrderCancelled = "order_cancelled"
+	RefundReasonItemsCancelled = "items_cancelled"
+	// RefundReasonStalePayment returns a payment that does not pay for the
+	// order, e.g. one made through a payment URL issued before the order was
+	// amended.
+	RefundReasonStalePayment = "stale_payment"
+)
+
+// Refund records money sent back to the customer through the payment
+// service. It is written before the payment service is called so a refund
+// that fails, or is interrupted, stays visible and can be retried.
+// TransactionID is the refunded payment; it is set once the refund succeeds,
+// or from the start when the refund is for one particular payment.
+type Refund struct {
+	ID            uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID       uuid.UUID    `gorm:"type:uuid;not null;index"`
+	ReturnID      *uuid.UUID   `gorm:"type:uuid;uniqueIndex"`
+	Reason        string       `gorm:"type:varchar(30);not null"`
+	Amount        money.Amount `gorm:"type:numeric(10,2);not null"`
+	Currency      string       `gorm:"type:char(3);not null;default:'CAD'"`
+	Status        string       `gorm:"type:varchar(20);not null;check:status IN ('pending', 'succeeded', 'failed', 'not_required')"`
+	TransactionID *string      `gorm:"type:varchar(255)"`
+	Attempts      int          `gorm:"not null;default:0"`
+	LastError     *string      `gorm:"type:text"`
+	CreatedAt     time.Time    `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt     time.Time    `gorm:"type:timestamptz;default:now()"`
+}
+
+func (r *Refund) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New()
+	return
+}
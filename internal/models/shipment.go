@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Carrier scan event statuses.
+const (
+	ShipmentEventPickedUp       = "picked_up"
+	ShipmentEventInTransit      = "in_transit"
+	ShipmentEventOutForDelivery = "out_for_delivery"
+	ShipmentEventDelivered      = "delivered"
+	ShipmentEventException      = "exception"
+)
+
+// Shipment is one parcel of an order. An order may be fulfilled by several
+// shipments, each carrying part of its items.
+type Shipment struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID           uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Carrier           string     `gorm:"type:varchar(100);not null"`
+	TrackingNumber    string     `gorm:"type:varchar(100);not null;index"`
+	ShippedAt         time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+	EstimatedDelivery *time.Time `gorm:"type:timestamptz"`
+	DeliveredAt       *time.Time `gorm:"type:timestamptz"`
+	CreatedAt         time.Time  `gorm:"type:timestamptz;default:now()"`
+
+	Items  []ShipmentItem  `gorm:"foreignKey:ShipmentID"`
+	Events []ShipmentEvent `gorm:"foreignKey:ShipmentID"`
+}
+
+func (s *Shipment) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New()
+	return
+}
+
+type ShipmentItem struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ShipmentID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	OrderItemID uuid.UUID `gorm:"type:uuid;not null"`
+	Quantity    int       `gorm:"not null;check:quantity > 0"`
+}
+
+func (si *ShipmentItem) BeforeCreate(tx *gorm.DB) (err error) {
+	si.ID = uuid.New()
+	return
+}
+
+type ShipmentEvent struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ShipmentID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	Status      string    `gorm:"type:varchar(30);not null;check:status IN ('picked_up', 'in_transit', 'out_for_delivery', 'delivered', 'exception')"`
+	Location    *string   `gorm:"type:varchar(255)"`
+	Description *string   `gorm:"type:text"`
+	OccurredAt  time.Time `gorm:"type:timestamptz;not null"`
+	CreatedAt   time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+func (se *ShipmentEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	se.ID = uuid.New()
+	return
+}
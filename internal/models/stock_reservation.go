@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Stock reservation statuses. Held, committed, deducting and needs_review
+// reservations count against the available stock of a product; a deducted
+// one is already reflected in the product service's stock. A deducting
+// reservation is being deducted by the reconcile loop and its outcome is not
+// recorded yet. One that stays deducting too long needs review: an operator
+// checks the product service's stock and marks it deducted or committed.
+const (
+	ReservationStatusHeld        = "held"
+	ReservationStatusCommitted   = "committed"
+	ReservationStatusDeducting   = "deducting"
+	ReservationStatusNeedsReview = "needs_review"
+	ReservationStatusDeducted    = "deducted"
+	ReservationStatusReleased    = "released"
+)
+
+// StockReservation holds stock for one order item while the order waits
+// for payment. Payment commits it, and the reconcile loop then deducts the
+// quantity from the product service. Expiry or cancellation releases it.
+type StockReservation struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	OrderItemID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex"`
+	ProductID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Quantity    int        `gorm:"not null;check:quantity >= 0"`
+	Status      string     `gorm:"type:varchar(20);not null;index;check:status IN ('held', 'committed', 'deducting', 'needs_review', 'deducted', 'released')"`
+	ExpiresAt   time.Time  `gorm:"type:timestamptz;not null"`
+	DeductedAt  *time.Time `gorm:"type:timestamptz"`
+	Attempts    int        `gorm:"not null;default:0"`
+	LastError   *string    `gorm:"type:text"`
+	CreatedAt   time.Time  `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt   time.Time  `gorm:"type:timestamptz;default:now()"`
+}
+
+func (sr *StockReservation) BeforeCreate(tx *gorm.DB) (err error) {
+	sr.ID = uuid.New()
+	return
+}
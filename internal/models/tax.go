@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Product tax categories.
+const (
+	TaxCategoryPrescription = "prescription"
+	TaxCategoryOTC          = "otc"
+)
+
+// TaxRate is one versioned rate for a region and product category. Rates
+// are never updated in place: a change closes the current row with
+// EffectiveTo and adds a new one, so past orders keep the rate they paid.
+type TaxRate struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Region        string     `gorm:"type:varchar(10);not null;index:idx_tax_rates_lookup"`
+	Category      string     `gorm:"type:varchar(30);not null;index:idx_tax_rates_lookup"`
+	Name          string     `gorm:"type:varchar(50);not null"`
+	RatePPM       int64      `gorm:"not null;check:rate_ppm >= 0"`
+	EffectiveFrom time.Time  `gorm:"type:timestamptz;not null"`
+	EffectiveTo   *time.Time `gorm:"type:timestamptz"`
+	CreatedAt     time.Time  `gorm:"type:timestamptz;default:now()"`
+}
+
+func (tr *TaxRate) BeforeCreate(tx *gorm.DB) (err error) {
+	tr.ID = uuid.New()
+	return
+}
+
+// OrderTaxLine is the tax charged on one order item under one rate.
+type OrderTaxLine struct {
+	ID          uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID     uuid.UUID    `gorm:"type:uuid;not null;index"`
+	OrderItemID uuid.UUID    `gorm:"type:uuid;not null"`
+	TaxRateID   uuid.UUID    `gorm:"type:uuid;not null"`
+	Name        string       `gorm:"type:varchar(50);not null"`
+	Region      string       `gorm:"type:varchar(10);not null"`
+	Category    string       `gorm:"type:varchar(30);not null"`
+	RatePPM     int64        `gorm:"not null"`
+	Amount      money.Amount `gorm:"type:numeric(10,2);not null"`
+	CreatedAt   time.Time    `gorm:"type:timestamptz;default:now()"`
+}
+
+func (otl *OrderTaxLine) BeforeCreate(tx *gorm.DB) (err error) {
+	otl.ID = uuid.New()
+	return
+}
@@ -0,0 +1,234 @@
+package outbox
+
+import (
+	"encoding/json"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// statusEvents maps the status an order enters to the event announcing it.
+var statusEvents = map[string]string{
+	models.OrderStatusPaid:      models.OrderEventPaid,
+	models.OrderStatusApproved:  models.OrderEventApproved,
+	models.OrderStatusShipped:   models.OrderEventShipped,
+	models.OrderStatusCompleted: models.OrderEventCompleted,
+	models.OrderStatusCancelled: models.OrderEventCancelled,
+	models.OrderStatusFailed:    models.OrderEventFailed,
+}
+
+// StatusChangedPayload is the payload of every status change event.
+type StatusChangedPayload struct {
+	OrderID string `json:"order_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Actor   string `json:"actor"`
+}
+
+// OrderPlacedPayload is the payload of the OrderPlaced event.
+type OrderPlacedPayload struct {
+	OrderID      string        `json:"order_id"`
+	CustomerID   string        `json:"customer_id"`
+	Status       string        `json:"status"`
+	Currency     string        `json:"currency"`
+	Subtotal     money.Amount  `json:"subtotal"`
+	ShippingCost money.Amount  `json:"shipping_cost"`
+	TaxTotal     money.Amount  `json:"tax_total"`
+	GrandTotal   money.Amount  `json:"grand_total"`
+	Items        []ItemPayload `json:"items"`
+}
+
+// ItemPayload is an order line as it appears in event payloads.
+type ItemPayload struct {
+	ItemID    string       `json:"item_id"`
+	ProductID string       `json:"product_id"`
+	Quantity  int          `json:"quantity"`
+	Price     money.Amount `json:"price"`
+}
+
+// OrderAmendedPayload is the payload of the OrderAmended event. Items are
+// the order's lines after the amendment.
+type OrderAmendedPayload struct {
+	OrderID      string        `json:"order_id"`
+	Currency     string        `json:"currency"`
+	Subtotal     money.Amount  `json:"subtotal"`
+	ShippingCost money.Amount  `json:"shipping_cost"`
+	TaxTotal     money.Amount  `json:"tax_total"`
+	GrandTotal   money.Amount  `json:"grand_total"`
+	Items        []ItemPayload `json:"items"`
+}
+
+// OrderItemsCancelledPayload is the payload of the OrderItemsCancelled
+// event. Cancelled holds the quantities taken off each line; the totals are
+// the order's new totals.
+type OrderItemsCancelledPayload struct {
+	OrderID      string        `json:"order_id"`
+	Currency     string        `json:"currency"`
+	Subtotal     money.Amount  `json:"subtotal"`
+	ShippingCost money.Amount  `json:"shipping_cost"`
+	TaxTotal     money.Amount  `json:"tax_total"`
+	GrandTotal   money.Amount  `json:"grand_total"`
+	Cancelled    []ItemPayload `json:"cancelled"`
+}
+
+// ShippingAddressChangedPayload is the payload of the ShippingAddressChanged
+// event.
+type ShippingAddressChangedPayload struct {
+	OrderID    string  `json:"order_id"`
+	Recipient  string  `json:"recipient"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	Region     string  `json:"region"`
+	PostalCode string  `json:"postal_code"`
+	Country    string  `json:"country"`
+	Phone      string  `json:"phone"`
+}
+
+// RefundPayload is the payload of the RefundSucceeded, RefundFailed and
+// RefundNotRequired events.
+type RefundPayload struct {
+	RefundID      string       `json:"refund_id"`
+	OrderID       string       `json:"order_id"`
+	Reason        string       `json:"reason"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	TransactionID *string      `json:"transaction_id,omitempty"`
+	Error         *string      `json:"error,omitempty"`
+}
+
+// NewEvent builds an outbox row with the JSON encoded payload.
+func NewEvent(orderID uuid.UUID, eventType string, payload interface{}) (*models.OrderEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &models.OrderEvent{
+		OrderID:   orderID,
+		EventType: eventType,
+		Payload:   string(data),
+	}, nil
+}
+
+// NewOrderPlacedEvent builds the OrderPlaced event for a freshly created order.
+func NewOrderPlacedEvent(order *models.Order, items []models.OrderItem) (*models.OrderEvent, error) {
+	return NewEvent(order.ID, models.OrderEventPlaced, OrderPlacedPayload{
+		OrderID:      order.ID.String(),
+		CustomerID:   order.CustomerID.String(),
+		Status:       order.Status,
+		Currency:     order.Currency,
+		Subtotal:     order.Subtotal,
+		ShippingCost: order.ShippingCost,
+		TaxTotal:     order.TaxTotal,
+		GrandTotal:   order.GrandTotal(),
+		Items:        itemPayloads(items),
+	})
+}
+
+// NewOrderAmendedEvent builds the OrderAmended event for an order whose
+// lines were changed before payment.
+func NewOrderAmendedEvent(order *models.Order, items []models.OrderItem) (*models.OrderEvent, error) {
+	return NewEvent(order.ID, models.OrderEventAmended, OrderAmendedPayload{
+		OrderID:      order.ID.String(),
+		Currency:     order.Currency,
+		Subtotal:     order.Subtotal,
+		ShippingCost: order.ShippingCost,
+		TaxTotal:     order.TaxTotal,
+		GrandTotal:   order.GrandTotal(),
+		Items:        itemPayloads(items),
+	})
+}
+
+// NewOrderItemsCancelledEvent builds the OrderItemsCancelled event for the
+// quantities cancelled from an order.
+func NewOrderItemsCancelledEvent(order *models.Order, cancelled []models.OrderItem) (*models.OrderEvent, error) {
+	return NewEvent(order.ID, models.OrderEventItemsCancelled, OrderItemsCancelledPayload{
+		OrderID:      order.ID.String(),
+		Currency:     order.Currency,
+		Subtotal:     order.Subtotal,
+		ShippingCost: order.ShippingCost,
+		TaxTotal:     order.TaxTotal,
+		GrandTotal:   order.GrandTotal(),
+		Cancelled:    itemPayloads(cancelled),
+	})
+}
+
+// NewShippingAddressChangedEvent builds the ShippingAddressChanged event.
+func NewShippingAddressChangedEvent(orderID uuid.UUID, address models.Address) (*models.OrderEvent, error) {
+	return NewEvent(orderID, models.OrderEventShippingAddressChanged, ShippingAddressChangedPayload{
+		OrderID:    orderID.String(),
+		Recipient:  address.Recipient,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+		Phone:      address.Phone,
+	})
+}
+
+// NewRefundEvent builds the event announcing the outcome of a refund.
+func NewRefundEvent(refund *models.Refund) (*models.OrderEvent, error) {
+	eventType := models.OrderEventRefundSucceeded
+	switch refund.Status {
+	case models.RefundStatusFailed:
+		eventType = models.OrderEventRefundFailed
+	case models.RefundStatusNotRequired:
+		eventType = models.OrderEventRefundNotRequired
+	}
+
+	return NewEvent(refund.OrderID, eventType, RefundPayload{
+		RefundID:      refund.ID.String(),
+		OrderID:       refund.OrderID.String(),
+		Reason:        refund.Reason,
+		Amount:        refund.Amount,
+		Currency:      refund.Currency,
+		TransactionID: refund.TransactionID,
+		Error:         refund.LastError,
+	})
+}
+
+func itemPayloads(items []models.OrderItem) []ItemPayload {
+	payloads := make([]ItemPayload, len(items))
+	for i, item := range items {
+		payloads[i] = ItemPayload{
+			ItemID:    item.ID.String(),
+			ProductID: item.ProductID.String(),
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+	}
+	return payloads
+}
+
+// RegisterStateHooks makes the state machine write an outbox event in the
+// same transaction as every status change that has an event type.
+func RegisterStateHooks(sm statemachine.OrderStateMachine) {
+	for status, eventType := range statusEvents {
+		sm.OnEnter(status, func(tx *gorm.DB, event statemachine.Event) error {
+			orderID, err := uuid.Parse(event.OrderID)
+			if err != nil {
+				return errors.NewValidationError("order_id", "Invalid order ID")
+			}
+
+			orderEvent, err := NewEvent(orderID, eventType, StatusChangedPayload{
+				OrderID: event.OrderID,
+				From:    event.From,
+				To:      event.To,
+				Actor:   string(event.Actor),
+			})
+			if err != nil {
+				return err
+			}
+
+			return repositories.NewOrderEventRepository(tx).AddEvent(orderEvent)
+		})
+	}
+}
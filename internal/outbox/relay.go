@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+const maxRetryBackoff = time.Hour
+
+// publishLease is how long a claimed event is left to the relay that claimed
+// it before another relay may deliver it again.
+const publishLease = 5 * time.Minute
+
+var eventsDead = expvar.NewInt("outbox_events_dead")
+
+// Relay periodically publishes pending outbox events to a sink. Several
+// relays may run against the same database; each batch is claimed with
+// row locks and a lease so an event is handled by one relay at a time.
+type Relay struct {
+	unitOfWork  repositories.UnitOfWork
+	sink        Sink
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewRelay(unitOfWork repositories.UnitOfWork, sink Sink, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	return &Relay{
+		unitOfWork:  unitOfWork,
+		sink:        sink,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run relays events every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RelayOnce(ctx); err != nil {
+				utils.Error("Failed to relay order events", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending events and returns how many were
+// delivered. The batch is claimed in one transaction and published outside
+// it, so no locks are held while the sink is called. Failed deliveries are
+// rescheduled with exponential backoff; an event that fails its last allowed
+// attempt is marked dead.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var events []models.OrderEvent
+	err := r.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		var err error
+		events, err = repos.OrderEvents.ClaimPending(r.batchSize, time.Now().Add(publishLease))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range events {
+		var publishErr error
+		if event.Attempts >= r.maxAttempts {
+			publishErr = fmt.Errorf("gave up after %d delivery attempts", event.Attempts)
+		} else {
+			publishErr = r.sink.Publish(ctx, newMessage(event))
+		}
+
+		if err := r.record(event, publishErr); err != nil {
+			return published, err
+		}
+		if publishErr == nil {
+			published++
+		}
+	}
+
+	return published, nil
+}
+
+// record stores the outcome of a delivery attempt.
+func (r *Relay) record(event models.OrderEvent, publishErr error) error {
+	eventID := event.ID.String()
+	attempts := event.Attempts + 1
+
+	return r.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if publishErr == nil {
+			return repos.OrderEvents.MarkPublished(eventID)
+		}
+
+		if attempts < r.maxAttempts {
+			utils.Warn("Failed to publish order event", map[string]interface{}{
+				"event_id":   eventID,
+				"event_type": event.EventType,
+				"attempts":   attempts,
+				"error":      publishErr.Error(),
+			})
+			return repos.OrderEvents.MarkFailed(eventID, publishErr, time.Now().Add(r.backoff(attempts)))
+		}
+
+		eventsDead.Add(1)
+		utils.Warn("Giving up on order event", map[string]interface{}{
+			"event_id":   eventID,
+			"order_id":   event.OrderID.String(),
+			"event_type": event.EventType,
+			"attempts":   attempts,
+			"error":      publishErr.Error(),
+		})
+		return repos.OrderEvents.MarkDead(eventID, publishErr)
+	})
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff := r.interval
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
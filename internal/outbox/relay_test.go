@@ -0,0 +1,290 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// memEvents is an outbox table in memory. inTx is set while a transaction
+// is open.
+type memEvents struct {
+	repositories.OrderEventRepository
+	events []models.OrderEvent
+	inTx   bool
+}
+
+func (r *memEvents) add(t *testing.T, eventType string, payload interface{}) models.OrderEvent {
+	t.Helper()
+
+	event, err := NewEvent(uuid.New(), eventType, payload)
+	if err != nil {
+		t.Fatalf("NewEvent: %v", err)
+	}
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+	r.events = append(r.events, *event)
+	return *event
+}
+
+func (r *memEvents) ClaimPending(limit int, leaseUntil time.Time) ([]models.OrderEvent, error) {
+	var events []models.OrderEvent
+	for i := range r.events {
+		event := &r.events[i]
+		if len(events) < limit && event.PublishedAt == nil && event.DeadAt == nil && !event.NextAttemptAt.After(time.Now()) {
+			events = append(events, *event)
+			event.NextAttemptAt = leaseUntil
+		}
+	}
+	return events, nil
+}
+
+func (r *memEvents) MarkPublished(eventID string) error {
+	event := r.find(eventID)
+	now := time.Now()
+	event.PublishedAt = &now
+	event.Attempts++
+	event.LastError = nil
+	return nil
+}
+
+func (r *memEvents) MarkFailed(eventID string, cause error, nextAttemptAt time.Time) error {
+	event := r.find(eventID)
+	reason := cause.Error()
+	event.Attempts++
+	event.LastError = &reason
+	event.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (r *memEvents) MarkDead(eventID string, cause error) error {
+	event := r.find(eventID)
+	reason := cause.Error()
+	now := time.Now()
+	event.Attempts++
+	event.LastError = &reason
+	event.DeadAt = &now
+	return nil
+}
+
+func (r *memEvents) find(eventID string) *models.OrderEvent {
+	for i := range r.events {
+		if r.events[i].ID.String() == eventID {
+			return &r.events[i]
+		}
+	}
+	return nil
+}
+
+type memUnitOfWork struct {
+	events *memEvents
+}
+
+func (u *memUnitOfWork) WithTx(fn func(repos repositories.TxRepositories) error) error {
+	u.events.inTx = true
+	defer func() { u.events.inTx = false }()
+	return fn(repositories.TxRepositories{OrderEvents: u.events})
+}
+
+// txCheckingSink fails any publish made while a transaction is open.
+type txCheckingSink struct {
+	*MemorySink
+	events *memEvents
+}
+
+func (s *txCheckingSink) Publish(ctx context.Context, msg Message) error {
+	if s.events.inTx {
+		return stderrors.New("published inside a transaction")
+	}
+	return s.MemorySink.Publish(ctx, msg)
+}
+
+func TestRelayOncePublishesPendingEvents(t *testing.T) {
+	events := &memEvents{}
+	placed := events.add(t, models.OrderEventPlaced, OrderPlacedPayload{Status: models.OrderStatusPaymentPending})
+	paid := events.add(t, models.OrderEventPaid, StatusChangedPayload{From: models.OrderStatusPaymentPending, To: models.OrderStatusPaid})
+
+	sink := NewMemorySink()
+	relay := NewRelay(&memUnitOfWork{events}, &txCheckingSink{sink, events}, time.Second, 10, 5)
+
+	published, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if published != 2 {
+		t.Fatalf("published %d events, want 2", published)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("sink received %d messages, want 2", len(messages))
+	}
+	for i, want := range []models.OrderEvent{placed, paid} {
+		msg := messages[i]
+		if msg.ID != want.ID.String() || msg.OrderID != want.OrderID.String() || msg.EventType != want.EventType {
+			t.Errorf("message %d = %+v, want event %s %s", i, msg, want.ID, want.EventType)
+		}
+		if string(msg.Payload) != want.Payload {
+			t.Errorf("message %d payload = %s, want %s", i, msg.Payload, want.Payload)
+		}
+	}
+
+	published, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("second RelayOnce: %v", err)
+	}
+	if published != 0 || len(sink.Messages()) != 2 {
+		t.Errorf("second RelayOnce published %d events again", published)
+	}
+}
+
+func TestRelayOnceReschedulesFailedDeliveries(t *testing.T) {
+	events := &memEvents{}
+	event := events.add(t, models.OrderEventPaid, StatusChangedPayload{})
+
+	sink := NewMemorySink()
+	sink.Err = stderrors.New("broker unavailable")
+	relay := NewRelay(&memUnitOfWork{events}, sink, time.Minute, 10, 5)
+
+	published, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if published != 0 {
+		t.Fatalf("published %d events, want 0", published)
+	}
+
+	failed := events.find(event.ID.String())
+	if failed.PublishedAt != nil || failed.Attempts != 1 || failed.LastError == nil || *failed.LastError != "broker unavailable" {
+		t.Fatalf("failed event = %+v, want one recorded attempt", failed)
+	}
+	if !failed.NextAttemptAt.After(time.Now()) {
+		t.Errorf("next attempt at %s, want it in the future", failed.NextAttemptAt)
+	}
+
+	// Not due yet, so the next run leaves it alone even once the sink works.
+	sink.Err = nil
+	if published, _ := relay.RelayOnce(context.Background()); published != 0 {
+		t.Errorf("published %d events before the retry was due", published)
+	}
+
+	failed.NextAttemptAt = time.Now()
+	if published, _ := relay.RelayOnce(context.Background()); published != 1 {
+		t.Errorf("published %d events once the retry was due, want 1", published)
+	}
+	if failed.PublishedAt == nil || failed.Attempts != 2 {
+		t.Errorf("retried event = %+v, want it published on the second attempt", failed)
+	}
+}
+
+func TestRelayOnceMarksExhaustedEventsDead(t *testing.T) {
+	events := &memEvents{}
+	event := events.add(t, models.OrderEventPaid, StatusChangedPayload{})
+
+	sink := NewMemorySink()
+	sink.Err = stderrors.New("broker unavailable")
+	relay := NewRelay(&memUnitOfWork{events}, sink, time.Minute, 10, 2)
+	dead := eventsDead.Value()
+
+	stored := events.find(event.ID.String())
+	for attempt := 1; attempt <= 2; attempt++ {
+		stored.NextAttemptAt = time.Now()
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatalf("RelayOnce attempt %d: %v", attempt, err)
+		}
+	}
+
+	if stored.DeadAt == nil || stored.Attempts != 2 || stored.PublishedAt != nil {
+		t.Fatalf("event = %+v, want it dead after 2 attempts", stored)
+	}
+	if got := eventsDead.Value() - dead; got != 1 {
+		t.Errorf("outbox_events_dead grew by %d, want 1", got)
+	}
+
+	// A dead event is never claimed again.
+	sink.Err = nil
+	stored.NextAttemptAt = time.Now()
+	if published, _ := relay.RelayOnce(context.Background()); published != 0 || len(sink.Messages()) != 0 {
+		t.Errorf("published %d events after the event was marked dead", published)
+	}
+}
+
+func TestRelayOnceMarksEventsPastTheLimitDead(t *testing.T) {
+	events := &memEvents{}
+	event := events.add(t, models.OrderEventPaid, StatusChangedPayload{})
+	stored := events.find(event.ID.String())
+	stored.Attempts = 5
+
+	sink := NewMemorySink()
+	relay := NewRelay(&memUnitOfWork{events}, sink, time.Minute, 10, 3)
+
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if stored.DeadAt == nil || len(sink.Messages()) != 0 {
+		t.Errorf("event = %+v, sink got %d messages; want it dead and unpublished", stored, len(sink.Messages()))
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, nil, time.Minute, 10, 5)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{20, maxRetryBackoff},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestNewOrderPlacedEventIncludesTotals(t *testing.T) {
+	order := &models.Order{
+		ID:           uuid.New(),
+		CustomerID:   uuid.New(),
+		Status:       models.OrderStatusPaymentPending,
+		Currency:     "CAD",
+		Subtotal:     2000,
+		ShippingCost: 500,
+		TaxTotal:     325,
+	}
+	items := []models.OrderItem{{ID: uuid.New(), ProductID: uuid.New(), Quantity: 2, Price: 1000}}
+
+	event, err := NewOrderPlacedEvent(order, items)
+	if err != nil {
+		t.Fatalf("NewOrderPlacedEvent: %v", err)
+	}
+
+	var payload OrderPlacedPayload
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.TaxTotal != 325 || payload.GrandTotal != 2825 {
+		t.Errorf("tax_total = %d, grand_total = %d, want 325 and 2825", payload.TaxTotal, payload.GrandTotal)
+	}
+	if len(payload.Items) != 1 || payload.Items[0].ItemID != items[0].ID.String() {
+		t.Errorf("items = %+v, want the placed line", payload.Items)
+	}
+}
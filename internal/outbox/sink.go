@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+)
+
+// Message is the envelope handed to a sink.
+type Message struct {
+	ID         string          `json:"id"`
+	OrderID    string          `json:"order_id"`
+	EventType  string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Sink delivers order events to the outside world. Delivery is at least
+// once, so a sink may see the same message ID more than once.
+type Sink interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+func newMessage(event models.OrderEvent) Message {
+	return Message{
+		ID:         event.ID.String(),
+		OrderID:    event.OrderID.String(),
+		EventType:  event.EventType,
+		Payload:    json.RawMessage(event.Payload),
+		OccurredAt: event.CreatedAt,
+	}
+}
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink that writes every message as a JSON line to w,
+// e.g. os.Stdout or an append-only file.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// MemorySink keeps published messages in memory. It is meant for tests.
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+	// Err, when set, is returned from Publish instead of recording the message.
+	Err error
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Publish(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message published so far.
+func (s *MemorySink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
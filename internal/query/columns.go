@@ -0,0 +1,99 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm/schema"
+)
+
+// Type is how filter values for a column are parsed.
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeUUID
+	TypeTime
+	TypeNumber
+	TypeMoney
+	TypeBool
+)
+
+// Column describes a column a list query may filter and sort on.
+type Column struct {
+	Type Type
+	// Nullable columns cannot be used as cursor sort keys: NULLs do not
+	// compare in a keyset condition.
+	Nullable bool
+}
+
+// Columns is the whitelist of columns a list query may filter and sort on.
+type Columns map[string]Column
+
+var (
+	uuidType  = reflect.TypeOf(uuid.UUID{})
+	timeType  = reflect.TypeOf(time.Time{})
+	moneyType = reflect.TypeOf(money.Amount(0))
+)
+
+// ColumnsOf returns every column of a GORM model, including the columns of
+// embedded structs, with its type. Associations are not columns. It panics
+// if the model cannot be parsed, so it is meant to initialise package
+// variables.
+func ColumnsOf(model interface{}) Columns {
+	s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(fmt.Sprintf("query: cannot parse model %T: %v", model, err))
+	}
+
+	columns := make(Columns, len(s.DBNames))
+	for _, name := range s.DBNames {
+		fieldType := s.FieldsByDBName[name].FieldType
+		columns[name] = Column{
+			Type:     typeOf(fieldType),
+			Nullable: fieldType.Kind() == reflect.Ptr,
+		}
+	}
+	return columns
+}
+
+// Only returns the subset of the columns with the given names.
+func (c Columns) Only(names ...string) Columns {
+	subset := make(Columns, len(names))
+	for _, name := range names {
+		if column, ok := c[name]; ok {
+			subset[name] = column
+		}
+	}
+	return subset
+}
+
+func typeOf(fieldType reflect.Type) Type {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	switch fieldType {
+	case uuidType:
+		return TypeUUID
+	case timeType:
+		return TypeTime
+	case moneyType:
+		return TypeMoney
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.Bool:
+		return TypeBool
+	default:
+		return TypeString
+	}
+}
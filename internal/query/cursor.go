@@ -0,0 +1,84 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// idColumn breaks ties between rows with the same sort value so every row
+// has a unique position in a cursor-paged list.
+const idColumn = "id"
+
+// cursor is the position after the last row of a page: the sort it was
+// issued for and the sort value and ID of that row. Clients treat the
+// encoded form as opaque.
+type cursor struct {
+	SortBy    string `json:"s,omitempty"`
+	SortOrder string `json:"o"`
+	Value     string `json:"v,omitempty"`
+	ID        string `json:"id"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errors.NewBadRequestError("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return c, errors.NewBadRequestError("invalid cursor")
+	}
+
+	return c, nil
+}
+
+// keyset returns the condition selecting the rows after the cursor in the
+// given sort, e.g. "(created_at, id) < (?, ?)" for a descending sort.
+func (c cursor) keyset(columns Columns) (string, []interface{}, error) {
+	comparison := ">"
+	if c.SortOrder == "desc" {
+		comparison = "<"
+	}
+
+	id, err := parseValue(idColumn, columns[idColumn].Type, c.ID)
+	if err != nil {
+		return "", nil, errors.NewBadRequestError("invalid cursor")
+	}
+
+	if c.SortBy == "" || c.SortBy == idColumn {
+		return idColumn + " " + comparison + " ?", []interface{}{id}, nil
+	}
+
+	value, err := parseValue(c.SortBy, columns[c.SortBy].Type, c.Value)
+	if err != nil {
+		return "", nil, errors.NewBadRequestError("invalid cursor")
+	}
+
+	return "(" + c.SortBy + ", " + idColumn + ") " + comparison + " (?, ?)", []interface{}{value, id}, nil
+}
+
+// formatValue writes a sort value so that parseValue reads back exactly the
+// same value. Timestamps keep their full precision.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case uuid.UUID:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
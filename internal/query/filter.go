@@ -0,0 +1,205 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// operators maps the operators accepted in filters to SQL.
+var operators = map[string]string{
+	"eq":      "=",           // Equal to
+	"neq":     "!=",          // Not equal to
+	"gt":      ">",           // Greater than
+	"gte":     ">=",          // Greater than or equal to
+	"lt":      "<",           // Less than
+	"lte":     "<=",          // Less than or equal to
+	"like":    "LIKE",        // LIKE for pattern matching
+	"ilike":   "ILIKE",       // Case insensitive LIKE (for PostgreSQL)
+	"in":      "IN",          // IN for multiple values
+	"null":    "IS NULL",     // IS NULL check
+	"notnull": "IS NOT NULL", // IS NOT NULL check
+}
+
+// Limits on the size of a filter expression so a request cannot build an
+// arbitrarily expensive query.
+const (
+	maxFilterDepth      = 4
+	maxFilterConditions = 32
+)
+
+// compileFilter turns a filter expression into a SQL condition and its
+// arguments. Only whitelisted columns and operators are written into the
+// SQL; every value is parsed for its column's type and passed as a
+// parameter. An empty expression compiles to an empty condition.
+func compileFilter(expr models.FilterExpression, columns Columns) (string, []interface{}, error) {
+	c := &filterCompiler{columns: columns}
+
+	sql, err := c.group(expr, 1)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sql, c.args, nil
+}
+
+type filterCompiler struct {
+	columns    Columns
+	args       []interface{}
+	conditions int
+}
+
+func (c *filterCompiler) group(expr models.FilterExpression, depth int) (string, error) {
+	if depth > maxFilterDepth {
+		return "", errors.NewBadRequestError(fmt.Sprintf("filter groups can be nested at most %d deep", maxFilterDepth))
+	}
+
+	var joiner string
+	switch strings.ToLower(expr.Operator) {
+	case "", models.FilterAnd:
+		joiner = " AND "
+	case models.FilterOr:
+		joiner = " OR "
+	default:
+		return "", errors.NewBadRequestError("invalid filter group operator: " + expr.Operator)
+	}
+
+	parts := make([]string, 0, len(expr.Conditions)+len(expr.Groups))
+	for _, filter := range expr.Conditions {
+		sql, err := c.condition(filter)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, sql)
+	}
+	for _, group := range expr.Groups {
+		sql, err := c.group(group, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if sql != "" {
+			parts = append(parts, sql)
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return "", nil
+	case 1:
+		return parts[0], nil
+	default:
+		return "(" + strings.Join(parts, joiner) + ")", nil
+	}
+}
+
+func (c *filterCompiler) condition(filter models.Filter) (string, error) {
+	c.conditions++
+	if c.conditions > maxFilterConditions {
+		return "", errors.NewBadRequestError(fmt.Sprintf("a filter can have at most %d conditions", maxFilterConditions))
+	}
+
+	column, allowed := c.columns[filter.Column]
+	if !allowed {
+		return "", errors.NewBadRequestError("invalid filter column: " + filter.Column)
+	}
+
+	op, allowed := operators[filter.Operator]
+	if !allowed {
+		return "", errors.NewBadRequestError("invalid filter operator: " + filter.Operator)
+	}
+
+	switch filter.Operator {
+	case "like", "ilike":
+		if column.Type != TypeString {
+			return "", errors.NewBadRequestError(fmt.Sprintf("filter operator %s needs a text column, '%s' is not one", filter.Operator, filter.Column))
+		}
+		c.args = append(c.args, "%"+filter.Value+"%")
+		return filter.Column + " " + op + " ?", nil
+	case "in":
+		rawValues := strings.Split(filter.Value, ",")
+		values := make([]interface{}, len(rawValues))
+		for i, raw := range rawValues {
+			value, err := parseValue(filter.Column, column.Type, strings.TrimSpace(raw))
+			if err != nil {
+				return "", err
+			}
+			values[i] = value
+		}
+		c.args = append(c.args, values)
+		return filter.Column + " " + op + " (?)", nil
+	case "null", "notnull":
+		return filter.Column + " " + op, nil
+	default:
+		value, err := parseValue(filter.Column, column.Type, filter.Value)
+		if err != nil {
+			return "", err
+		}
+		c.args = append(c.args, value)
+		return filter.Column + " " + op + " ?", nil
+	}
+}
+
+// parseValue converts a filter value to the type of its column, so a
+// malformed value is rejected as a bad request rather than failing in the
+// database.
+func parseValue(column string, columnType Type, raw string) (interface{}, error) {
+	invalid := func(expected string) error {
+		return errors.NewBadRequestError(fmt.Sprintf("invalid filter value for column '%s': expected %s", column, expected))
+	}
+
+	switch columnType {
+	case TypeUUID:
+		value, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, invalid("a UUID")
+		}
+		return value, nil
+	case TypeTime:
+		value, ok := parseTime(raw)
+		if !ok {
+			return nil, invalid("a timestamp (RFC 3339, YYYY-MM-DD or Unix milliseconds)")
+		}
+		return value, nil
+	case TypeNumber:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, invalid("a number")
+		}
+		return value, nil
+	case TypeMoney:
+		value, err := money.Parse(raw)
+		if err != nil {
+			return nil, invalid("an amount")
+		}
+		return value, nil
+	case TypeBool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, invalid("true or false")
+		}
+		return value, nil
+	default:
+		return raw, nil
+	}
+}
+
+// parseTime accepts the timestamp formats used by the API: Unix
+// milliseconds like the proto timestamps, RFC 3339 and plain dates.
+func parseTime(raw string) (time.Time, bool) {
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(millis), true
+	}
+	if value, err := time.Parse(time.RFC3339, raw); err == nil {
+		return value, true
+	}
+	if value, err := time.Parse(time.DateOnly, raw); err == nil {
+		return value, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Spec is what a list request asks for: which rows, in which order and
+// which page of them. A page is either selected by number, starting at 1,
+// or by a Cursor returned with the previous page; a cursor takes
+// precedence. A Limit of 0 returns every row.
+type Spec struct {
+	Filter    models.FilterExpression
+	SortBy    string
+	SortOrder string
+	Page      int32
+	Limit     int32
+	Cursor    string
+}
+
+// Find applies the spec to db, which must already be scoped to the model T
+// and to any conditions the caller imposes, and loads the requested page.
+// It returns the rows, the number of rows matching the filter on all pages
+// and a cursor for the next page, which is empty on the last page or when
+// the list is sorted by a nullable column. Filter and sort columns must be
+// in columns; anything else is a BadRequestError.
+//
+// Rows are ordered by ID after the sort column, so pages do not overlap or
+// skip rows that share a sort value. The scopes are applied to the page query
+// only, not to the count, e.g. to preload associations.
+func Find[T any](db *gorm.DB, columns Columns, spec Spec, scopes ...func(*gorm.DB) *gorm.DB) ([]T, int64, string, error) {
+	condition, args, err := compileFilter(spec.Filter, columns)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if spec.SortBy != "" {
+		if _, allowed := columns[spec.SortBy]; !allowed {
+			return nil, 0, "", errors.NewBadRequestError("invalid sort column: " + spec.SortBy)
+		}
+	}
+
+	sortOrder := strings.ToLower(spec.SortOrder)
+	if sortOrder != "asc" && sortOrder != "desc" {
+		sortOrder = "asc"
+	}
+
+	keysetPaging := !columns[spec.SortBy].Nullable
+
+	var after cursor
+	if spec.Cursor != "" {
+		if spec.Limit <= 0 {
+			return nil, 0, "", errors.NewBadRequestError("a cursor needs a limit")
+		}
+		if after, err = decodeCursor(spec.Cursor); err != nil {
+			return nil, 0, "", err
+		}
+		if !keysetPaging || after.SortBy != spec.SortBy || after.SortOrder != sortOrder {
+			return nil, 0, "", errors.NewBadRequestError("cursor does not match the requested sort")
+		}
+	}
+
+	if condition != "" {
+		db = db.Where(condition, args...)
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, "", errors.NewInternalError(err)
+	}
+
+	db = db.Scopes(scopes...)
+
+	if spec.SortBy != "" {
+		db = db.Order(spec.SortBy + " " + sortOrder)
+	}
+
+	if spec.Limit <= 0 {
+		var rows []T
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, 0, "", errors.NewInternalError(err)
+		}
+		return rows, total, "", nil
+	}
+
+	if spec.SortBy != idColumn {
+		db = db.Order(idColumn + " " + sortOrder)
+	}
+
+	if spec.Cursor != "" {
+		condition, args, err := after.keyset(columns)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		db = db.Where(condition, args...)
+	} else {
+		offset := max(int((spec.Page-1)*spec.Limit), 0)
+		db = db.Offset(offset)
+	}
+
+	// One extra row tells whether there is a next page.
+	var rows []T
+	result := db.Limit(int(spec.Limit) + 1).Find(&rows)
+	if result.Error != nil {
+		return nil, 0, "", errors.NewInternalError(result.Error)
+	}
+
+	if len(rows) <= int(spec.Limit) {
+		return rows, total, "", nil
+	}
+	rows = rows[:spec.Limit]
+
+	if !keysetPaging {
+		return rows, total, "", nil
+	}
+
+	next, err := cursorAfter(result.Statement, &rows[len(rows)-1], spec.SortBy, sortOrder)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	return rows, total, next.encode(), nil
+}
+
+// cursorAfter builds the cursor positioned after row, reading its sort
+// value and ID through the schema the query was run with.
+func cursorAfter(statement *gorm.Statement, row interface{}, sortBy, sortOrder string) (cursor, error) {
+	value := reflect.ValueOf(row)
+
+	read := func(column string) (string, error) {
+		field := statement.Schema.LookUpField(column)
+		if field == nil {
+			return "", errors.NewInternalError(fmt.Errorf("%s has no column %s", statement.Schema.Name, column))
+		}
+		v, _ := field.ValueOf(statement.Context, value)
+		return formatValue(v), nil
+	}
+
+	id, err := read(idColumn)
+	if err != nil {
+		return cursor{}, err
+	}
+
+	c := cursor{SortBy: sortBy, SortOrder: sortOrder, ID: id}
+	if sortBy != "" && sortBy != idColumn {
+		if c.Value, err = read(sortBy); err != nil {
+			return cursor{}, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,24 @@
+package rbac
+
+import (
+	"context"
+	"path"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor rejects calls to RPCs the caller's roles are not
+// granted with codes.PermissionDenied. It must run after the authentication
+// interceptor. Which orders the caller may touch is checked by the service.
+func UnaryServerInterceptor(policy *Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !policy.Allows(auth.FromContext(ctx), path.Base(info.FullMethod)) {
+			return nil, status.Error(codes.PermissionDenied, "access denied")
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,333 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+)
+
+// RPC names as they appear in the policy.
+const (
+	RPCPlaceOrder               = "PlaceOrder"
+	RPCGetOrder                 = "GetOrder"
+	RPCListCustomersOrders      = "ListCustomersOrders"
+	RPCListAllOrders            = "ListAllOrders"
+	RPCUpdateOrderStatus        = "UpdateOrderStatus"
+	RPCGenerateNewPaymentUrl    = "GenerateNewPaymentUrl"
+	RPCReviewPrescription       = "ReviewPrescription"
+	RPCListPendingPrescriptions = "ListPendingPrescriptions"
+	RPCQuoteShipping            = "QuoteShipping"
+	RPCUpdateShippingAddress    = "UpdateShippingAddress"
+	RPCCreateShipment           = "CreateShipment"
+	RPCRecordDeliveryEvent      = "RecordDeliveryEvent"
+	RPCRequestReturn            = "RequestReturn"
+	RPCApproveReturn            = "ApproveReturn"
+	RPCListRefunds              = "ListRefunds"
+	RPCRetryRefund              = "RetryRefund"
+	RPCCancelOrderItems         = "CancelOrderItems"
+	RPCAmendOrder               = "AmendOrder"
+	RPCGetOrderHistory          = "GetOrderHistory"
+)
+
+// Scopes of an RPC grant.
+const (
+	// ScopeOwn limits the role to orders placed by the caller.
+	ScopeOwn = "own"
+	// ScopeAny lets the role act on every order.
+	ScopeAny = "any"
+)
+
+// wildcard matches every RPC in a role's grants.
+const wildcard = "*"
+
+// Grants is what one role may do.
+type Grants struct {
+	// RPCs maps an RPC name, or "*" for every RPC, to the scope it is
+	// granted with.
+	RPCs map[string]string `json:"rpcs"`
+	// Transitions lists the order status changes the role may request, as
+	// "from->to".
+	Transitions []string `json:"transitions"`
+}
+
+// Policy maps every role and every calling service to its grants. A caller
+// holds the union of the grants of its roles; a service caller also holds the
+// grants of its service identity. Service grants are only ever matched against
+// the service claim, so a user token listing a service name as a role gets
+// nothing from it.
+type Policy struct {
+	Roles    map[string]Grants `json:"roles"`
+	Services map[string]Grants `json:"services"`
+
+	roleTransitions    map[string]map[transition]bool
+	serviceTransitions map[string]map[transition]bool
+}
+
+type transition struct {
+	from string
+	to   string
+}
+
+// DefaultPolicy is the policy used when no policy file is configured.
+func DefaultPolicy() *Policy {
+	cancellations := []string{
+		"pending->cancelled",
+		"payment_pending->cancelled",
+		"paid->cancelled",
+		"approved->cancelled",
+	}
+
+	policy := &Policy{
+		Roles: map[string]Grants{
+			auth.RoleCustomer: {
+				RPCs: map[string]string{
+					RPCPlaceOrder:            ScopeOwn,
+					RPCGetOrder:              ScopeOwn,
+					RPCListCustomersOrders:   ScopeOwn,
+					RPCUpdateOrderStatus:     ScopeOwn,
+					RPCGenerateNewPaymentUrl: ScopeOwn,
+					RPCQuoteShipping:         ScopeOwn,
+					RPCRequestReturn:         ScopeOwn,
+					RPCCancelOrderItems:      ScopeOwn,
+					RPCAmendOrder:            ScopeOwn,
+					RPCGetOrderHistory:       ScopeOwn,
+				},
+				Transitions: cancellations,
+			},
+			auth.RolePharmacist: {
+				RPCs: map[string]string{
+					RPCGetOrder:                 ScopeAny,
+					RPCReviewPrescription:       ScopeAny,
+					RPCListPendingPrescriptions: ScopeAny,
+					RPCGetOrderHistory:          ScopeAny,
+				},
+				Transitions: []string{"paid->approved", "paid->cancelled"},
+			},
+			auth.RoleSupport: {
+				RPCs: map[string]string{
+					RPCGetOrder:              ScopeAny,
+					RPCListCustomersOrders:   ScopeAny,
+					RPCListAllOrders:         ScopeAny,
+					RPCUpdateOrderStatus:     ScopeAny,
+					RPCGenerateNewPaymentUrl: ScopeAny,
+					RPCQuoteShipping:         ScopeAny,
+					RPCUpdateShippingAddress: ScopeAny,
+					RPCListRefunds:           ScopeAny,
+					RPCRetryRefund:           ScopeAny,
+					RPCGetOrderHistory:       ScopeAny,
+				},
+				Transitions: cancellations,
+			},
+			auth.RoleWarehouse: {
+				RPCs: map[string]string{
+					RPCGetOrder:            ScopeAny,
+					RPCListAllOrders:       ScopeAny,
+					RPCUpdateOrderStatus:   ScopeAny,
+					RPCCreateShipment:      ScopeAny,
+					RPCRecordDeliveryEvent: ScopeAny,
+					RPCGetOrderHistory:     ScopeAny,
+				},
+				Transitions: []string{"approved->shipped", "shipped->completed"},
+			},
+			auth.RoleAdmin: {
+				RPCs: map[string]string{
+					RPCGetOrder:                 ScopeAny,
+					RPCListCustomersOrders:      ScopeAny,
+					RPCListAllOrders:            ScopeAny,
+					RPCUpdateOrderStatus:        ScopeAny,
+					RPCGenerateNewPaymentUrl:    ScopeAny,
+					RPCListPendingPrescriptions: ScopeAny,
+					RPCQuoteShipping:            ScopeAny,
+					RPCUpdateShippingAddress:    ScopeAny,
+					RPCCreateShipment:           ScopeAny,
+					RPCRecordDeliveryEvent:      ScopeAny,
+					RPCApproveReturn:            ScopeAny,
+					RPCListRefunds:              ScopeAny,
+					RPCRetryRefund:              ScopeAny,
+					RPCCancelOrderItems:         ScopeAny,
+					RPCGetOrderHistory:          ScopeAny,
+				},
+				Transitions: append([]string{
+					"pending->paid",
+					"payment_pending->paid",
+					"paid->approved",
+					"approved->shipped",
+					"shipped->completed",
+				}, cancellations...),
+			},
+		},
+		Services: map[string]Grants{
+			auth.ServicePayment: {
+				RPCs: map[string]string{
+					RPCUpdateOrderStatus: ScopeAny,
+				},
+				Transitions: []string{"pending->paid", "payment_pending->paid"},
+			},
+		},
+	}
+
+	if err := policy.compile(); err != nil {
+		panic(err)
+	}
+
+	return policy
+}
+
+// LoadPolicy reads the policy from a JSON file. An empty path returns the
+// default policy.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse access policy: %w", err)
+	}
+
+	if err := policy.compile(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// compile validates the grants and indexes the transitions.
+func (p *Policy) compile() error {
+	if len(p.Roles) == 0 {
+		return fmt.Errorf("access policy defines no roles")
+	}
+
+	var err error
+	if p.roleTransitions, err = compileGrants("role", p.Roles); err != nil {
+		return err
+	}
+	if p.serviceTransitions, err = compileGrants("service", p.Services); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// compileGrants validates the grants of every role or service, named by kind
+// in errors, and indexes their transitions.
+func compileGrants(kind string, byName map[string]Grants) (map[string]map[transition]bool, error) {
+	statuses := map[string]bool{
+		models.OrderStatusPending:        true,
+		models.OrderStatusPaymentPending: true,
+		models.OrderStatusPaid:           true,
+		models.OrderStatusApproved:       true,
+		models.OrderStatusShipped:        true,
+		models.OrderStatusCompleted:      true,
+		models.OrderStatusCancelled:      true,
+		models.OrderStatusFailed:         true,
+	}
+
+	transitions := make(map[string]map[transition]bool, len(byName))
+	for name, grants := range byName {
+		for rpc, scope := range grants.RPCs {
+			if scope != ScopeOwn && scope != ScopeAny {
+				return nil, fmt.Errorf("%s '%s' grants %s with unknown scope '%s'", kind, name, rpc, scope)
+			}
+		}
+
+		transitions[name] = make(map[transition]bool, len(grants.Transitions))
+		for _, t := range grants.Transitions {
+			from, to, ok := strings.Cut(t, "->")
+			if !ok || !statuses[from] || !statuses[to] {
+				return nil, fmt.Errorf("%s '%s' has invalid transition '%s'", kind, name, t)
+			}
+			transitions[name][transition{from, to}] = true
+		}
+	}
+
+	return transitions, nil
+}
+
+// Scope returns the widest scope the caller holds for the RPC, or "" when
+// the caller may not call it at all.
+func (p *Policy) Scope(caller *auth.Principal, rpc string) string {
+	scope := ""
+	for _, h := range p.holders(caller) {
+		granted, ok := h.grants.RPCs[rpc]
+		if !ok {
+			granted = h.grants.RPCs[wildcard]
+		}
+
+		switch granted {
+		case ScopeAny:
+			return ScopeAny
+		case ScopeOwn:
+			scope = ScopeOwn
+		}
+	}
+	return scope
+}
+
+// Allows reports whether the caller may call the RPC.
+func (p *Policy) Allows(caller *auth.Principal, rpc string) bool {
+	return p.Scope(caller, rpc) != ""
+}
+
+// CanAccessOrder reports whether the caller may use the RPC on an order, or
+// on the orders, of the given customer.
+func (p *Policy) CanAccessOrder(caller *auth.Principal, rpc, customerID string) bool {
+	switch p.Scope(caller, rpc) {
+	case ScopeAny:
+		return true
+	case ScopeOwn:
+		return caller.IsCustomer(customerID)
+	default:
+		return false
+	}
+}
+
+// TransitionRole returns a role, or the service identity, of the caller that
+// may move an order from one status to another.
+func (p *Policy) TransitionRole(caller *auth.Principal, from, to string) (string, bool) {
+	for _, h := range p.holders(caller) {
+		if h.transitions[transition{from, to}] {
+			return h.name, true
+		}
+	}
+	return "", false
+}
+
+// holder is a role or service identity of a caller that the policy grants
+// something to.
+type holder struct {
+	name        string
+	grants      Grants
+	transitions map[transition]bool
+}
+
+// holders returns the caller's granted roles followed by its service
+// identity. Roles are only looked up among the role grants and the service
+// claim only among the service grants.
+func (p *Policy) holders(caller *auth.Principal) []holder {
+	if caller == nil {
+		return nil
+	}
+
+	var holders []holder
+	for _, role := range caller.Roles {
+		if grants, ok := p.Roles[role]; ok {
+			holders = append(holders, holder{role, grants, p.roleTransitions[role]})
+		}
+	}
+	if caller.Service != "" {
+		if grants, ok := p.Services[caller.Service]; ok {
+			holders = append(holders, holder{caller.Service, grants, p.serviceTransitions[caller.Service]})
+		}
+	}
+	return holders
+}
@@ -0,0 +1,219 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+)
+
+const customerID = "8a0c6a5e-3f5b-4a3e-9d53-3c1f3c6a2b10"
+
+var (
+	customer   = &auth.Principal{Subject: customerID, Roles: []string{auth.RoleCustomer}}
+	other      = &auth.Principal{Subject: "c3a4d9b2-6f0e-4d71-8c1a-5b7e2f9d0a44", Roles: []string{auth.RoleCustomer}}
+	pharmacist = &auth.Principal{Subject: "pharmacist-1", Roles: []string{auth.RolePharmacist}}
+	support    = &auth.Principal{Subject: "support-1", Roles: []string{auth.RoleSupport}}
+	warehouse  = &auth.Principal{Subject: "warehouse-1", Roles: []string{auth.RoleWarehouse}}
+	admin      = &auth.Principal{Subject: "admin-1", Roles: []string{auth.RoleAdmin}}
+	payment    = &auth.Principal{Subject: "payment", Service: auth.ServicePayment}
+	// A user token listing a service name as a role must not get that
+	// service's grants.
+	fakeService = &auth.Principal{Subject: "user-1", Roles: []string{auth.ServicePayment}}
+	// A token naming the customer as a service must not act as that
+	// customer.
+	spoofed = &auth.Principal{Subject: customerID, Roles: []string{auth.RoleCustomer}, Service: "unknown_service"}
+)
+
+func TestDefaultPolicyScope(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		rpc    string
+		want   string
+	}{
+		{"customer places orders", customer, RPCPlaceOrder, ScopeOwn},
+		{"customer reads own orders", customer, RPCGetOrder, ScopeOwn},
+		{"customer amends own orders", customer, RPCAmendOrder, ScopeOwn},
+		{"customer cannot list all orders", customer, RPCListAllOrders, ""},
+		{"customer cannot approve returns", customer, RPCApproveReturn, ""},
+		{"customer cannot retry refunds", customer, RPCRetryRefund, ""},
+		{"pharmacist reads any order", pharmacist, RPCGetOrder, ScopeAny},
+		{"pharmacist reviews prescriptions", pharmacist, RPCReviewPrescription, ScopeAny},
+		{"pharmacist cannot create shipments", pharmacist, RPCCreateShipment, ""},
+		{"support lists all orders", support, RPCListAllOrders, ScopeAny},
+		{"support retries refunds", support, RPCRetryRefund, ScopeAny},
+		{"support cannot review prescriptions", support, RPCReviewPrescription, ""},
+		{"warehouse creates shipments", warehouse, RPCCreateShipment, ScopeAny},
+		{"warehouse cannot place orders", warehouse, RPCPlaceOrder, ""},
+		{"admin approves returns", admin, RPCApproveReturn, ScopeAny},
+		{"admin cancels items", admin, RPCCancelOrderItems, ScopeAny},
+		{"payment service updates status", payment, RPCUpdateOrderStatus, ScopeAny},
+		{"payment service cannot read orders", payment, RPCGetOrder, ""},
+		{"service name as a role", fakeService, RPCUpdateOrderStatus, ""},
+		{"anonymous caller", nil, RPCGetOrder, ""},
+		{"unknown role", &auth.Principal{Subject: "x", Roles: []string{"intern"}}, RPCGetOrder, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Scope(tt.caller, tt.rpc); got != tt.want {
+				t.Errorf("Scope(%s) = %q, want %q", tt.rpc, got, tt.want)
+			}
+			if got := policy.Allows(tt.caller, tt.rpc); got != (tt.want != "") {
+				t.Errorf("Allows(%s) = %t, want %t", tt.rpc, got, tt.want != "")
+			}
+		})
+	}
+}
+
+func TestDefaultPolicyCanAccessOrder(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		rpc    string
+		want   bool
+	}{
+		{"customer reads own order", customer, RPCGetOrder, true},
+		{"customer reads another customer's order", other, RPCGetOrder, false},
+		{"service token with a customer subject", spoofed, RPCGetOrder, false},
+		{"support reads any order", support, RPCGetOrder, true},
+		{"warehouse cannot amend orders", warehouse, RPCAmendOrder, false},
+		{"anonymous caller", nil, RPCGetOrder, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.CanAccessOrder(tt.caller, tt.rpc, customerID); got != tt.want {
+				t.Errorf("CanAccessOrder(%s) = %t, want %t", tt.rpc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPolicyTransitionRole(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		name     string
+		caller   *auth.Principal
+		from, to string
+		wantRole string
+	}{
+		{"customer cancels unpaid order", customer, models.OrderStatusPaymentPending, models.OrderStatusCancelled, auth.RoleCustomer},
+		{"customer cancels paid order", customer, models.OrderStatusPaid, models.OrderStatusCancelled, auth.RoleCustomer},
+		{"customer cannot ship", customer, models.OrderStatusApproved, models.OrderStatusShipped, ""},
+		{"customer cannot pay", customer, models.OrderStatusPaymentPending, models.OrderStatusPaid, ""},
+		{"pharmacist approves paid order", pharmacist, models.OrderStatusPaid, models.OrderStatusApproved, auth.RolePharmacist},
+		{"pharmacist cannot cancel approved order", pharmacist, models.OrderStatusApproved, models.OrderStatusCancelled, ""},
+		{"support cannot approve", support, models.OrderStatusPaid, models.OrderStatusApproved, ""},
+		{"warehouse ships approved order", warehouse, models.OrderStatusApproved, models.OrderStatusShipped, auth.RoleWarehouse},
+		{"warehouse completes shipped order", warehouse, models.OrderStatusShipped, models.OrderStatusCompleted, auth.RoleWarehouse},
+		{"warehouse cannot cancel", warehouse, models.OrderStatusPaid, models.OrderStatusCancelled, ""},
+		{"admin marks order paid", admin, models.OrderStatusPaymentPending, models.OrderStatusPaid, auth.RoleAdmin},
+		{"admin ships", admin, models.OrderStatusApproved, models.OrderStatusShipped, auth.RoleAdmin},
+		{"payment service marks order paid", payment, models.OrderStatusPaymentPending, models.OrderStatusPaid, auth.ServicePayment},
+		{"payment service cannot cancel", payment, models.OrderStatusPaid, models.OrderStatusCancelled, ""},
+		{"service name as a role cannot pay", fakeService, models.OrderStatusPaymentPending, models.OrderStatusPaid, ""},
+		{"service with a customer role", &auth.Principal{Subject: customerID, Roles: []string{auth.RoleCustomer}, Service: auth.ServicePayment}, models.OrderStatusPaymentPending, models.OrderStatusPaid, auth.ServicePayment},
+		{"nobody reopens a cancelled order", admin, models.OrderStatusCancelled, models.OrderStatusPaid, ""},
+		{"anonymous caller", nil, models.OrderStatusPaid, models.OrderStatusCancelled, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, ok := policy.TransitionRole(tt.caller, tt.from, tt.to)
+			if role != tt.wantRole || ok != (tt.wantRole != "") {
+				t.Errorf("TransitionRole(%s->%s) = %q, %t; want %q", tt.from, tt.to, role, ok, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `{"roles": {"customer": {"rpcs": {"GetOrder": "own"}, "transitions": ["paid->cancelled"]}}}`, false},
+		{"wildcard", `{"roles": {"admin": {"rpcs": {"*": "any"}}}}`, false},
+		{"services", `{"roles": {"admin": {"rpcs": {"*": "any"}}}, "services": {"payment_service": {"rpcs": {"UpdateOrderStatus": "any"}, "transitions": ["payment_pending->paid"]}}}`, false},
+		{"service with unknown scope", `{"roles": {"admin": {"rpcs": {"*": "any"}}}, "services": {"payment_service": {"rpcs": {"UpdateOrderStatus": "all"}}}}`, true},
+		{"service with unknown status", `{"roles": {"admin": {"rpcs": {"*": "any"}}}, "services": {"payment_service": {"transitions": ["payment_pending->settled"]}}}`, true},
+		{"no roles", `{"roles": {}}`, true},
+		{"unknown scope", `{"roles": {"customer": {"rpcs": {"GetOrder": "mine"}}}}`, true},
+		{"unknown status", `{"roles": {"customer": {"transitions": ["paid->refunded"]}}}`, true},
+		{"malformed transition", `{"roles": {"customer": {"transitions": ["paid"]}}}`, true},
+		{"not JSON", `roles: {}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadPolicy error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadedPolicyWildcardGrantsEveryRPC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"roles": {"admin": {"rpcs": {"*": "any", "PlaceOrder": "own"}}}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	if got := policy.Scope(admin, RPCRetryRefund); got != ScopeAny {
+		t.Errorf("Scope(%s) = %q, want %q from the wildcard", RPCRetryRefund, got, ScopeAny)
+	}
+	if got := policy.Scope(admin, RPCPlaceOrder); got != ScopeOwn {
+		t.Errorf("Scope(%s) = %q, want the explicit %q grant", RPCPlaceOrder, got, ScopeOwn)
+	}
+}
+
+func TestLoadedPolicyServiceGrants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{
+		"roles": {"payment_service": {"rpcs": {"GetOrder": "any"}}},
+		"services": {"payment_service": {"rpcs": {"UpdateOrderStatus": "any"}}}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	if got := policy.Scope(payment, RPCUpdateOrderStatus); got != ScopeAny {
+		t.Errorf("service Scope(%s) = %q, want %q", RPCUpdateOrderStatus, got, ScopeAny)
+	}
+	if got := policy.Scope(payment, RPCGetOrder); got != "" {
+		t.Errorf("service Scope(%s) = %q, want the role of the same name not to apply", RPCGetOrder, got)
+	}
+	if got := policy.Scope(fakeService, RPCUpdateOrderStatus); got != "" {
+		t.Errorf("role Scope(%s) = %q, want the service of the same name not to apply", RPCUpdateOrderStatus, got)
+	}
+	if got := policy.Scope(fakeService, RPCGetOrder); got != ScopeAny {
+		t.Errorf("role Scope(%s) = %q, want %q", RPCGetOrder, got, ScopeAny)
+	}
+}
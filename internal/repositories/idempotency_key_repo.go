@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyKeyRepository interface {
+	Reserve(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	Complete(customerID uuid.UUID, key string, orderID uuid.UUID, paymentURL string) error
+	Release(customerID uuid.UUID, key string) error
+	ClearPaymentURL(orderID uuid.UUID) error
+}
+
+type idempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyKeyRepository(db *gorm.DB) IdempotencyKeyRepository {
+	return &idempotencyKeyRepository{db}
+}
+
+// Reserve claims the key for the customer. It returns true when the caller
+// now owns the key, or false together with the stored key when an unexpired
+// request with the same key already exists.
+func (r *idempotencyKeyRepository) Reserve(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	var existing models.IdempotencyKey
+	reserved := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("customer_id = ? AND key = ? AND expires_at <= ?", key.CustomerID, key.Key, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			reserved = true
+			return nil
+		}
+
+		return tx.Where("customer_id = ? AND key = ?", key.CustomerID, key.Key).First(&existing).Error
+	})
+	if err != nil {
+		return nil, false, errors.NewInternalError(err)
+	}
+
+	if reserved {
+		return key, true, nil
+	}
+
+	return &existing, false, nil
+}
+
+func (r *idempotencyKeyRepository) Complete(customerID uuid.UUID, key string, orderID uuid.UUID, paymentURL string) error {
+	err := r.db.Model(&models.IdempotencyKey{}).
+		Where("customer_id = ? AND key = ?", customerID, key).
+		Updates(map[string]interface{}{
+			"order_id":    orderID,
+			"payment_url": paymentURL,
+		}).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
+
+func (r *idempotencyKeyRepository) Release(customerID uuid.UUID, key string) error {
+	err := r.db.Where("customer_id = ? AND key = ? AND order_id IS NULL", customerID, key).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
+
+// ClearPaymentURL forgets the payment URL stored for an order, so a repeated
+// request is given a new one instead.
+func (r *idempotencyKeyRepository) ClearPaymentURL(orderID uuid.UUID) error {
+	err := r.db.Model(&models.IdempotencyKey{}).
+		Where("order_id = ?", orderID).
+		Update("payment_url", nil).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
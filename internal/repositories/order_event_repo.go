@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrderEventRepository interface {
+	AddEvent(event *models.OrderEvent) error
+	ClaimPending(limit int, leaseUntil time.Time) ([]models.OrderEvent, error)
+	MarkPublished(eventID string) error
+	MarkFailed(eventID string, cause error, nextAttemptAt time.Time) error
+	MarkDead(eventID string, cause error) error
+}
+
+type orderEventRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderEventRepository(db *gorm.DB) OrderEventRepository {
+	return &orderEventRepository{db}
+}
+
+func (r *orderEventRepository) AddEvent(event *models.OrderEvent) error {
+	if err := r.db.Create(event).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// ClaimPending returns unpublished events that are due for a delivery
+// attempt and moves their next attempt to leaseUntil, so other relays leave
+// them alone while they are published outside the transaction. Rows locked
+// by another relay are skipped. An event whose outcome is never recorded is
+// delivered again once the lease runs out.
+func (r *orderEventRepository) ClaimPending(limit int, leaseUntil time.Time) ([]models.OrderEvent, error) {
+	var events []models.OrderEvent
+
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("published_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", time.Now()).
+		Order("created_at asc").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID.String()
+	}
+	err = r.db.Model(&models.OrderEvent{}).Where("id IN ?", ids).Update("next_attempt_at", leaseUntil).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return events, nil
+}
+
+func (r *orderEventRepository) MarkPublished(eventID string) error {
+	result := r.db.Model(&models.OrderEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"published_at": time.Now(),
+		"attempts":     gorm.Expr("attempts + 1"),
+		"last_error":   nil,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order event with ID '%s' not found", eventID))
+	}
+
+	return nil
+}
+
+func (r *orderEventRepository) MarkFailed(eventID string, cause error, nextAttemptAt time.Time) error {
+	result := r.db.Model(&models.OrderEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      cause.Error(),
+		"next_attempt_at": nextAttemptAt,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order event with ID '%s' not found", eventID))
+	}
+
+	return nil
+}
+
+// MarkDead gives up on delivering the event after its last failed attempt.
+func (r *orderEventRepository) MarkDead(eventID string, cause error) error {
+	result := r.db.Model(&models.OrderEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": cause.Error(),
+		"dead_at":    time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order event with ID '%s' not found", eventID))
+	}
+
+	return nil
+}
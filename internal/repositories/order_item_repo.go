@@ -11,6 +11,8 @@ import (
 type OrderItemRepository interface {
 	AddOrderItem(item *models.OrderItem) error
 	GetItemsByOrderID(orderID string) ([]models.OrderItem, error)
+	CancelQuantity(itemID string, quantity int) error
+	UpdateQuantity(itemID string, quantity int) error
 }
 
 type orderItemRepository struct {
@@ -21,6 +23,7 @@ func NewOrderItemRepository(db *gorm.DB) OrderItemRepository {
 	return &orderItemRepository{db}
 }
 
+// AddOrderItem stores the item together with its prescription, if any.
 func (r *orderItemRepository) AddOrderItem(item *models.OrderItem) error {
 	if err := r.db.Create(item).Error; err != nil {
 		return errors.NewInternalError(err)
@@ -31,7 +34,7 @@ func (r *orderItemRepository) AddOrderItem(item *models.OrderItem) error {
 func (r *orderItemRepository) GetItemsByOrderID(orderID string) ([]models.OrderItem, error) {
 	var items []models.OrderItem
 
-	if err := r.db.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+	if err := r.db.Preload("Prescription").Where("order_id = ?", orderID).Find(&items).Error; err != nil {
 		return nil, errors.NewInternalError(err)
 	}
 
@@ -41,3 +44,35 @@ func (r *orderItemRepository) GetItemsByOrderID(orderID string) ([]models.OrderI
 
 	return items, nil
 }
+
+// CancelQuantity moves quantity of an item from ordered to cancelled.
+func (r *orderItemRepository) CancelQuantity(itemID string, quantity int) error {
+	result := r.db.Model(&models.OrderItem{}).Where("id = ? AND quantity >= ?", itemID, quantity).Updates(map[string]interface{}{
+		"quantity":           gorm.Expr("quantity - ?", quantity),
+		"cancelled_quantity": gorm.Expr("cancelled_quantity + ?", quantity),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewConflictError(fmt.Sprintf("Cannot cancel %d of order item '%s'", quantity, itemID))
+	}
+
+	return nil
+}
+
+func (r *orderItemRepository) UpdateQuantity(itemID string, quantity int) error {
+	result := r.db.Model(&models.OrderItem{}).Where("id = ?", itemID).Update("quantity", quantity)
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order item with ID '%s' not found", itemID))
+	}
+
+	return nil
+}
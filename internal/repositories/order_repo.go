@@ -2,33 +2,67 @@ package repositories
 
 import (
 	"fmt"
-	"strings"
+	"time"
 
+	"github.com/PharmaKart/order-svc/internal/auth"
 	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/query"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
 	"github.com/PharmaKart/order-svc/pkg/errors"
-	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository interface {
 	CreateOrder(order *models.Order) (string, error)
 	GetOrderByID(orderID string) (*models.Order, *[]models.OrderItem, error)
-	ListCustomersOrders(customerID string, filter models.Filter, sortBy string, sortOrder string, page, limit int32) ([]models.Order, int32, error)
-	ListAllOrders(filter models.Filter, sortBy string, sortOrder string, page, limit int32) ([]models.Order, int32, error)
-	UpdateOrderStatus(orderID string, status string) error
+	GetOrderByIdempotencyKey(customerID uuid.UUID, key string) (*models.Order, error)
+	ListCustomersOrders(customerID string, spec query.Spec) ([]models.Order, int32, string, error)
+	ListAllOrders(spec query.Spec) ([]models.Order, int32, string, error)
+	UpdateOrderStatus(orderID string, status string, actor statemachine.Actor, changedBy, reason string) error
+	ListPendingPrescriptions(page, limit int32) ([]models.Order, int32, error)
+	UpdateShippingAddress(orderID string, address models.Address) error
+	LockOrder(orderID string) error
+	AddRefundedAmount(orderID string, amount money.Amount) error
+	UpdateTotals(order *models.Order) error
+	SetCancellationReason(orderID, reason string) error
+	ListExpiredPaymentPending(createdBefore, failedBefore time.Time, limit int) ([]models.Order, error)
+	MarkExpiryFailed(orderID string, at time.Time) error
+	ClaimPaymentPending(orderID string) (bool, error)
 }
 
 type orderRepository struct {
-	db *gorm.DB
+	db           *gorm.DB
+	stateMachine statemachine.OrderStateMachine
 }
 
-func NewOrderRepository(db *gorm.DB) OrderRepository {
-	return &orderRepository{db}
+// orderColumns are the columns order lists can be filtered and sorted on.
+var orderColumns = query.ColumnsOf(&models.Order{})
+
+func NewOrderRepository(db *gorm.DB, stateMachine statemachine.OrderStateMachine) OrderRepository {
+	return &orderRepository{db, stateMachine}
 }
 
+// CreateOrder inserts the order and starts its status history with the
+// customer as the actor.
 func (r *orderRepository) CreateOrder(order *models.Order) (string, error) {
-	if err := r.db.Create(order).Error; err != nil {
-		return "", errors.NewInternalError(err)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return errors.NewInternalError(err)
+		}
+
+		return NewOrderStatusHistoryRepository(tx).AddChange(&models.OrderStatusChange{
+			OrderID:   order.ID,
+			ToStatus:  order.Status,
+			Actor:     order.CustomerID.String(),
+			ActorRole: auth.RoleCustomer,
+			ChangedAt: order.CreatedAt,
+		})
+	})
+	if err != nil {
+		return "", err
 	}
 
 	return order.ID.String(), nil
@@ -38,7 +72,14 @@ func (r *orderRepository) GetOrderByID(orderID string) (*models.Order, *[]models
 	var order models.Order
 	var items []models.OrderItem
 
-	err := r.db.Where("id = ?", orderID).First(&order).Error
+	err := r.db.Preload("TaxLines").
+		Preload("Shipments", func(db *gorm.DB) *gorm.DB { return db.Order("shipped_at asc") }).
+		Preload("Shipments.Items").
+		Preload("Shipments.Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at asc") }).
+		Preload("Returns", func(db *gorm.DB) *gorm.DB { return db.Order("created_at asc") }).
+		Preload("Returns.Items").
+		Preload("Returns.Refund").
+		Where("id = ?", orderID).First(&order).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil, errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
@@ -46,7 +87,7 @@ func (r *orderRepository) GetOrderByID(orderID string) (*models.Order, *[]models
 		return nil, nil, errors.NewInternalError(err)
 	}
 
-	err = r.db.Where("order_id = ?", orderID).Find(&items).Error
+	err = r.db.Preload("Prescription").Where("order_id = ?", orderID).Find(&items).Error
 	if err != nil {
 		return nil, nil, errors.NewInternalError(err)
 	}
@@ -54,168 +95,247 @@ func (r *orderRepository) GetOrderByID(orderID string) (*models.Order, *[]models
 	return &order, &items, nil
 }
 
-func (r *orderRepository) ListCustomersOrders(customerID string, filter models.Filter, sortBy string, sortOrder string, page, limit int32) ([]models.Order, int32, error) {
+// withItems loads the items of every order on a page, and their
+// prescriptions, with one query each instead of one per order.
+func withItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items").Preload("Items.Prescription")
+}
+
+// ListCustomersOrders returns a page of a customer's orders, with their
+// items, and the cursor of the next page.
+// GetOrderByIdempotencyKey returns the customer's latest order placed with
+// the idempotency key that did not fail.
+func (r *orderRepository) GetOrderByIdempotencyKey(customerID uuid.UUID, key string) (*models.Order, error) {
 	var orders []models.Order
-	var total int64
 
-	allowedColumns := utils.GetModelColumns(&models.Order{})
+	err := r.db.Where("customer_id = ? AND idempotency_key = ? AND status <> ?", customerID, key, models.OrderStatusFailed).
+		Order("created_at desc").
+		Limit(1).
+		Find(&orders).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
 
-	allowedOperators := map[string]string{
-		"eq":      "=",           // Equal to
-		"neq":     "!=",          // Not equal to
-		"gt":      ">",           // Greater than
-		"gte":     ">=",          // Greater than or equal to
-		"lt":      "<",           // Less than
-		"lte":     "<=",          // Less than or equal to
-		"like":    "LIKE",        // LIKE for pattern matching
-		"ilike":   "ILIKE",       // Case insensitive LIKE (for PostgreSQL)
-		"in":      "IN",          // IN for multiple values
-		"null":    "IS NULL",     // IS NULL check
-		"notnull": "IS NOT NULL", // IS NOT NULL check
+	if len(orders) == 0 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Order with idempotency key '%s' not found", key))
 	}
 
-	query := r.db.Model(&models.Order{}).Where("customer_id = ?", customerID)
+	return &orders[0], nil
+}
 
-	if filter != (models.Filter{}) {
-		if _, allowed := allowedColumns[filter.Column]; !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid filter column: " + filter.Column)
-		}
+func (r *orderRepository) ListCustomersOrders(customerID string, spec query.Spec) ([]models.Order, int32, string, error) {
+	orders, total, nextCursor, err := query.Find[models.Order](r.db.Model(&models.Order{}).Where("customer_id = ?", customerID), orderColumns, spec, withItems)
+	return orders, int32(total), nextCursor, err
+}
 
-		op, allowed := allowedOperators[filter.Operator]
-		if !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid filter operator: " + filter.Operator)
-		}
+// ListAllOrders returns a page of all orders, with their items, and the
+// cursor of the next page.
+func (r *orderRepository) ListAllOrders(spec query.Spec) ([]models.Order, int32, string, error) {
+	orders, total, nextCursor, err := query.Find[models.Order](r.db.Model(&models.Order{}), orderColumns, spec, withItems)
+	return orders, int32(total), nextCursor, err
+}
 
-		switch filter.Operator {
-		case "like", "ilike":
-			query = query.Where(filter.Column+" "+op+" ?", "%"+filter.Value+"%")
-		case "in":
-			values := strings.Split(filter.Value, ",")
-			query = query.Where(filter.Column+" "+op+" (?)", values)
-		case "null", "notnull":
-			query = query.Where(filter.Column + " " + op)
-		default:
-			query = query.Where(filter.Column+" "+op+" ?", filter.Value)
+// UpdateOrderStatus moves the order to status and records the change, made
+// by changedBy acting as actor, in the order's status history. reason may be
+// empty.
+func (r *orderRepository) UpdateOrderStatus(orderID string, status string, actor statemachine.Actor, changedBy, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", orderID).First(&order).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
+			}
+			return errors.NewInternalError(err)
 		}
-	}
 
-	if sortBy != "" {
-		if _, allowed := allowedColumns[sortBy]; !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid sort column: " + sortBy)
+		event := statemachine.Event{
+			OrderID: orderID,
+			From:    order.Status,
+			To:      status,
+			Actor:   actor,
 		}
 
-		sortOrder = strings.ToLower(sortOrder)
-		if sortOrder != "asc" && sortOrder != "desc" {
-			sortOrder = "asc"
-		}
+		return r.stateMachine.Transition(tx, event, func() error {
+			values := map[string]interface{}{"status": status}
+			// The grand total at the time of payment is what was captured;
+			// refunds are later bounded by it.
+			if status == models.OrderStatusPaid {
+				values["paid_total"] = gorm.Expr("subtotal + shipping_cost + tax_total")
+			}
+			if err := tx.Model(&models.Order{}).Where("id = ?", orderID).Updates(values).Error; err != nil {
+				return errors.NewInternalError(err)
+			}
+
+			change := &models.OrderStatusChange{
+				OrderID:    order.ID,
+				FromStatus: &order.Status,
+				ToStatus:   status,
+				Actor:      changedBy,
+				ActorRole:  string(actor),
+				ChangedAt:  time.Now(),
+			}
+			if reason != "" {
+				change.Reason = &reason
+			}
+			return NewOrderStatusHistoryRepository(tx).AddChange(change)
+		})
+	})
+}
 
-		query = query.Order(sortBy + " " + sortOrder)
-	}
+// ListPendingPrescriptions returns paid orders that are waiting for a
+// pharmacist to review their prescription, oldest first.
+func (r *orderRepository) ListPendingPrescriptions(page, limit int32) ([]models.Order, int32, error) {
+	db := r.db.Model(&models.Order{}).Where("requires_prescription = ? AND status = ?", true, models.OrderStatusPaid)
+
+	orders, total, _, err := query.Find[models.Order](db, orderColumns, query.Spec{
+		SortBy: "created_at",
+		Page:   page,
+		Limit:  limit,
+	}, withItems)
+	return orders, int32(total), err
+}
 
-	err := query.Count(&total).Error
-	if err != nil {
-		return nil, 0, errors.NewInternalError(err)
+func (r *orderRepository) UpdateShippingAddress(orderID string, address models.Address) error {
+	result := r.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"shipping_recipient":   address.Recipient,
+		"shipping_line1":       address.Line1,
+		"shipping_line2":       address.Line2,
+		"shipping_city":        address.City,
+		"shipping_region":      address.Region,
+		"shipping_postal_code": address.PostalCode,
+		"shipping_country":     address.Country,
+		"shipping_phone":       address.Phone,
+		"updated_at":           time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
 	}
 
-	if limit > 0 {
-		offset := max(int((page-1)*limit), 0)
-		query = query.Offset(offset).Limit(int(limit))
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
 	}
 
-	err = query.Find(&orders).Error
+	return nil
+}
+
+// LockOrder takes a row lock on the order for the rest of the transaction so
+// concurrent changes to the same order run one after another.
+func (r *orderRepository) LockOrder(orderID string) error {
+	var order models.Order
+
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", orderID).First(&order).Error
 	if err != nil {
-		return nil, 0, errors.NewInternalError(err)
+		if err == gorm.ErrRecordNotFound {
+			return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
+		}
+		return errors.NewInternalError(err)
 	}
 
-	return orders, int32(total), nil
+	return nil
 }
 
-func (r *orderRepository) ListAllOrders(filter models.Filter, sortBy string, sortOrder string, page, limit int32) ([]models.Order, int32, error) {
-	var orders []models.Order
-	var total int64
+// AddRefundedAmount adds a successful refund to the order's refunded total.
+func (r *orderRepository) AddRefundedAmount(orderID string, amount money.Amount) error {
+	result := r.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"refunded_total": gorm.Expr("refunded_total + ?", amount),
+		"updated_at":     time.Now(),
+	})
 
-	allowedColumns := utils.GetModelColumns(&models.Order{})
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
 
-	allowedOperators := map[string]string{
-		"eq":      "=",           // Equal to
-		"neq":     "!=",          // Not equal to
-		"gt":      ">",           // Greater than
-		"gte":     ">=",          // Greater than or equal to
-		"lt":      "<",           // Less than
-		"lte":     "<=",          // Less than or equal to
-		"like":    "LIKE",        // LIKE for pattern matching
-		"ilike":   "ILIKE",       // Case insensitive LIKE (for PostgreSQL)
-		"in":      "IN",          // IN for multiple values
-		"null":    "IS NULL",     // IS NULL check
-		"notnull": "IS NOT NULL", // IS NOT NULL check
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
 	}
 
-	query := r.db.Model(&models.Order{})
+	return nil
+}
 
-	if filter != (models.Filter{}) {
-		if _, allowed := allowedColumns[filter.Column]; !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid filter column: " + filter.Column)
-		}
+// UpdateTotals stores the recalculated amounts of an order whose items have
+// changed.
+func (r *orderRepository) UpdateTotals(order *models.Order) error {
+	result := r.db.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"subtotal":              order.Subtotal,
+		"shipping_method":       order.ShippingMethod,
+		"shipping_cost":         order.ShippingCost,
+		"tax_total":             order.TaxTotal,
+		"requires_prescription": order.RequiresPrescription,
+		"updated_at":            time.Now(),
+	})
 
-		op, allowed := allowedOperators[filter.Operator]
-		if !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid filter operator: " + filter.Operator)
-		}
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
 
-		switch filter.Operator {
-		case "like", "ilike":
-			query = query.Where(filter.Column+" "+op+" ?", "%"+filter.Value+"%")
-		case "in":
-			values := strings.Split(filter.Value, ",")
-			query = query.Where(filter.Column+" "+op+" (?)", values)
-		case "null", "notnull":
-			query = query.Where(filter.Column + " " + op)
-		default:
-			query = query.Where(filter.Column+" "+op+" ?", filter.Value)
-		}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", order.ID))
 	}
 
-	if sortBy != "" {
-		if _, allowed := allowedColumns[sortBy]; !allowed {
-			return nil, 0, errors.NewBadRequestError("invalid sort column: " + sortBy)
-		}
+	return nil
+}
 
-		sortOrder = strings.ToLower(sortOrder)
-		if sortOrder != "asc" && sortOrder != "desc" {
-			sortOrder = "asc"
-		}
+func (r *orderRepository) SetCancellationReason(orderID, reason string) error {
+	result := r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("cancellation_reason", reason)
 
-		query = query.Order(sortBy + " " + sortOrder)
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
 	}
 
-	err := query.Count(&total).Error
-	if err != nil {
-		return nil, 0, errors.NewInternalError(err)
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
 	}
 
-	if limit > 0 {
-		offset := max(int((page-1)*limit), 0)
-		query = query.Offset(offset).Limit(int(limit))
-	}
+	return nil
+}
+
+// ListExpiredPaymentPending returns up to limit orders that have been
+// waiting for payment since before createdBefore. Orders whose expiry last
+// failed at or after failedBefore are skipped, and the others that failed
+// come after those never tried, so failing orders cannot fill every batch.
+// The orders are not locked; claim each one with ClaimPaymentPending before
+// changing it.
+func (r *orderRepository) ListExpiredPaymentPending(createdBefore, failedBefore time.Time, limit int) ([]models.Order, error) {
+	var orders []models.Order
 
-	err = query.Find(&orders).Error
+	err := r.db.Where("status = ? AND created_at < ?", models.OrderStatusPaymentPending, createdBefore).
+		Where("expiry_failed_at IS NULL OR expiry_failed_at < ?", failedBefore).
+		Order("expiry_failed_at asc nulls first, created_at asc").
+		Limit(limit).
+		Find(&orders).Error
 	if err != nil {
-		return nil, 0, errors.NewInternalError(err)
+		return nil, errors.NewInternalError(err)
 	}
 
-	return orders, int32(total), nil
+	return orders, nil
 }
 
-func (r *orderRepository) UpdateOrderStatus(orderID string, status string) error {
-	result := r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status)
-
-	if result.Error != nil {
-		return errors.NewInternalError(result.Error)
+// MarkExpiryFailed records when cancelling the unpaid order last failed.
+func (r *orderRepository) MarkExpiryFailed(orderID string, at time.Time) error {
+	err := r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("expiry_failed_at", at).Error
+	if err != nil {
+		return errors.NewInternalError(err)
 	}
 
-	if result.RowsAffected == 0 {
-		return errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
+	return nil
+}
+
+// ClaimPaymentPending locks the order if it is still waiting for payment.
+// An order locked by another transaction is skipped rather than waited for,
+// so several replicas can expire orders at the same time without handling
+// one twice. It reports whether the order was claimed.
+func (r *orderRepository) ClaimPaymentPending(orderID string) (bool, error) {
+	var orders []models.Order
+
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ?", orderID, models.OrderStatusPaymentPending).
+		Find(&orders).Error
+	if err != nil {
+		return false, errors.NewInternalError(err)
 	}
 
-	return nil
+	return len(orders) > 0, nil
 }
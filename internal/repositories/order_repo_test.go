@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/query"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// countingDB is a database/sql driver that answers the queries of an order
+// list from canned rows and counts them. Every order has two items, one of
+// them with a prescription.
+type countingDB struct {
+	mu      sync.Mutex
+	orders  int
+	queries []string
+}
+
+func (d *countingDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return &countingConn{d}, nil
+}
+
+func (d *countingDB) Driver() driver.Driver {
+	return nil
+}
+
+func (d *countingDB) query(sql string, args []driver.NamedValue) (driver.Rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, sql)
+
+	switch {
+	case strings.Contains(sql, "count(*)"):
+		return &cannedRows{columns: []string{"count"}, values: [][]driver.Value{{int64(d.orders)}}}, nil
+	case strings.Contains(sql, `FROM "orders"`):
+		rows := &cannedRows{columns: []string{"id", "status"}}
+		for i := 0; i < d.orders; i++ {
+			rows.values = append(rows.values, []driver.Value{uuid.NewString(), "paid"})
+		}
+		return rows, nil
+	case strings.Contains(sql, `FROM "order_items"`):
+		rows := &cannedRows{columns: []string{"id", "order_id", "prescription_id"}}
+		for _, arg := range args {
+			rows.values = append(rows.values,
+				[]driver.Value{uuid.NewString(), arg.Value, nil},
+				[]driver.Value{uuid.NewString(), arg.Value, uuid.NewString()})
+		}
+		return rows, nil
+	case strings.Contains(sql, `FROM "prescriptions"`):
+		rows := &cannedRows{columns: []string{"id"}}
+		for _, arg := range args {
+			rows.values = append(rows.values, []driver.Value{arg.Value})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", sql)
+}
+
+type countingConn struct {
+	db *countingDB
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, args)
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *countingConn) Close() error {
+	return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type cannedRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *cannedRows) Columns() []string {
+	return r.columns
+}
+
+func (r *cannedRows) Close() error {
+	return nil
+}
+
+func (r *cannedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newCountingRepository(t testing.TB, orders int) (OrderRepository, *countingDB) {
+	t.Helper()
+
+	counting := &countingDB{orders: orders}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(counting)}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return NewOrderRepository(db, statemachine.NewOrderStateMachine()), counting
+}
+
+func TestOrderListPagesCostAFixedNumberOfQueries(t *testing.T) {
+	// Counting the rows, reading the page, its items and their prescriptions.
+	const want = 4
+
+	for _, orders := range []int{1, 10, 50} {
+		t.Run(fmt.Sprintf("%d orders", orders), func(t *testing.T) {
+			repo, counting := newCountingRepository(t, orders)
+
+			page, _, _, err := repo.ListAllOrders(query.Spec{SortBy: "created_at", Page: 1, Limit: int32(orders)})
+			if err != nil {
+				t.Fatalf("ListAllOrders: %v", err)
+			}
+
+			if len(counting.queries) != want {
+				t.Errorf("a page of %d orders ran %d queries, want %d:\n%s", orders, len(counting.queries), want, strings.Join(counting.queries, "\n"))
+			}
+			if len(page) != orders {
+				t.Fatalf("page has %d orders, want %d", len(page), orders)
+			}
+			for _, order := range page {
+				if len(order.Items) != 2 || order.Items[1].Prescription == nil {
+					t.Fatalf("order %s items = %+v, want two with the second's prescription loaded", order.ID, order.Items)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListAllOrders(b *testing.B) {
+	for _, orders := range []int{10, 50} {
+		b.Run(fmt.Sprintf("%d orders", orders), func(b *testing.B) {
+			repo, counting := newCountingRepository(b, orders)
+			spec := query.Spec{SortBy: "created_at", Page: 1, Limit: int32(orders)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, _, err := repo.ListAllOrders(spec); err != nil {
+					b.Fatalf("ListAllOrders: %v", err)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(len(counting.queries))/float64(b.N), "queries/op")
+		})
+	}
+}
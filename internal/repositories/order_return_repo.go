@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type OrderReturnRepository interface {
+	CreateReturn(orderReturn *models.OrderReturn) error
+	GetReturnByID(returnID string) (*models.OrderReturn, error)
+	UpdateStatus(returnID, status string, rejectionReason *string) error
+}
+
+type orderReturnRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderReturnRepository(db *gorm.DB) OrderReturnRepository {
+	return &orderReturnRepository{db}
+}
+
+// CreateReturn stores the return together with its items.
+func (r *orderReturnRepository) CreateReturn(orderReturn *models.OrderReturn) error {
+	if err := r.db.Create(orderReturn).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *orderReturnRepository) GetReturnByID(returnID string) (*models.OrderReturn, error) {
+	var orderReturn models.OrderReturn
+
+	err := r.db.Preload("Items").Preload("Refund").Where("id = ?", returnID).First(&orderReturn).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Return with ID '%s' not found", returnID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &orderReturn, nil
+}
+
+func (r *orderReturnRepository) UpdateStatus(returnID, status string, rejectionReason *string) error {
+	now := time.Now()
+	result := r.db.Model(&models.OrderReturn{}).Where("id = ?", returnID).Updates(map[string]interface{}{
+		"status":           status,
+		"rejection_reason": rejectionReason,
+		"reviewed_at":      now,
+		"updated_at":       now,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Return with ID '%s' not found", returnID))
+	}
+
+	return nil
+}
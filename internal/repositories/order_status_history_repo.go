@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type OrderStatusHistoryRepository interface {
+	AddChange(change *models.OrderStatusChange) error
+	GetHistoryByOrderID(orderID string) ([]models.OrderStatusChange, error)
+}
+
+type orderStatusHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderStatusHistoryRepository(db *gorm.DB) OrderStatusHistoryRepository {
+	return &orderStatusHistoryRepository{db}
+}
+
+func (r *orderStatusHistoryRepository) AddChange(change *models.OrderStatusChange) error {
+	if err := r.db.Create(change).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// GetHistoryByOrderID returns the order's status changes, oldest first.
+func (r *orderStatusHistoryRepository) GetHistoryByOrderID(orderID string) ([]models.OrderStatusChange, error) {
+	var history []models.OrderStatusChange
+
+	if err := r.db.Where("order_id = ?", orderID).Order("changed_at asc").Find(&history).Error; err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type PrescriptionReviewRepository interface {
+	AddReview(review *models.PrescriptionReview) error
+	GetLatestReview(orderID string) (*models.PrescriptionReview, error)
+}
+
+type prescriptionReviewRepository struct {
+	db *gorm.DB
+}
+
+func NewPrescriptionReviewRepository(db *gorm.DB) PrescriptionReviewRepository {
+	return &prescriptionReviewRepository{db}
+}
+
+func (r *prescriptionReviewRepository) AddReview(review *models.PrescriptionReview) error {
+	if err := r.db.Create(review).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *prescriptionReviewRepository) GetLatestReview(orderID string) (*models.PrescriptionReview, error) {
+	var review models.PrescriptionReview
+
+	err := r.db.Where("order_id = ?", orderID).Order("reviewed_at desc").First(&review).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("No prescription review found for order ID '%s'", orderID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &review, nil
+}
+
+// RequireApprovedPrescription is a state machine hook that stops orders which
+// need a prescription from moving on until a pharmacist has approved it.
+func RequireApprovedPrescription(tx *gorm.DB, event statemachine.Event) error {
+	var order models.Order
+	if err := tx.Where("id = ?", event.OrderID).First(&order).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	if !order.RequiresPrescription {
+		return nil
+	}
+
+	review, err := NewPrescriptionReviewRepository(tx).GetLatestReview(event.OrderID)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok && appErr.Type == errors.NotFoundError {
+			return errors.NewConflictError(fmt.Sprintf("Cannot transition order from '%s' to '%s' before its prescription is approved", event.From, event.To))
+		}
+		return err
+	}
+
+	if review.Decision != models.PrescriptionDecisionApproved {
+		return errors.NewConflictError(fmt.Sprintf("Cannot transition order from '%s' to '%s' because its prescription was rejected", event.From, event.To))
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/query"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"gorm.io/gorm"
+)
+
+type RefundRepository interface {
+	CreateRefund(refund *models.Refund) error
+	GetRefundByID(refundID string) (*models.Refund, error)
+	GetRefundByTransactionID(transactionID string) (*models.Refund, error)
+	MarkSucceeded(refundID, transactionID string) error
+	MarkFailed(refundID, reason string) error
+	MarkNotRequired(refundID, reason string) error
+	ClaimForRetry(refundID string) error
+	RefundedAmount(orderID string) (money.Amount, error)
+	ListRefunds(status string, page, limit int32) ([]models.Refund, int32, error)
+}
+
+// refundColumns are the columns refund lists can be sorted on.
+var refundColumns = query.ColumnsOf(&models.Refund{})
+
+type refundRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundRepository(db *gorm.DB) RefundRepository {
+	return &refundRepository{db}
+}
+
+func (r *refundRepository) CreateRefund(refund *models.Refund) error {
+	if err := r.db.Create(refund).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *refundRepository) GetRefundByID(refundID string) (*models.Refund, error) {
+	var refund models.Refund
+
+	err := r.db.Where("id = ?", refundID).First(&refund).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refundID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &refund, nil
+}
+
+// GetRefundByTransactionID returns the refund of the payment with the given
+// transaction ID.
+func (r *refundRepository) GetRefundByTransactionID(transactionID string) (*models.Refund, error) {
+	var refund models.Refund
+
+	err := r.db.Where("transaction_id = ?", transactionID).First(&refund).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Refund of transaction '%s' not found", transactionID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &refund, nil
+}
+
+func (r *refundRepository) MarkSucceeded(refundID, transactionID string) error {
+	return r.update(refundID, map[string]interface{}{
+		"status":         models.RefundStatusSucceeded,
+		"transaction_id": transactionID,
+		"attempts":       gorm.Expr("attempts + 1"),
+		"last_error":     nil,
+		"updated_at":     time.Now(),
+	})
+}
+
+func (r *refundRepository) MarkFailed(refundID, reason string) error {
+	return r.update(refundID, map[string]interface{}{
+		"status":     models.RefundStatusFailed,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+		"updated_at": time.Now(),
+	})
+}
+
+// MarkNotRequired closes a refund that had nothing to refund. reason says
+// why and is kept in last_error.
+func (r *refundRepository) MarkNotRequired(refundID, reason string) error {
+	return r.update(refundID, map[string]interface{}{
+		"status":     models.RefundStatusNotRequired,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+		"updated_at": time.Now(),
+	})
+}
+
+// ClaimForRetry moves a failed refund back to pending. Only one caller can
+// claim a given failure, so a refund is never sent twice by concurrent
+// retries.
+func (r *refundRepository) ClaimForRetry(refundID string) error {
+	result := r.db.Model(&models.Refund{}).
+		Where("id = ? AND status = ?", refundID, models.RefundStatusFailed).
+		Updates(map[string]interface{}{
+			"status":     models.RefundStatusPending,
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewConflictError("Only failed refunds can be retried")
+	}
+
+	return nil
+}
+
+// RefundedAmount sums the order's refunds that have been or may still be
+// paid out. Failed refunds count too because they can be retried; refunds
+// that turned out not to be required do not. Refunds of stale payments are
+// left out as they return money that never paid for the order.
+func (r *refundRepository) RefundedAmount(orderID string) (money.Amount, error) {
+	var amount money.Amount
+
+	err := r.db.Model(&models.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("order_id = ? AND status <> ? AND reason <> ?", orderID, models.RefundStatusNotRequired, models.RefundReasonStalePayment).
+		Scan(&amount).Error
+	if err != nil {
+		return 0, errors.NewInternalError(err)
+	}
+
+	return amount, nil
+}
+
+// ListRefunds returns refunds with the given status, or all refunds when
+// status is empty, oldest first.
+func (r *refundRepository) ListRefunds(status string, page, limit int32) ([]models.Refund, int32, error) {
+	db := r.db.Model(&models.Refund{})
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	refunds, total, _, err := query.Find[models.Refund](db, refundColumns, query.Spec{
+		SortBy: "created_at",
+		Page:   page,
+		Limit:  limit,
+	})
+	return refunds, int32(total), err
+}
+
+func (r *refundRepository) update(refundID string, values map[string]interface{}) error {
+	result := r.db.Model(&models.Refund{}).Where("id = ?", refundID).Updates(values)
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refundID))
+	}
+
+	return nil
+}
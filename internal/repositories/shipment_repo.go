@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type ShipmentRepository interface {
+	CreateShipment(shipment *models.Shipment) error
+	GetShipmentByID(shipmentID string) (*models.Shipment, error)
+	AddEvent(event *models.ShipmentEvent) error
+	MarkDelivered(shipmentID string, deliveredAt time.Time) error
+}
+
+type shipmentRepository struct {
+	db *gorm.DB
+}
+
+func NewShipmentRepository(db *gorm.DB) ShipmentRepository {
+	return &shipmentRepository{db}
+}
+
+// CreateShipment stores the shipment together with its items.
+func (r *shipmentRepository) CreateShipment(shipment *models.Shipment) error {
+	if err := r.db.Create(shipment).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *shipmentRepository) GetShipmentByID(shipmentID string) (*models.Shipment, error) {
+	var shipment models.Shipment
+
+	err := r.db.Preload("Items").Preload("Events").Where("id = ?", shipmentID).First(&shipment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Shipment with ID '%s' not found", shipmentID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	return &shipment, nil
+}
+
+func (r *shipmentRepository) AddEvent(event *models.ShipmentEvent) error {
+	if err := r.db.Create(event).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *shipmentRepository) MarkDelivered(shipmentID string, deliveredAt time.Time) error {
+	result := r.db.Model(&models.Shipment{}).Where("id = ? AND delivered_at IS NULL", shipmentID).Update("delivered_at", deliveredAt)
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	return nil
+}
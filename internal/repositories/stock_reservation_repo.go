@@ -0,0 +1,250 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockReservationRepository interface {
+	LockProduct(productID string) error
+	ReservedQuantity(productID string) (int, error)
+	CreateReservation(reservation *models.StockReservation) error
+	LockReservationsByOrderID(orderID string) ([]models.StockReservation, error)
+	AdjustQuantity(reservationID string, delta int) error
+	ReleaseExpired(now time.Time) (int64, error)
+	Renew(reservationID string, expiresAt time.Time) error
+	ClaimCommitted(updatedBefore time.Time, limit int) ([]models.StockReservation, error)
+	MarkDeducting(reservationID string) error
+	MarkDeducted(reservationID string) error
+	MarkDeductionFailed(reservationID string, err error) error
+	FlagStaleDeductions(updatedBefore time.Time) (int64, error)
+}
+
+type stockReservationRepository struct {
+	db *gorm.DB
+}
+
+func NewStockReservationRepository(db *gorm.DB) StockReservationRepository {
+	return &stockReservationRepository{db}
+}
+
+// LockProduct takes a transaction-scoped advisory lock on the product, so
+// checks of its available stock and changes to its reservations run one at
+// a time across every replica.
+func (r *stockReservationRepository) LockProduct(productID string) error {
+	if err := r.db.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "stock:"+productID).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// ReservedQuantity returns the quantity of the product held by reservations
+// that have not been deducted from the product's stock yet.
+func (r *stockReservationRepository) ReservedQuantity(productID string) (int, error) {
+	var quantity int64
+
+	err := r.db.Model(&models.StockReservation{}).
+		Where("product_id = ? AND status IN ?", productID, []string{models.ReservationStatusHeld, models.ReservationStatusCommitted, models.ReservationStatusDeducting, models.ReservationStatusNeedsReview}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&quantity).Error
+	if err != nil {
+		return 0, errors.NewInternalError(err)
+	}
+
+	return int(quantity), nil
+}
+
+func (r *stockReservationRepository) CreateReservation(reservation *models.StockReservation) error {
+	if err := r.db.Create(reservation).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// LockReservationsByOrderID returns the order's reservations and locks them
+// for the rest of the transaction, so their status cannot change under the
+// caller, e.g. by the reconcile loop deducting them.
+func (r *stockReservationRepository) LockReservationsByOrderID(orderID string) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderID).Find(&reservations).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return reservations, nil
+}
+
+func (r *stockReservationRepository) AdjustQuantity(reservationID string, delta int) error {
+	result := r.db.Model(&models.StockReservation{}).
+		Where("id = ? AND quantity + ? >= 0", reservationID, delta).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", delta),
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewConflictError(fmt.Sprintf("Cannot change stock reservation '%s' by %d", reservationID, delta))
+	}
+
+	return nil
+}
+
+// ReleaseExpired releases held reservations whose hold has run out and
+// returns how many were released.
+func (r *stockReservationRepository) ReleaseExpired(now time.Time) (int64, error) {
+	result := r.db.Model(&models.StockReservation{}).
+		Where("status = ? AND expires_at <= ?", models.ReservationStatusHeld, now).
+		Updates(map[string]interface{}{
+			"status":     models.ReservationStatusReleased,
+			"updated_at": now,
+		})
+
+	if result.Error != nil {
+		return 0, errors.NewInternalError(result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Renew holds a released reservation again until expiresAt.
+func (r *stockReservationRepository) Renew(reservationID string, expiresAt time.Time) error {
+	result := r.db.Model(&models.StockReservation{}).
+		Where("id = ? AND status = ?", reservationID, models.ReservationStatusReleased).
+		Updates(map[string]interface{}{
+			"status":     models.ReservationStatusHeld,
+			"expires_at": expiresAt,
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewConflictError(fmt.Sprintf("Stock reservation '%s' is not released", reservationID))
+	}
+
+	return nil
+}
+
+// ClaimCommitted locks up to limit committed reservations last touched
+// before updatedBefore, skipping those locked by another replica.
+func (r *stockReservationRepository) ClaimCommitted(updatedBefore time.Time, limit int) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND updated_at < ?", models.ReservationStatusCommitted, updatedBefore).
+		Order("updated_at asc").
+		Limit(limit).
+		Find(&reservations).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return reservations, nil
+}
+
+// MarkDeducting records that the reservation's stock is about to be
+// deducted. A deducting reservation is not claimed again, so stock is never
+// deducted twice even if the outcome of the deduction is lost.
+func (r *stockReservationRepository) MarkDeducting(reservationID string) error {
+	return r.update(reservationID, map[string]interface{}{
+		"status":     models.ReservationStatusDeducting,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"updated_at": time.Now(),
+	})
+}
+
+func (r *stockReservationRepository) MarkDeducted(reservationID string) error {
+	now := time.Now()
+	return r.update(reservationID, map[string]interface{}{
+		"status":      models.ReservationStatusDeducted,
+		"deducted_at": now,
+		"last_error":  nil,
+		"updated_at":  now,
+	})
+}
+
+// MarkDeductionFailed commits the reservation again, so the deduction is
+// retried on a later run.
+func (r *stockReservationRepository) MarkDeductionFailed(reservationID string, cause error) error {
+	return r.update(reservationID, map[string]interface{}{
+		"status":     models.ReservationStatusCommitted,
+		"last_error": cause.Error(),
+		"updated_at": time.Now(),
+	})
+}
+
+// FlagStaleDeductions moves reservations that have been deducting since
+// before updatedBefore to needs_review and returns how many were moved. The
+// outcome of their deduction was lost, so only an operator can tell whether
+// the stock was deducted.
+func (r *stockReservationRepository) FlagStaleDeductions(updatedBefore time.Time) (int64, error) {
+	result := r.db.Model(&models.StockReservation{}).
+		Where("status = ? AND updated_at < ?", models.ReservationStatusDeducting, updatedBefore).
+		Updates(map[string]interface{}{
+			"status":     models.ReservationStatusNeedsReview,
+			"last_error": "deduction outcome was not recorded",
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, errors.NewInternalError(result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+func (r *stockReservationRepository) update(reservationID string, values map[string]interface{}) error {
+	err := r.db.Model(&models.StockReservation{}).Where("id = ?", reservationID).Updates(values).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
+
+// CommitStockReservations is a state hook for orders entering paid. The
+// order's held reservations are committed so the reconcile loop deducts
+// them. Holds that expired before the payment arrived have to be renewed
+// first; see Reserver.Renew.
+func CommitStockReservations(tx *gorm.DB, event statemachine.Event) error {
+	err := tx.Model(&models.StockReservation{}).
+		Where("order_id = ? AND status = ? AND quantity > 0", event.OrderID, models.ReservationStatusHeld).
+		Updates(map[string]interface{}{
+			"status":     models.ReservationStatusCommitted,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
+
+// ReleaseStockReservations is a state hook for orders that are cancelled or
+// fail. Stock that was not deducted yet becomes available again; deducted
+// stock is returned to the product service by the caller.
+func ReleaseStockReservations(tx *gorm.DB, event statemachine.Event) error {
+	err := tx.Model(&models.StockReservation{}).
+		Where("order_id = ? AND status IN ?", event.OrderID, []string{models.ReservationStatusHeld, models.ReservationStatusCommitted}).
+		Updates(map[string]interface{}{
+			"status":     models.ReservationStatusReleased,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
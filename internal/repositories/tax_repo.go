@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type TaxRateRepository interface {
+	GetEffectiveRates(region string, at time.Time) ([]models.TaxRate, error)
+}
+
+type taxRateRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxRateRepository(db *gorm.DB) TaxRateRepository {
+	return &taxRateRepository{db}
+}
+
+// GetEffectiveRates returns every rate of the region that was in force at
+// the given time.
+func (r *taxRateRepository) GetEffectiveRates(region string, at time.Time) ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+
+	err := r.db.Where("region = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)", region, at, at).
+		Order("name asc").
+		Find(&rates).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return rates, nil
+}
+
+type OrderTaxLineRepository interface {
+	AddTaxLines(lines []models.OrderTaxLine) error
+	ReplaceTaxLines(orderID string, lines []models.OrderTaxLine) error
+}
+
+type orderTaxLineRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderTaxLineRepository(db *gorm.DB) OrderTaxLineRepository {
+	return &orderTaxLineRepository{db}
+}
+
+func (r *orderTaxLineRepository) AddTaxLines(lines []models.OrderTaxLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := r.db.Create(&lines).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// ReplaceTaxLines swaps every tax line of the order for the given ones.
+func (r *orderTaxLineRepository) ReplaceTaxLines(orderID string, lines []models.OrderTaxLine) error {
+	if err := r.db.Where("order_id = ?", orderID).Delete(&models.OrderTaxLine{}).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	return r.AddTaxLines(lines)
+}
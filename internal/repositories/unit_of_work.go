@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// TxRepositories holds repositories bound to a single database transaction.
+type TxRepositories struct {
+	Orders      OrderRepository
+	OrderItems  OrderItemRepository
+	OrderEvents OrderEventRepository
+
+	PrescriptionReviews PrescriptionReviewRepository
+	OrderTaxLines       OrderTaxLineRepository
+	Shipments           ShipmentRepository
+	Returns             OrderReturnRepository
+	Refunds             RefundRepository
+	StockReservations   StockReservationRepository
+	StatusHistory       OrderStatusHistoryRepository
+}
+
+type UnitOfWork interface {
+	WithTx(fn func(repos TxRepositories) error) error
+}
+
+type unitOfWork struct {
+	db           *gorm.DB
+	stateMachine statemachine.OrderStateMachine
+}
+
+func NewUnitOfWork(db *gorm.DB, stateMachine statemachine.OrderStateMachine) UnitOfWork {
+	return &unitOfWork{db, stateMachine}
+}
+
+// WithTx runs fn in a transaction. Everything written through the given
+// repositories is committed if fn returns nil and rolled back otherwise.
+func (u *unitOfWork) WithTx(fn func(repos TxRepositories) error) error {
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		return fn(TxRepositories{
+			Orders:      NewOrderRepository(tx, u.stateMachine),
+			OrderItems:  NewOrderItemRepository(tx),
+			OrderEvents: NewOrderEventRepository(tx),
+
+			PrescriptionReviews: NewPrescriptionReviewRepository(tx),
+			OrderTaxLines:       NewOrderTaxLineRepository(tx),
+			Shipments:           NewShipmentRepository(tx),
+			Returns:             NewOrderReturnRepository(tx),
+			Refunds:             NewRefundRepository(tx),
+			StockReservations:   NewStockReservationRepository(tx),
+			StatusHistory:       NewOrderStatusHistoryRepository(tx),
+		})
+	})
+	if err != nil {
+		if _, ok := errors.IsAppError(err); ok {
+			return err
+		}
+		return errors.NewInternalError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// AmendOrder changes the lines of an order that has not been paid yet. An
+// item with an ID sets the quantity of that line, a quantity of zero removing
+// it; an item without one adds a line for its product. Lines that are not
+// mentioned stay as they are. The payment URLs issued so far are expired
+// first. The order's stock reservations follow the new quantities, the order
+// is repriced and a new payment URL is returned.
+func (s *orderService) AmendOrder(orderID string, caller *auth.Principal, items []models.OrderItem) (string, error) {
+	if len(items) == 0 {
+		return "", errors.NewValidationError("items", "At least one item is required")
+	}
+
+	order, orderItems, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return "", err
+	}
+
+	if !s.policy.CanAccessOrder(caller, rbac.RPCAmendOrder, order.CustomerID.String()) {
+		return "", errors.NewAuthError("You are not authorized to change this order")
+	}
+
+	if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaymentPending {
+		return "", errors.NewConflictError("Only orders awaiting payment can be amended")
+	}
+
+	ctx := context.Background()
+	changed := map[uuid.UUID]int{}
+	var added []models.OrderItem
+	var addedFields []string
+	seenItems := map[uuid.UUID]bool{}
+	seenProducts := map[uuid.UUID]bool{}
+	for i, item := range items {
+		field := fmt.Sprintf("items[%d]", i)
+
+		if item.Quantity < 0 {
+			return "", errors.NewValidationError(field+".quantity", "Quantity cannot be negative")
+		}
+
+		if item.ID != uuid.Nil {
+			if seenItems[item.ID] {
+				return "", errors.NewValidationError(field+".item_id", "Item is listed more than once")
+			}
+			seenItems[item.ID] = true
+
+			existing := findItem(*orderItems, item.ID)
+			if existing == nil {
+				return "", errors.NewValidationError(field+".item_id", "Item is not part of this order")
+			}
+			if item.Prescription != nil {
+				return "", errors.NewValidationError(field+".prescription", "A prescription can only be attached to a new line")
+			}
+			if item.Quantity != existing.Quantity {
+				changed[existing.ID] = item.Quantity
+			}
+			continue
+		}
+
+		if seenProducts[item.ProductID] {
+			return "", errors.NewValidationError(field+".product_id", "Product is listed more than once")
+		}
+		seenProducts[item.ProductID] = true
+
+		if item.Quantity == 0 {
+			return "", errors.NewValidationError(field+".quantity", "A new line needs a quantity")
+		}
+
+		product, err := s.productClient.GetProduct(ctx, &proto.GetProductRequest{ProductId: item.ProductID.String()})
+		if err != nil {
+			return "", err
+		}
+		if !product.Success || product.Product == nil {
+			return "", errors.NewValidationError(field+".product_id", "Product not found")
+		}
+
+		if item.Prescription != nil {
+			if fields := validatePrescription(field+".prescription", item.Prescription, time.Now()); len(fields) > 0 {
+				return "", errors.NewValidationErrors(fields)
+			}
+		}
+
+		item.OrderID = order.ID
+		item.ProductName = product.Product.Name
+		item.Price = money.FromFloat(product.Product.Price)
+		item.WeightGrams = int(product.Product.WeightGrams)
+		item.TaxCategory = models.TaxCategoryOTC
+		if product.Product.RequiresPrescription {
+			item.TaxCategory = models.TaxCategoryPrescription
+		}
+		if item.Prescription != nil {
+			item.Prescription.OrderID = order.ID
+		}
+		added = append(added, item)
+		addedFields = append(addedFields, field)
+	}
+
+	if len(changed) == 0 && len(added) == 0 {
+		return "", errors.NewBadRequestError("The amendment does not change the order")
+	}
+
+	// Every prescription line left on the order needs its own prescription.
+	amended := make([]models.OrderItem, 0, len(*orderItems)+len(added))
+	for _, item := range *orderItems {
+		if quantity, ok := changed[item.ID]; ok {
+			item.Quantity = quantity
+		}
+		amended = append(amended, item)
+	}
+	amended = append(amended, added...)
+	if missing := missingPrescriptions(order, amended); len(missing) > 0 {
+		fields := map[string]string{}
+		for _, i := range missing {
+			if i < len(*orderItems) {
+				fields["prescription_url"] = "The order's prescription only covers an order with a single prescription product"
+				continue
+			}
+			fields[addedFields[i-len(*orderItems)]+".prescription"] = fmt.Sprintf("Prescription required for product %s", amended[i].ProductName)
+		}
+		return "", errors.NewValidationErrors(fields)
+	}
+
+	// The payment URLs issued so far are for the current total.
+	if order.Status == models.OrderStatusPaymentPending {
+		if err := s.expirePaymentURLs(order); err != nil {
+			return "", err
+		}
+	}
+
+	err = s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		current, currentItems, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if current.Status != models.OrderStatusPending && current.Status != models.OrderStatusPaymentPending {
+			return errors.NewConflictError("Only orders awaiting payment can be amended")
+		}
+
+		// The changes were worked out from the lines read above; refuse if
+		// they changed in the meantime.
+		if !sameQuantities(*orderItems, *currentItems) {
+			return errors.NewConflictError("The order was changed by another request, please try again")
+		}
+
+		reservations, err := repos.StockReservations.LockReservationsByOrderID(orderID)
+		if err != nil {
+			return err
+		}
+		if len(reservations) == 0 {
+			return errors.NewConflictError("This order was placed before stock reservations and cannot be amended")
+		}
+
+		lines := *currentItems
+		for i := range lines {
+			quantity, ok := changed[lines[i].ID]
+			if !ok {
+				continue
+			}
+
+			reservation := findReservation(reservations, lines[i].ID)
+			if reservation == nil {
+				return errors.NewConflictError(fmt.Sprintf("No stock reservation found for product %s", lines[i].ProductName))
+			}
+
+			delta := quantity - lines[i].Quantity
+			if delta > 0 {
+				err = s.reserver.Increase(ctx, repos, *reservation, lines[i].ProductName, delta)
+			} else {
+				err = repos.StockReservations.AdjustQuantity(reservation.ID.String(), delta)
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := repos.OrderItems.UpdateQuantity(lines[i].ID.String(), quantity); err != nil {
+				return err
+			}
+			lines[i].Quantity = quantity
+		}
+
+		for i := range added {
+			if err := repos.OrderItems.AddOrderItem(&added[i]); err != nil {
+				return err
+			}
+		}
+		if err := s.reserver.Reserve(ctx, repos, current, added); err != nil {
+			return err
+		}
+		lines = append(lines, added...)
+
+		if len(activeItems(lines)) == 0 {
+			return errors.NewBadRequestError("An order needs at least one item; cancel the order instead")
+		}
+
+		taxLines, err := s.repriceOrder(current, lines)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Orders.UpdateTotals(current); err != nil {
+			return err
+		}
+		if err := repos.OrderTaxLines.ReplaceTaxLines(orderID, taxLines); err != nil {
+			return err
+		}
+
+		event, err := outbox.NewOrderAmendedEvent(current, activeItems(lines))
+		if err != nil {
+			return err
+		}
+		return repos.OrderEvents.AddEvent(event)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.replacePaymentURL(orderID)
+}
+
+func sameQuantities(before, after []models.OrderItem) bool {
+	if len(before) != len(after) {
+		return false
+	}
+
+	quantities := make(map[uuid.UUID]int, len(before))
+	for _, item := range before {
+		quantities[item.ID] = item.Quantity
+	}
+	for _, item := range after {
+		if quantity, ok := quantities[item.ID]; !ok || quantity != item.Quantity {
+			return false
+		}
+	}
+	return true
+}
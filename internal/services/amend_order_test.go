@@ -0,0 +1,169 @@
+package services
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestAmendOrderChangesLinesByItemID(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 1), testItem(product, 2))
+	lines := ts.items(orderID)
+
+	// Both lines hold the same product; only the referenced one changes.
+	if _, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{{ID: lines[1].ID, Quantity: 4}}); err != nil {
+		t.Fatalf("AmendOrder: %v", err)
+	}
+
+	lines = ts.items(orderID)
+	if lines[0].Quantity != 1 || lines[1].Quantity != 4 {
+		t.Errorf("quantities = %d and %d, want 1 and 4", lines[0].Quantity, lines[1].Quantity)
+	}
+	if got := ts.order(orderID).Subtotal; got != 5000 {
+		t.Errorf("subtotal = %d, want 5000", got)
+	}
+}
+
+func TestAmendOrderRejectsUnknownItem(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 1))
+
+	_, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{{ID: uuid.New(), Quantity: 2}})
+	appErr, ok := errors.IsAppError(err)
+	if !ok || appErr.Type != errors.ValidationError || appErr.Details["items[0].item_id"] == "" {
+		t.Fatalf("AmendOrder error = %v, want a validation error on items[0].item_id", err)
+	}
+}
+
+func TestPaymentAtAmountBeforeAmendmentIsRefunded(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 1))
+	order := ts.order(orderID)
+	before := order.GrandTotal()
+
+	if _, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{{ID: ts.items(orderID)[0].ID, Quantity: 3}}); err != nil {
+		t.Fatalf("AmendOrder: %v", err)
+	}
+	if len(ts.payments.expired) != 1 || ts.payments.expired[0] != orderID {
+		t.Errorf("expired payment URLs of %v, want the order's", ts.payments.expired)
+	}
+
+	// The customer pays through the URL issued before the amendment anyway,
+	// and the payment service reports it twice.
+	ts.payments.payments[orderID] = &proto.GetPaymentResponse{
+		Success:       true,
+		TransactionId: "tx-stale",
+		OrderId:       orderID,
+		Amount:        before.Float64(),
+		Status:        paymentStatusCaptured,
+	}
+	for i := 0; i < 2; i++ {
+		err := ts.UpdateOrderStatus(orderID, service(auth.ServicePayment), models.OrderStatusPaid)
+		if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+			t.Fatalf("UpdateOrderStatus(paid) error = %v, want a conflict", err)
+		}
+	}
+	if got := ts.order(orderID).Status; got != models.OrderStatusPaymentPending {
+		t.Fatalf("status = %s, want %s", got, models.OrderStatusPaymentPending)
+	}
+
+	refunds := ts.refundsFor(orderID)
+	if len(refunds) != 1 {
+		t.Fatalf("recorded %d refunds, want the stale payment refunded once", len(refunds))
+	}
+	stale := refunds[0]
+	if stale.Reason != models.RefundReasonStalePayment || stale.Amount != before || stale.Status != models.RefundStatusSucceeded {
+		t.Errorf("refund = %s %s %s, want a succeeded %s refund of %s", stale.Reason, stale.Amount, stale.Status, models.RefundReasonStalePayment, before)
+	}
+	if len(ts.payments.refunds) != 1 || ts.payments.refunds[0].TransactionId != "tx-stale" || ts.payments.refunds[0].Amount != nil {
+		t.Errorf("payment service refunds = %+v, want the whole of tx-stale", ts.payments.refunds)
+	}
+
+	amended := ts.order(orderID)
+	ts.payments.payments[orderID] = &proto.GetPaymentResponse{
+		Success:       true,
+		TransactionId: "tx-amended",
+		OrderId:       orderID,
+		Amount:        amended.GrandTotal().Float64(),
+		Status:        paymentStatusCaptured,
+	}
+	if err := ts.UpdateOrderStatus(orderID, service(auth.ServicePayment), models.OrderStatusPaid); err != nil {
+		t.Fatalf("UpdateOrderStatus(paid) with the amended amount: %v", err)
+	}
+	paid := ts.order(orderID)
+	if paid.Status != models.OrderStatusPaid || paid.RefundedTotal != 0 {
+		t.Errorf("order = %s refunded %s, want %s with nothing refunded", paid.Status, paid.RefundedTotal, models.OrderStatusPaid)
+	}
+
+	// Cancelling refunds the whole amended payment; the stale refund does
+	// not count against it.
+	if err := ts.UpdateOrderStatus(orderID, customer(customerID), models.OrderStatusCancelled); err != nil {
+		t.Fatalf("UpdateOrderStatus(cancelled): %v", err)
+	}
+	refunds = ts.refundsFor(orderID)
+	if len(refunds) != 2 || refunds[1].Amount != paid.GrandTotal() {
+		t.Errorf("refunds = %+v, want the amended total %s refunded", refunds, paid.GrandTotal())
+	}
+}
+
+func TestStalePaymentRefundThatFailsIsKeptForRetry(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 1))
+
+	ts.payments.payments[orderID] = &proto.GetPaymentResponse{
+		Success:       true,
+		TransactionId: "tx-stale",
+		OrderId:       orderID,
+		Amount:        1.00,
+		Status:        paymentStatusCaptured,
+	}
+	ts.payments.refundErr = stderrors.New("provider unavailable")
+
+	err := ts.UpdateOrderStatus(orderID, service(auth.ServicePayment), models.OrderStatusPaid)
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("UpdateOrderStatus(paid) error = %v, want a conflict", err)
+	}
+
+	refunds := ts.refundsFor(orderID)
+	if len(refunds) != 1 || refunds[0].Status != models.RefundStatusFailed || refunds[0].Amount != 100 {
+		t.Fatalf("refunds = %+v, want a failed refund of 1.00 owed to the customer", refunds)
+	}
+
+	ts.payments.refundErr = nil
+	retried, err := ts.RetryRefund(refunds[0].ID.String(), staff(auth.RoleAdmin))
+	if err != nil {
+		t.Fatalf("RetryRefund: %v", err)
+	}
+	if retried.Status != models.RefundStatusSucceeded || len(ts.payments.refunds) != 1 || ts.payments.refunds[0].TransactionId != "tx-stale" {
+		t.Errorf("retried refund = %s, payment service refunds = %+v; want tx-stale refunded", retried.Status, ts.payments.refunds)
+	}
+}
+
+func TestAmendOrderIsRefusedWhenPaymentURLsCannotBeExpired(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 1))
+	ts.payments.expireErr = stderrors.New("connection refused")
+
+	if _, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{{ID: ts.items(orderID)[0].ID, Quantity: 3}}); err == nil {
+		t.Fatal("AmendOrder succeeded, want an error")
+	}
+	if got := ts.items(orderID)[0].Quantity; got != 1 {
+		t.Errorf("quantity = %d, want the order unchanged", got)
+	}
+}
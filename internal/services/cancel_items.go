@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// CancelItemRequest is a quantity of one order item to cancel.
+type CancelItemRequest struct {
+	ItemID   uuid.UUID
+	Quantity int
+}
+
+// CancelOrderItems drops quantities from an order that has not shipped. The
+// order is repriced with the rules used when it was placed, the released
+// stock is returned and, if the order was paid, the difference is refunded.
+// An order awaiting payment has its payment URLs expired first and gets one
+// for its new total instead. It returns the refund or the payment URL, if
+// any.
+func (s *orderService) CancelOrderItems(orderID string, caller *auth.Principal, items []CancelItemRequest) (*models.Refund, string, error) {
+	if len(items) == 0 {
+		return nil, "", errors.NewValidationError("items", "At least one item is required")
+	}
+
+	fields := map[string]string{}
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			fields[fmt.Sprintf("items[%d].quantity", i)] = "Quantity must be greater than zero"
+		}
+	}
+	if len(fields) > 0 {
+		return nil, "", errors.NewValidationErrors(fields)
+	}
+
+	// The payment URLs issued for an unpaid order are for its current total.
+	order, _, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !s.policy.CanAccessOrder(caller, rbac.RPCCancelOrderItems, order.CustomerID.String()) {
+		return nil, "", errors.NewAuthError("You are not authorized to change this order")
+	}
+	if order.Status == models.OrderStatusPaymentPending {
+		if err := s.expirePaymentURLs(order); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var restock []models.OrderItem
+	var refund *models.Refund
+	err = s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		var orderItems *[]models.OrderItem
+		var err error
+		order, orderItems, err = repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if !s.policy.CanAccessOrder(caller, rbac.RPCCancelOrderItems, order.CustomerID.String()) {
+			return errors.NewAuthError("You are not authorized to change this order")
+		}
+
+		switch order.Status {
+		case models.OrderStatusPending, models.OrderStatusPaymentPending, models.OrderStatusPaid, models.OrderStatusApproved:
+		default:
+			return errors.NewConflictError("Items can only be cancelled before the order ships")
+		}
+
+		paid := order.Status == models.OrderStatusPaid || order.Status == models.OrderStatusApproved
+		if paid && !s.partialRefunds {
+			return errors.NewConflictError("Items of a paid order cannot be cancelled while partial refunds are disabled; cancel the order instead")
+		}
+
+		var released []models.OrderItem
+		remaining := *orderItems
+		for i, request := range items {
+			field := fmt.Sprintf("items[%d]", i)
+
+			index := -1
+			for j := range remaining {
+				if remaining[j].ID == request.ItemID {
+					index = j
+					break
+				}
+			}
+			if index < 0 {
+				fields[field+".item_id"] = "Item is not part of this order"
+				continue
+			}
+
+			if request.Quantity > remaining[index].Quantity {
+				fields[field+".quantity"] = fmt.Sprintf("Only %d left on this line", remaining[index].Quantity)
+				continue
+			}
+			remaining[index].Quantity -= request.Quantity
+			remaining[index].CancelledQuantity += request.Quantity
+
+			item := remaining[index]
+			item.Quantity = request.Quantity
+			released = append(released, item)
+		}
+		if len(fields) > 0 {
+			return errors.NewValidationErrors(fields)
+		}
+
+		if len(activeItems(remaining)) == 0 {
+			return errors.NewBadRequestError("Cancelling every item cancels the order; cancel the order instead")
+		}
+
+		reservations, err := repos.StockReservations.LockReservationsByOrderID(orderID)
+		if err != nil {
+			return err
+		}
+		if err := checkNotDeducting(reservations); err != nil {
+			return err
+		}
+
+		for _, item := range released {
+			if err := repos.OrderItems.CancelQuantity(item.ID.String(), item.Quantity); err != nil {
+				return err
+			}
+
+			reservation := findReservation(reservations, item.ID)
+			if reservation != nil {
+				if err := repos.StockReservations.AdjustQuantity(reservation.ID.String(), -item.Quantity); err != nil {
+					return err
+				}
+			}
+
+			// Held stock is released by shrinking the reservation; stock
+			// already deducted has to be given back.
+			if len(reservations) == 0 || (reservation != nil && reservation.Status == models.ReservationStatusDeducted) {
+				restock = append(restock, item)
+			}
+		}
+
+		previousTotal := order.GrandTotal()
+		taxLines, err := s.repriceOrder(order, remaining)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Orders.UpdateTotals(order); err != nil {
+			return err
+		}
+		if err := repos.OrderTaxLines.ReplaceTaxLines(orderID, taxLines); err != nil {
+			return err
+		}
+
+		event, err := outbox.NewOrderItemsCancelledEvent(order, released)
+		if err != nil {
+			return err
+		}
+		if err := repos.OrderEvents.AddEvent(event); err != nil {
+			return err
+		}
+
+		if !paid {
+			return nil
+		}
+
+		amount := previousTotal - order.GrandTotal()
+		if amount <= 0 {
+			return nil
+		}
+
+		refund = &models.Refund{
+			OrderID:  order.ID,
+			Reason:   models.RefundReasonItemsCancelled,
+			Amount:   amount,
+			Currency: order.Currency,
+			Status:   models.RefundStatusPending,
+		}
+		return repos.Refunds.CreateRefund(refund)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx := context.Background()
+	s.restockItems(ctx, orderID, restock, "order_cancelled")
+
+	if refund != nil {
+		if err := s.processRefund(ctx, refund, order.CustomerID.String()); err != nil {
+			utils.Error("Failed to record refund outcome", map[string]interface{}{
+				"order_id":  orderID,
+				"refund_id": refund.ID.String(),
+				"error":     err.Error(),
+			})
+		}
+	}
+
+	paymentURL := ""
+	if order.Status == models.OrderStatusPaymentPending {
+		// The items are cancelled either way; without a URL the customer
+		// asks for one with GenerateNewPaymentUrl.
+		paymentURL, err = s.replacePaymentURL(orderID)
+		if err != nil {
+			utils.Error("Failed to issue payment URL after cancelling items", map[string]interface{}{
+				"order_id": orderID,
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	return refund, paymentURL, nil
+}
+
+// repriceOrder recalculates the subtotal, shipping and tax of an order from
+// its current items, and whether it still needs a prescription. Tax uses
+// the rates that were in force when the order was placed. It returns the
+// order's new tax lines.
+func (s *orderService) repriceOrder(order *models.Order, orderItems []models.OrderItem) ([]models.OrderTaxLine, error) {
+	items := activeItems(orderItems)
+
+	subtotal := money.Amount(0)
+	for _, item := range items {
+		subtotal += item.Price.Mul(item.Quantity)
+	}
+
+	quote, err := s.shippingCalculator.Quote(shippingQuoteRequest(order.ShippingMethod, order.ShippingAddress.Region, subtotal, items))
+	if err != nil {
+		return nil, err
+	}
+
+	lines, taxTotal, err := s.taxCalculator.Calculate(order.ShippingAddress.Region, taxItems(items), order.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Subtotal = subtotal
+	order.ShippingMethod = quote.Method
+	order.ShippingCost = quote.Cost
+	order.TaxTotal = taxTotal
+	order.RequiresPrescription = len(prescriptionLines(items)) > 0
+
+	return orderTaxLines(order.ID, items, lines), nil
+}
+
+// activeItems returns the items that still have a quantity on order.
+func activeItems(orderItems []models.OrderItem) []models.OrderItem {
+	var items []models.OrderItem
+	for _, item := range orderItems {
+		if item.Quantity > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func findItem(orderItems []models.OrderItem, itemID uuid.UUID) *models.OrderItem {
+	for i := range orderItems {
+		if orderItems[i].ID == itemID {
+			return &orderItems[i]
+		}
+	}
+	return nil
+}
+
+func findReservation(reservations []models.StockReservation, orderItemID uuid.UUID) *models.StockReservation {
+	for i := range reservations {
+		if reservations[i].OrderItemID == orderItemID {
+			return &reservations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCancelOrderItemsWritesEvent(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 3))
+	item := ts.items(orderID)[0]
+
+	refund, paymentURL, err := ts.CancelOrderItems(orderID, customer(customerID), []CancelItemRequest{{ItemID: item.ID, Quantity: 1}})
+	if err != nil {
+		t.Fatalf("CancelOrderItems: %v", err)
+	}
+	if refund != nil {
+		t.Errorf("refund = %+v, want none for an unpaid order", refund)
+	}
+	if paymentURL != "https://pay.example/"+orderID {
+		t.Errorf("payment URL = %q, want a new one for the new total", paymentURL)
+	}
+	if len(ts.keys.cleared) != 1 || ts.keys.cleared[0].String() != orderID {
+		t.Errorf("cleared payment URLs of %v, want the order's", ts.keys.cleared)
+	}
+
+	if got := ts.items(orderID)[0].Quantity; got != 2 {
+		t.Errorf("quantity = %d, want 2", got)
+	}
+	if got := ts.order(orderID).Subtotal; got != 2000 {
+		t.Errorf("subtotal = %d, want 2000", got)
+	}
+
+	types := ts.eventTypes(orderID)
+	if len(types) != 2 || types[1] != models.OrderEventItemsCancelled {
+		t.Errorf("events = %v, want %s after %s", types, models.OrderEventItemsCancelled, models.OrderEventPlaced)
+	}
+}
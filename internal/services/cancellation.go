@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+// cancellation is the work left to do once an order has been cancelled and
+// the transaction has committed.
+type cancellation struct {
+	order   *models.Order
+	restock []models.OrderItem
+	refund  *models.Refund
+}
+
+// cancelOrder cancels the order for the given reason inside the transaction,
+// recording changedBy in its status history. When the order had been paid,
+// a pending refund of everything not refunded yet is recorded in the same
+// transaction so it survives a crash before the payment service is called.
+func cancelOrder(repos repositories.TxRepositories, orderID string, actor statemachine.Actor, changedBy, reason string) (*cancellation, error) {
+	if err := repos.Orders.LockOrder(orderID); err != nil {
+		return nil, err
+	}
+
+	order, orderItems, err := repos.Orders.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := repos.StockReservations.LockReservationsByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotDeducting(reservations); err != nil {
+		return nil, err
+	}
+
+	// Entering cancelled releases the stock that is only held.
+	if err := repos.Orders.UpdateOrderStatus(orderID, models.OrderStatusCancelled, actor, changedBy, reason); err != nil {
+		return nil, err
+	}
+	if err := repos.Orders.SetCancellationReason(orderID, reason); err != nil {
+		return nil, err
+	}
+
+	c := &cancellation{order: order, restock: deductedItems(*orderItems, reservations)}
+
+	// An order only becomes paid once the payment service has captured the
+	// payment, so earlier statuses have nothing to refund.
+	if order.Status != models.OrderStatusPaid && order.Status != models.OrderStatusApproved {
+		return c, nil
+	}
+
+	// Earlier item cancellations and returns have already been taken off the
+	// grand total or refunded separately, so the refund is what was paid less
+	// every refund recorded so far, including those still pending or failed.
+	// Orders paid before the paid total was recorded fall back to the grand
+	// total.
+	paid := order.PaidTotal
+	if paid == 0 {
+		paid = order.GrandTotal()
+	}
+	refunded, err := repos.Refunds.RefundedAmount(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := paid - refunded
+	if amount <= 0 {
+		return c, nil
+	}
+
+	c.refund = &models.Refund{
+		OrderID:  order.ID,
+		Reason:   models.RefundReasonOrderCancelled,
+		Amount:   amount,
+		Currency: order.Currency,
+		Status:   models.RefundStatusPending,
+	}
+	if err := repos.Refunds.CreateRefund(c.refund); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// completeCancellation returns the stock deducted for the cancelled order and
+// refunds it. Failures are logged and recorded; they do not undo the
+// cancellation.
+func (s *orderService) completeCancellation(ctx context.Context, c *cancellation) {
+	s.restockItems(ctx, c.order.ID.String(), c.restock, "order_cancelled")
+
+	if c.refund == nil {
+		return
+	}
+
+	if err := s.processRefund(ctx, c.refund, c.order.CustomerID.String()); err != nil {
+		utils.Error("Failed to record refund outcome", map[string]interface{}{
+			"order_id":  c.order.ID.String(),
+			"refund_id": c.refund.ID.String(),
+			"error":     err.Error(),
+		})
+	}
+}
+
+// deductedItems returns copies of the order items holding the quantity that
+// was taken from the product service's stock and has to be returned. Orders
+// without reservations were placed when stock was deducted immediately.
+func deductedItems(orderItems []models.OrderItem, reservations []models.StockReservation) []models.OrderItem {
+	if len(reservations) == 0 {
+		return orderItems
+	}
+
+	var items []models.OrderItem
+	for _, reservation := range reservations {
+		if reservation.Status != models.ReservationStatusDeducted {
+			continue
+		}
+		for _, item := range orderItems {
+			if item.ID == reservation.OrderItemID {
+				item.Quantity = reservation.Quantity
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// checkNotDeducting fails while the reconcile loop is deducting stock for
+// one of the reservations, because it is not known yet whether that stock
+// has to be returned.
+func checkNotDeducting(reservations []models.StockReservation) error {
+	for _, reservation := range reservations {
+		switch reservation.Status {
+		case models.ReservationStatusDeducting:
+			return errors.NewConflictError("Stock for this order is being deducted, please try again")
+		case models.ReservationStatusNeedsReview:
+			return errors.NewConflictError("Stock for this order is awaiting review by an operator")
+		}
+	}
+	return nil
+}
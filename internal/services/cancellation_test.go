@@ -0,0 +1,124 @@
+package services
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// refundsFor returns the refunds recorded for the order, oldest first.
+func (ts *testService) refundsFor(orderID string) []models.Refund {
+	var refunds []models.Refund
+	for _, refund := range ts.store.refunds {
+		if refund.OrderID.String() == orderID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds
+}
+
+func TestCancelOrderAfterPartialCancellationRefundsTheRest(t *testing.T) {
+	vitamins := testProduct("Vitamin D", 10.00, 10)
+	ibuprofen := testProduct("Ibuprofen", 70.00, 10)
+	ts := newTestService(vitamins, ibuprofen)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(vitamins, 3), testItem(ibuprofen, 1))
+	ts.payTestOrder(t, orderID)
+	paid := ts.order(orderID).PaidTotal
+
+	var item models.OrderItem
+	for _, i := range ts.items(orderID) {
+		if i.ProductID.String() == vitamins.Id {
+			item = i
+		}
+	}
+	partial, _, err := ts.CancelOrderItems(orderID, customer(customerID), []CancelItemRequest{{ItemID: item.ID, Quantity: 3}})
+	if err != nil {
+		t.Fatalf("CancelOrderItems: %v", err)
+	}
+	if partial == nil || partial.Amount <= 0 {
+		t.Fatalf("partial refund = %+v, want one", partial)
+	}
+
+	if err := ts.UpdateOrderStatus(orderID, customer(customerID), models.OrderStatusCancelled); err != nil {
+		t.Fatalf("UpdateOrderStatus(cancelled): %v", err)
+	}
+
+	refunds := ts.refundsFor(orderID)
+	if len(refunds) != 2 {
+		t.Fatalf("recorded %d refunds, want 2", len(refunds))
+	}
+	if want := paid - partial.Amount; refunds[1].Amount != want {
+		t.Errorf("cancellation refunded %s, want %s of %s paid", refunds[1].Amount, want, paid)
+	}
+
+	var total money.Amount
+	for _, refund := range refunds {
+		if refund.Status != models.RefundStatusSucceeded {
+			t.Errorf("refund %s status = %s, want %s", refund.ID, refund.Status, models.RefundStatusSucceeded)
+		}
+		total += refund.Amount
+	}
+	if total != paid {
+		t.Errorf("refunded %s in total, want the %s paid", total, paid)
+	}
+}
+
+func TestCancelOrderCountsFailedRefunds(t *testing.T) {
+	vitamins := testProduct("Vitamin D", 10.00, 10)
+	ibuprofen := testProduct("Ibuprofen", 70.00, 10)
+	ts := newTestService(vitamins, ibuprofen)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(vitamins, 3), testItem(ibuprofen, 1))
+	ts.payTestOrder(t, orderID)
+	paid := ts.order(orderID).PaidTotal
+
+	// The partial refund fails and stays retryable, so the cancellation must
+	// not refund that part again.
+	ts.payments.refundErr = stderrors.New("payment service unavailable")
+	var item models.OrderItem
+	for _, i := range ts.items(orderID) {
+		if i.ProductID.String() == vitamins.Id {
+			item = i
+		}
+	}
+	partial, _, err := ts.CancelOrderItems(orderID, customer(customerID), []CancelItemRequest{{ItemID: item.ID, Quantity: 3}})
+	if err != nil {
+		t.Fatalf("CancelOrderItems: %v", err)
+	}
+	ts.payments.refundErr = nil
+
+	if err := ts.UpdateOrderStatus(orderID, staff(auth.RoleSupport), models.OrderStatusCancelled); err != nil {
+		t.Fatalf("UpdateOrderStatus(cancelled): %v", err)
+	}
+
+	refunds := ts.refundsFor(orderID)
+	if len(refunds) != 2 || refunds[0].Status != models.RefundStatusFailed {
+		t.Fatalf("refunds = %+v, want the failed partial refund and the cancellation refund", refunds)
+	}
+	if want := paid - partial.Amount; refunds[1].Amount != want {
+		t.Errorf("cancellation refunded %s, want %s", refunds[1].Amount, want)
+	}
+}
+
+func TestCancelOrderRefusedWhileStockIsBeingDeducted(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 2))
+	ts.payTestOrder(t, orderID)
+	ts.store.reservations[0].Status = models.ReservationStatusDeducting
+
+	err := ts.UpdateOrderStatus(orderID, customer(customerID), models.OrderStatusCancelled)
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("UpdateOrderStatus(cancelled) error = %v, want a conflict", err)
+	}
+	if got := ts.order(orderID).Status; got != models.OrderStatusPaid {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusPaid)
+	}
+}
@@ -0,0 +1,1006 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/address"
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/inventory"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/shipping"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/internal/tax"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeProductClient serves products from memory and applies stock updates to
+// them.
+type fakeProductClient struct {
+	proto.ProductServiceClient
+
+	mu           sync.Mutex
+	products     map[string]*proto.Product
+	stockUpdates []*proto.UpdateStockRequest
+}
+
+func newFakeProductClient(products ...*proto.Product) *fakeProductClient {
+	c := &fakeProductClient{products: map[string]*proto.Product{}}
+	for _, product := range products {
+		c.products[product.Id] = product
+	}
+	return c
+}
+
+func (c *fakeProductClient) GetProduct(ctx context.Context, in *proto.GetProductRequest, opts ...grpc.CallOption) (*proto.GetProductResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	product, ok := c.products[in.ProductId]
+	if !ok {
+		return &proto.GetProductResponse{
+			Success: false,
+			Error:   &proto.Error{Type: string(errors.NotFoundError), Message: "Product not found"},
+		}, nil
+	}
+
+	copied := *product
+	return &proto.GetProductResponse{Success: true, Product: &copied}, nil
+}
+
+func (c *fakeProductClient) UpdateStock(ctx context.Context, in *proto.UpdateStockRequest, opts ...grpc.CallOption) (*proto.UpdateStockResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stockUpdates = append(c.stockUpdates, in)
+	if product, ok := c.products[in.ProductId]; ok {
+		product.Stock += in.QuantityChange
+	}
+	return &proto.UpdateStockResponse{Success: true}, nil
+}
+
+// fakePaymentClient hands out payment URLs and records refunds and the
+// orders whose payment URLs were expired. Payments are keyed by order ID.
+type fakePaymentClient struct {
+	proto.PaymentServiceClient
+
+	mu        sync.Mutex
+	urlErr    error
+	urlFail   bool
+	refundErr error
+	expireErr error
+	payments  map[string]*proto.GetPaymentResponse
+	refunds   []*proto.RefundPaymentRequest
+	expired   []string
+}
+
+func newFakePaymentClient() *fakePaymentClient {
+	return &fakePaymentClient{payments: map[string]*proto.GetPaymentResponse{}}
+}
+
+func (c *fakePaymentClient) GeneratePaymentURL(ctx context.Context, in *proto.GeneratePaymentURLRequest, opts ...grpc.CallOption) (*proto.GeneratePaymentURLResponse, error) {
+	if c.urlErr != nil {
+		return nil, c.urlErr
+	}
+	if c.urlFail {
+		return &proto.GeneratePaymentURLResponse{
+			Success: false,
+			Error:   &proto.Error{Type: string(errors.InternalError), Message: "Payment provider unavailable"},
+		}, nil
+	}
+	return &proto.GeneratePaymentURLResponse{Success: true, Url: "https://pay.example/" + in.OrderId}, nil
+}
+
+func (c *fakePaymentClient) GetPaymentByOrderID(ctx context.Context, in *proto.GetPaymentByOrderIDRequest, opts ...grpc.CallOption) (*proto.GetPaymentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	payment, ok := c.payments[in.OrderId]
+	if !ok {
+		return &proto.GetPaymentResponse{
+			Success: false,
+			Error:   &proto.Error{Type: string(errors.NotFoundError), Message: "Payment not found"},
+		}, nil
+	}
+	return payment, nil
+}
+
+func (c *fakePaymentClient) GetPaymentByTransactionID(ctx context.Context, in *proto.GetPaymentByTransactionIDRequest, opts ...grpc.CallOption) (*proto.GetPaymentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, payment := range c.payments {
+		if payment.TransactionId == in.TransactionId {
+			return payment, nil
+		}
+	}
+	return &proto.GetPaymentResponse{
+		Success: false,
+		Error:   &proto.Error{Type: string(errors.NotFoundError), Message: "Payment not found"},
+	}, nil
+}
+
+func (c *fakePaymentClient) ExpirePaymentURLs(ctx context.Context, in *proto.ExpirePaymentURLsRequest, opts ...grpc.CallOption) (*proto.ExpirePaymentURLsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expireErr != nil {
+		return nil, c.expireErr
+	}
+	c.expired = append(c.expired, in.OrderId)
+	return &proto.ExpirePaymentURLsResponse{Success: true}, nil
+}
+
+func (c *fakePaymentClient) RefundPayment(ctx context.Context, in *proto.RefundPaymentRequest, opts ...grpc.CallOption) (*proto.RefundPaymentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refundErr != nil {
+		return nil, c.refundErr
+	}
+	c.refunds = append(c.refunds, in)
+	return &proto.RefundPaymentResponse{Success: true}, nil
+}
+
+// memStore stands in for the database behind the repositories.
+type memStore struct {
+	stateMachine statemachine.OrderStateMachine
+
+	orders       map[uuid.UUID]models.Order
+	items        []models.OrderItem
+	taxLines     []models.OrderTaxLine
+	reservations []models.StockReservation
+	events       []models.OrderEvent
+	refunds      []models.Refund
+	shipments    []models.Shipment
+	returns      []models.OrderReturn
+	history      []models.OrderStatusChange
+
+	// access logs the orders the last transaction locked and read, e.g.
+	// "lock <id>" and "read <id>", in order.
+	access []string
+
+	// fail makes the named repository method return the error.
+	// UpdateOrderStatus also fails for "UpdateOrderStatus <order id>".
+	fail map[string]error
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		stateMachine: statemachine.NewOrderStateMachine(),
+		orders:       map[uuid.UUID]models.Order{},
+		fail:         map[string]error{},
+	}
+}
+
+func (s *memStore) clone() *memStore {
+	c := *s
+	c.orders = make(map[uuid.UUID]models.Order, len(s.orders))
+	for id, order := range s.orders {
+		c.orders[id] = order
+	}
+	c.items = append([]models.OrderItem(nil), s.items...)
+	c.taxLines = append([]models.OrderTaxLine(nil), s.taxLines...)
+	c.reservations = append([]models.StockReservation(nil), s.reservations...)
+	c.events = append([]models.OrderEvent(nil), s.events...)
+	c.refunds = append([]models.Refund(nil), s.refunds...)
+	c.shipments = append([]models.Shipment(nil), s.shipments...)
+	c.returns = append([]models.OrderReturn(nil), s.returns...)
+	c.history = append([]models.OrderStatusChange(nil), s.history...)
+	c.access = nil
+	return &c
+}
+
+func (s *memStore) repos() repositories.TxRepositories {
+	return repositories.TxRepositories{
+		Orders:            &memOrders{memStore: s},
+		OrderItems:        &memOrderItems{memStore: s},
+		OrderEvents:       &memOrderEvents{memStore: s},
+		OrderTaxLines:     &memTaxLines{memStore: s},
+		StockReservations: &memReservations{memStore: s},
+		Refunds:           &memRefunds{memStore: s},
+		Shipments:         &memShipments{memStore: s},
+		Returns:           &memReturns{memStore: s},
+	}
+}
+
+func (s *memStore) failure(method string) error {
+	return s.fail[method]
+}
+
+// memUnitOfWork runs fn against a copy of the store and keeps the copy only
+// when fn succeeds, like a transaction.
+type memUnitOfWork struct {
+	store *memStore
+}
+
+func (u *memUnitOfWork) WithTx(fn func(repos repositories.TxRepositories) error) error {
+	tx := u.store.clone()
+	if err := fn(tx.repos()); err != nil {
+		if _, ok := errors.IsAppError(err); ok {
+			return err
+		}
+		return errors.NewInternalError(err)
+	}
+
+	*u.store = *tx
+	return nil
+}
+
+type memOrders struct {
+	repositories.OrderRepository
+	*memStore
+}
+
+func (r *memOrders) CreateOrder(order *models.Order) (string, error) {
+	if err := r.failure("CreateOrder"); err != nil {
+		return "", err
+	}
+
+	order.ID = uuid.New()
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+	r.orders[order.ID] = *order
+	r.history = append(r.history, models.OrderStatusChange{OrderID: order.ID, ToStatus: order.Status})
+	return order.ID.String(), nil
+}
+
+func (r *memOrders) GetOrderByIdempotencyKey(customerID uuid.UUID, key string) (*models.Order, error) {
+	var latest *models.Order
+	for _, order := range r.orders {
+		if order.CustomerID != customerID || order.IdempotencyKey == nil || *order.IdempotencyKey != key || order.Status == models.OrderStatusFailed {
+			continue
+		}
+		if latest == nil || order.CreatedAt.After(latest.CreatedAt) {
+			copied := order
+			latest = &copied
+		}
+	}
+	if latest == nil {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Order with idempotency key '%s' not found", key))
+	}
+	return latest, nil
+}
+
+func (r *memOrders) find(orderID string) (models.Order, error) {
+	id, err := uuid.Parse(orderID)
+	if err != nil {
+		return models.Order{}, errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
+	}
+	order, ok := r.orders[id]
+	if !ok {
+		return models.Order{}, errors.NewNotFoundError(fmt.Sprintf("Order with ID '%s' not found", orderID))
+	}
+	return order, nil
+}
+
+func (r *memOrders) GetOrderByID(orderID string) (*models.Order, *[]models.OrderItem, error) {
+	r.access = append(r.access, "read "+orderID)
+
+	order, err := r.find(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order.TaxLines = nil
+	for _, line := range r.taxLines {
+		if line.OrderID == order.ID {
+			order.TaxLines = append(order.TaxLines, line)
+		}
+	}
+
+	order.Shipments = nil
+	for _, shipment := range r.shipments {
+		if shipment.OrderID == order.ID {
+			order.Shipments = append(order.Shipments, shipment)
+		}
+	}
+
+	order.Returns = nil
+	for _, orderReturn := range r.returns {
+		if orderReturn.OrderID == order.ID {
+			order.Returns = append(order.Returns, orderReturn)
+		}
+	}
+
+	items := []models.OrderItem{}
+	for _, item := range r.items {
+		if item.OrderID == order.ID {
+			items = append(items, item)
+		}
+	}
+	return &order, &items, nil
+}
+
+// UpdateOrderStatus checks the transition with the real state machine and
+// applies what the stock reservation hooks do in the database.
+func (r *memOrders) UpdateOrderStatus(orderID string, status string, actor statemachine.Actor, changedBy, reason string) error {
+	if err := r.failure("UpdateOrderStatus"); err != nil {
+		return err
+	}
+	if err := r.failure("UpdateOrderStatus " + orderID); err != nil {
+		return err
+	}
+
+	order, err := r.find(orderID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.stateMachine.CanTransition(order.Status, status); err != nil {
+		return err
+	}
+
+	from := order.Status
+	order.Status = status
+	if status == models.OrderStatusPaid {
+		order.PaidTotal = order.GrandTotal()
+	}
+	r.orders[order.ID] = order
+	r.history = append(r.history, models.OrderStatusChange{OrderID: order.ID, FromStatus: &from, ToStatus: status, Actor: changedBy, ActorRole: string(actor)})
+
+	for i := range r.reservations {
+		reservation := &r.reservations[i]
+		if reservation.OrderID != order.ID {
+			continue
+		}
+		switch status {
+		case models.OrderStatusPaid:
+			if reservation.Status == models.ReservationStatusHeld && reservation.Quantity > 0 {
+				reservation.Status = models.ReservationStatusCommitted
+			}
+		case models.OrderStatusCancelled, models.OrderStatusFailed:
+			if reservation.Status == models.ReservationStatusHeld || reservation.Status == models.ReservationStatusCommitted {
+				reservation.Status = models.ReservationStatusReleased
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *memOrders) LockOrder(orderID string) error {
+	if _, err := r.find(orderID); err != nil {
+		return err
+	}
+	r.access = append(r.access, "lock "+orderID)
+	return nil
+}
+
+func (r *memOrders) AddRefundedAmount(orderID string, amount money.Amount) error {
+	order, err := r.find(orderID)
+	if err != nil {
+		return err
+	}
+	order.RefundedTotal += amount
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *memOrders) UpdateTotals(order *models.Order) error {
+	stored, err := r.find(order.ID.String())
+	if err != nil {
+		return err
+	}
+	stored.Subtotal = order.Subtotal
+	stored.ShippingMethod = order.ShippingMethod
+	stored.ShippingCost = order.ShippingCost
+	stored.TaxTotal = order.TaxTotal
+	stored.RequiresPrescription = order.RequiresPrescription
+	r.orders[stored.ID] = stored
+	return nil
+}
+
+func (r *memOrders) SetCancellationReason(orderID, reason string) error {
+	order, err := r.find(orderID)
+	if err != nil {
+		return err
+	}
+	order.CancellationReason = &reason
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *memOrders) UpdateShippingAddress(orderID string, shippingAddress models.Address) error {
+	order, err := r.find(orderID)
+	if err != nil {
+		return err
+	}
+	order.ShippingAddress = shippingAddress
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *memOrders) ListExpiredPaymentPending(createdBefore, failedBefore time.Time, limit int) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if order.ExpiryFailedAt != nil && !order.ExpiryFailedAt.Before(failedBefore) {
+			continue
+		}
+		if order.Status == models.OrderStatusPaymentPending && order.CreatedAt.Before(createdBefore) {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		a, b := orders[i].ExpiryFailedAt, orders[j].ExpiryFailedAt
+		if (a == nil) != (b == nil) {
+			return a == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (r *memOrders) MarkExpiryFailed(orderID string, at time.Time) error {
+	order, err := r.find(orderID)
+	if err != nil {
+		return err
+	}
+	order.ExpiryFailedAt = &at
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *memOrders) ClaimPaymentPending(orderID string) (bool, error) {
+	order, err := r.find(orderID)
+	if err != nil {
+		return false, nil
+	}
+	return order.Status == models.OrderStatusPaymentPending, nil
+}
+
+type memOrderItems struct {
+	repositories.OrderItemRepository
+	*memStore
+}
+
+func (r *memOrderItems) AddOrderItem(item *models.OrderItem) error {
+	if err := r.failure("AddOrderItem"); err != nil {
+		return err
+	}
+
+	item.ID = uuid.New()
+	if item.Prescription != nil {
+		item.Prescription.ID = uuid.New()
+		item.PrescriptionID = &item.Prescription.ID
+	}
+	r.items = append(r.items, *item)
+	return nil
+}
+
+func (r *memOrderItems) GetItemsByOrderID(orderID string) ([]models.OrderItem, error) {
+	var items []models.OrderItem
+	for _, item := range r.items {
+		if item.OrderID.String() == orderID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (r *memOrderItems) CancelQuantity(itemID string, quantity int) error {
+	for i := range r.items {
+		if r.items[i].ID.String() == itemID && r.items[i].Quantity >= quantity {
+			r.items[i].Quantity -= quantity
+			r.items[i].CancelledQuantity += quantity
+			return nil
+		}
+	}
+	return errors.NewConflictError(fmt.Sprintf("Cannot cancel %d of order item '%s'", quantity, itemID))
+}
+
+func (r *memOrderItems) UpdateQuantity(itemID string, quantity int) error {
+	for i := range r.items {
+		if r.items[i].ID.String() == itemID {
+			r.items[i].Quantity = quantity
+			return nil
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Order item with ID '%s' not found", itemID))
+}
+
+type memOrderEvents struct {
+	repositories.OrderEventRepository
+	*memStore
+}
+
+func (r *memOrderEvents) AddEvent(event *models.OrderEvent) error {
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+type memTaxLines struct {
+	repositories.OrderTaxLineRepository
+	*memStore
+}
+
+func (r *memTaxLines) AddTaxLines(lines []models.OrderTaxLine) error {
+	r.taxLines = append(r.taxLines, lines...)
+	return nil
+}
+
+func (r *memTaxLines) ReplaceTaxLines(orderID string, lines []models.OrderTaxLine) error {
+	kept := r.taxLines[:0:0]
+	for _, line := range r.taxLines {
+		if line.OrderID.String() != orderID {
+			kept = append(kept, line)
+		}
+	}
+	r.taxLines = append(kept, lines...)
+	return nil
+}
+
+type memReservations struct {
+	repositories.StockReservationRepository
+	*memStore
+}
+
+func (r *memReservations) LockProduct(productID string) error {
+	return nil
+}
+
+func (r *memReservations) ReservedQuantity(productID string) (int, error) {
+	quantity := 0
+	for _, reservation := range r.reservations {
+		if reservation.ProductID.String() == productID &&
+			(reservation.Status == models.ReservationStatusHeld || reservation.Status == models.ReservationStatusCommitted || reservation.Status == models.ReservationStatusDeducting) {
+			quantity += reservation.Quantity
+		}
+	}
+	return quantity, nil
+}
+
+func (r *memReservations) CreateReservation(reservation *models.StockReservation) error {
+	reservation.ID = uuid.New()
+	r.reservations = append(r.reservations, *reservation)
+	return nil
+}
+
+func (r *memReservations) LockReservationsByOrderID(orderID string) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	for _, reservation := range r.reservations {
+		if reservation.OrderID.String() == orderID {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return reservations, nil
+}
+
+func (r *memReservations) AdjustQuantity(reservationID string, delta int) error {
+	for i := range r.reservations {
+		if r.reservations[i].ID.String() == reservationID && r.reservations[i].Quantity+delta >= 0 {
+			r.reservations[i].Quantity += delta
+			return nil
+		}
+	}
+	return errors.NewConflictError(fmt.Sprintf("Cannot change stock reservation '%s' by %d", reservationID, delta))
+}
+
+func (r *memReservations) Renew(reservationID string, expiresAt time.Time) error {
+	for i := range r.reservations {
+		if r.reservations[i].ID.String() == reservationID && r.reservations[i].Status == models.ReservationStatusReleased {
+			r.reservations[i].Status = models.ReservationStatusHeld
+			r.reservations[i].ExpiresAt = expiresAt
+			return nil
+		}
+	}
+	return errors.NewConflictError(fmt.Sprintf("Stock reservation '%s' is not released", reservationID))
+}
+
+type memRefunds struct {
+	repositories.RefundRepository
+	*memStore
+}
+
+func (r *memRefunds) CreateRefund(refund *models.Refund) error {
+	refund.ID = uuid.New()
+	r.refunds = append(r.refunds, *refund)
+	return nil
+}
+
+func (r *memRefunds) find(refundID string) (*models.Refund, error) {
+	for i := range r.refunds {
+		if r.refunds[i].ID.String() == refundID {
+			return &r.refunds[i], nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refundID))
+}
+
+func (r *memRefunds) GetRefundByID(refundID string) (*models.Refund, error) {
+	refund, err := r.find(refundID)
+	if err != nil {
+		return nil, err
+	}
+	copied := *refund
+	return &copied, nil
+}
+
+func (r *memRefunds) GetRefundByTransactionID(transactionID string) (*models.Refund, error) {
+	for _, refund := range r.refunds {
+		if refund.TransactionID != nil && *refund.TransactionID == transactionID {
+			copied := refund
+			return &copied, nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Refund of transaction '%s' not found", transactionID))
+}
+
+func (r *memRefunds) MarkSucceeded(refundID, transactionID string) error {
+	refund, err := r.find(refundID)
+	if err != nil {
+		return err
+	}
+	refund.Status = models.RefundStatusSucceeded
+	refund.TransactionID = &transactionID
+	refund.Attempts++
+	return nil
+}
+
+func (r *memRefunds) MarkFailed(refundID, reason string) error {
+	refund, err := r.find(refundID)
+	if err != nil {
+		return err
+	}
+	refund.Status = models.RefundStatusFailed
+	refund.LastError = &reason
+	refund.Attempts++
+	return nil
+}
+
+func (r *memRefunds) MarkNotRequired(refundID, reason string) error {
+	refund, err := r.find(refundID)
+	if err != nil {
+		return err
+	}
+	refund.Status = models.RefundStatusNotRequired
+	refund.LastError = &reason
+	refund.Attempts++
+	return nil
+}
+
+func (r *memRefunds) ClaimForRetry(refundID string) error {
+	refund, err := r.find(refundID)
+	if err != nil {
+		return err
+	}
+	if refund.Status != models.RefundStatusFailed {
+		return errors.NewConflictError("Only failed refunds can be retried")
+	}
+	refund.Status = models.RefundStatusPending
+	return nil
+}
+
+func (r *memRefunds) RefundedAmount(orderID string) (money.Amount, error) {
+	var amount money.Amount
+	for _, refund := range r.refunds {
+		if refund.OrderID.String() == orderID && refund.Status != models.RefundStatusNotRequired && refund.Reason != models.RefundReasonStalePayment {
+			amount += refund.Amount
+		}
+	}
+	return amount, nil
+}
+
+type memShipments struct {
+	repositories.ShipmentRepository
+	*memStore
+}
+
+func (r *memShipments) CreateShipment(shipment *models.Shipment) error {
+	shipment.ID = uuid.New()
+	for i := range shipment.Items {
+		shipment.Items[i].ID = uuid.New()
+		shipment.Items[i].ShipmentID = shipment.ID
+	}
+	r.shipments = append(r.shipments, *shipment)
+	return nil
+}
+
+type memReturns struct {
+	repositories.OrderReturnRepository
+	*memStore
+}
+
+func (r *memReturns) CreateReturn(orderReturn *models.OrderReturn) error {
+	orderReturn.ID = uuid.New()
+	for i := range orderReturn.Items {
+		orderReturn.Items[i].ID = uuid.New()
+		orderReturn.Items[i].ReturnID = orderReturn.ID
+	}
+	r.returns = append(r.returns, *orderReturn)
+	return nil
+}
+
+func (r *memReturns) GetReturnByID(returnID string) (*models.OrderReturn, error) {
+	for _, orderReturn := range r.returns {
+		if orderReturn.ID.String() == returnID {
+			return &orderReturn, nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Return with ID '%s' not found", returnID))
+}
+
+func (r *memReturns) UpdateStatus(returnID, status string, rejectionReason *string) error {
+	for i := range r.returns {
+		if r.returns[i].ID.String() == returnID {
+			r.returns[i].Status = status
+			r.returns[i].RejectionReason = rejectionReason
+			return nil
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Return with ID '%s' not found", returnID))
+}
+
+// memIdempotencyKeys stores idempotency keys in memory and records the
+// orders whose stored payment URL was cleared. completeErr makes Complete
+// fail.
+type memIdempotencyKeys struct {
+	repositories.IdempotencyKeyRepository
+	keys        map[string]*models.IdempotencyKey
+	cleared     []uuid.UUID
+	completeErr error
+}
+
+func newMemIdempotencyKeys() *memIdempotencyKeys {
+	return &memIdempotencyKeys{keys: map[string]*models.IdempotencyKey{}}
+}
+
+func (r *memIdempotencyKeys) Reserve(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	id := key.CustomerID.String() + "/" + key.Key
+	if existing, ok := r.keys[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		copied := *existing
+		return &copied, false, nil
+	}
+
+	stored := *key
+	stored.CreatedAt = time.Now()
+	r.keys[id] = &stored
+	return key, true, nil
+}
+
+func (r *memIdempotencyKeys) Complete(customerID uuid.UUID, key string, orderID uuid.UUID, paymentURL string) error {
+	if r.completeErr != nil {
+		return r.completeErr
+	}
+	if stored, ok := r.keys[customerID.String()+"/"+key]; ok {
+		stored.OrderID = &orderID
+		stored.PaymentURL = &paymentURL
+	}
+	return nil
+}
+
+func (r *memIdempotencyKeys) Release(customerID uuid.UUID, key string) error {
+	id := customerID.String() + "/" + key
+	if stored, ok := r.keys[id]; ok && stored.OrderID == nil {
+		delete(r.keys, id)
+	}
+	return nil
+}
+
+func (r *memIdempotencyKeys) ClearPaymentURL(orderID uuid.UUID) error {
+	for _, stored := range r.keys {
+		if stored.OrderID != nil && *stored.OrderID == orderID {
+			stored.PaymentURL = nil
+		}
+	}
+	r.cleared = append(r.cleared, orderID)
+	return nil
+}
+
+// noTaxRates makes every region tax free.
+type noTaxRates struct{}
+
+func (noTaxRates) GetEffectiveRates(region string, at time.Time) ([]models.TaxRate, error) {
+	return nil, nil
+}
+
+// testService is an order service wired to in-memory fakes.
+type testService struct {
+	*orderService
+	store    *memStore
+	keys     *memIdempotencyKeys
+	products *fakeProductClient
+	payments *fakePaymentClient
+}
+
+func newTestService(products ...*proto.Product) *testService {
+	store := newMemStore()
+	unitOfWork := &memUnitOfWork{store}
+	productClient := newFakeProductClient(products...)
+	paymentClient := newFakePaymentClient()
+	idempotencyKeys := newMemIdempotencyKeys()
+
+	var productServiceClient proto.ProductServiceClient = productClient
+	var paymentServiceClient proto.PaymentServiceClient = paymentClient
+	stockService := inventory.NewProductStockService(productServiceClient)
+
+	service := NewOrderService(
+		&memOrders{memStore: store},
+		&memOrderItems{memStore: store},
+		unitOfWork,
+		idempotencyKeys,
+		&productServiceClient,
+		&paymentServiceClient,
+		stockService,
+		inventory.NewReserver(stockService, time.Hour),
+		rbac.DefaultPolicy(),
+		shipping.NewRulesCalculator(shipping.DefaultRules()),
+		tax.NewTableCalculator(noTaxRates{}),
+		address.NewValidator(),
+		time.Hour,
+		true,
+	).(*orderService)
+
+	return &testService{
+		orderService: service,
+		store:        store,
+		keys:         idempotencyKeys,
+		products:     productClient,
+		payments:     paymentClient,
+	}
+}
+
+// order returns the stored order with the given ID.
+func (ts *testService) order(orderID string) models.Order {
+	return ts.store.orders[uuid.MustParse(orderID)]
+}
+
+// payTestOrder marks an order paid, committing its stock, and records a
+// captured payment of its grand total.
+func (ts *testService) payTestOrder(t *testing.T, orderID string) {
+	t.Helper()
+
+	orders := &memOrders{memStore: ts.store}
+	if err := orders.UpdateOrderStatus(orderID, models.OrderStatusPaid, statemachine.ActorSystem, "payment", ""); err != nil {
+		t.Fatalf("UpdateOrderStatus(paid): %v", err)
+	}
+	ts.capturePayment(orderID)
+}
+
+// capturePayment records a captured payment of the order's grand total
+// with the payment service.
+func (ts *testService) capturePayment(orderID string) {
+	order := ts.order(orderID)
+	ts.payments.payments[orderID] = &proto.GetPaymentResponse{
+		Success:       true,
+		TransactionId: "tx-" + orderID,
+		OrderId:       orderID,
+		CustomerId:    order.CustomerID.String(),
+		Amount:        order.GrandTotal().Float64(),
+		Status:        paymentStatusCaptured,
+	}
+}
+
+// setStatus moves an order straight to status, skipping the state machine.
+func (ts *testService) setStatus(orderID, status string) {
+	order := ts.order(orderID)
+	order.Status = status
+	ts.store.orders[order.ID] = order
+}
+
+func testProduct(name string, price float64, stock int32) *proto.Product {
+	return &proto.Product{Id: uuid.NewString(), Name: name, Price: price, Stock: stock}
+}
+
+func testAddress() models.Address {
+	return models.Address{
+		Recipient:  "Jane Doe",
+		Line1:      "1 Main Street",
+		City:       "Toronto",
+		Region:     "ON",
+		PostalCode: "M5V 2T6",
+		Country:    "CA",
+		Phone:      "+14165550100",
+	}
+}
+
+func testOrder(customerID uuid.UUID) models.Order {
+	return models.Order{
+		CustomerID:      customerID,
+		Status:          models.OrderStatusPaymentPending,
+		ShippingAddress: testAddress(),
+	}
+}
+
+func testItem(product *proto.Product, quantity int) models.OrderItem {
+	return models.OrderItem{
+		ProductID:   uuid.MustParse(product.Id),
+		ProductName: product.Name,
+		Quantity:    quantity,
+	}
+}
+
+func testRxItem(product *proto.Product, quantity int) models.OrderItem {
+	item := testItem(product, quantity)
+	item.Prescription = testPrescription()
+	return item
+}
+
+func testPrescription() *models.Prescription {
+	return &models.Prescription{
+		PrescriberName: "Dr. Smith",
+		IssuedAt:       time.Now().AddDate(0, -1, 0),
+		ExpiresAt:      time.Now().AddDate(1, 0, 0),
+		FileURL:        "https://files.example/rx.pdf",
+	}
+}
+
+func testRxProduct(name string, price float64, stock int32) *proto.Product {
+	product := testProduct(name, price, stock)
+	product.RequiresPrescription = true
+	return product
+}
+
+func customer(customerID uuid.UUID) *auth.Principal {
+	return &auth.Principal{Subject: customerID.String(), Roles: []string{auth.RoleCustomer}}
+}
+
+func staff(role string) *auth.Principal {
+	return &auth.Principal{Subject: uuid.NewString(), Roles: []string{role}}
+}
+
+func service(name string) *auth.Principal {
+	return &auth.Principal{Subject: uuid.NewString(), Service: name}
+}
+
+// placeTestOrder places an order for the items and fails the test if that
+// does not work.
+func (ts *testService) placeTestOrder(t *testing.T, customerID uuid.UUID, items ...models.OrderItem) string {
+	t.Helper()
+
+	orderID, _, err := ts.placeOrder(testOrder(customerID), items)
+	if err != nil {
+		t.Fatalf("placeOrder: %v", err)
+	}
+	return orderID
+}
+
+// items returns the stored lines of an order.
+func (ts *testService) items(orderID string) []models.OrderItem {
+	var items []models.OrderItem
+	for _, item := range ts.store.items {
+		if item.OrderID.String() == orderID {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// eventTypes returns the types of the outbox events of an order, oldest
+// first.
+func (ts *testService) eventTypes(orderID string) []string {
+	var types []string
+	for _, event := range ts.store.events {
+		if event.OrderID.String() == orderID {
+			types = append(types, event.EventType)
+		}
+	}
+	return types
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+)
+
+// GetOrderHistory returns every status change of the order, oldest first.
+// Only admins and the customer who placed the order may see it.
+func (s *orderService) GetOrderHistory(orderID string, caller *auth.Principal) ([]models.OrderStatusChange, error) {
+	var history []models.OrderStatusChange
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		order, _, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if !s.policy.CanAccessOrder(caller, rbac.RPCGetOrderHistory, order.CustomerID.String()) {
+			return errors.NewAuthError("Access denied")
+		}
+
+		history, err = repos.StatusHistory.GetHistoryByOrderID(orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
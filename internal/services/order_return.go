@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// ReturnItemRequest is a quantity of one order item the customer wants to
+// send back.
+type ReturnItemRequest struct {
+	ItemID   uuid.UUID
+	Quantity int
+	Reason   string
+}
+
+// RequestReturn opens a return for shipped items of the customer's order.
+// Each line can be returned up to the quantity that has shipped and is not
+// already part of another open or approved return.
+func (s *orderService) RequestReturn(orderID string, caller *auth.Principal, items []ReturnItemRequest) (*models.OrderReturn, error) {
+	if len(items) == 0 {
+		return nil, errors.NewValidationError("items", "At least one item is required")
+	}
+
+	fields := map[string]string{}
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			fields[fmt.Sprintf("items[%d].quantity", i)] = "Quantity must be greater than zero"
+		}
+		if item.Reason == "" {
+			fields[fmt.Sprintf("items[%d].reason", i)] = "Reason is required"
+		}
+	}
+	if len(fields) > 0 {
+		return nil, errors.NewValidationErrors(fields)
+	}
+
+	var orderReturn *models.OrderReturn
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		order, orderItems, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if !s.policy.CanAccessOrder(caller, rbac.RPCRequestReturn, order.CustomerID.String()) {
+			return errors.NewAuthError("You are not authorized to return items of this order")
+		}
+
+		if order.Status != models.OrderStatusShipped && order.Status != models.OrderStatusCompleted {
+			return errors.NewConflictError("Only shipped orders can be returned")
+		}
+
+		returnable := returnableQuantities(order)
+		returnItems := make([]models.OrderReturnItem, 0, len(items))
+		for i, item := range items {
+			field := fmt.Sprintf("items[%d]", i)
+
+			orderItem := findItem(*orderItems, item.ItemID)
+			if orderItem == nil {
+				fields[field+".item_id"] = "Item is not part of this order"
+				continue
+			}
+
+			if item.Quantity > returnable[orderItem.ID] {
+				fields[field+".quantity"] = fmt.Sprintf("Only %d can be returned", returnable[orderItem.ID])
+				continue
+			}
+			returnable[orderItem.ID] -= item.Quantity
+
+			returnItems = append(returnItems, models.OrderReturnItem{
+				OrderItemID: orderItem.ID,
+				Quantity:    item.Quantity,
+				Reason:      item.Reason,
+			})
+		}
+		if len(fields) > 0 {
+			return errors.NewValidationErrors(fields)
+		}
+
+		orderReturn = &models.OrderReturn{
+			OrderID:    order.ID,
+			CustomerID: order.CustomerID,
+			Status:     models.ReturnStatusRequested,
+			Items:      returnItems,
+		}
+		return repos.Returns.CreateReturn(orderReturn)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orderReturn, nil
+}
+
+// ApproveReturn records an admin's decision on a return. Approval puts the
+// returned items back in stock and refunds their price and tax; the refund
+// outcome is returned and kept on the order.
+func (s *orderService) ApproveReturn(returnID string, caller *auth.Principal, decision string, reason *string) (*models.Refund, error) {
+	if !s.policy.Allows(caller, rbac.RPCApproveReturn) {
+		return nil, errors.NewAuthError("Access denied")
+	}
+
+	switch decision {
+	case models.ReturnStatusApproved:
+	case models.ReturnStatusRejected:
+		if reason == nil || *reason == "" {
+			return nil, errors.NewValidationError("reason", "A reason is required when rejecting a return")
+		}
+	default:
+		return nil, errors.NewValidationError("decision", "Decision must be 'approved' or 'rejected'")
+	}
+
+	if decision == models.ReturnStatusApproved && !s.partialRefunds {
+		return nil, errors.NewConflictError("Returns cannot be refunded while partial refunds are disabled")
+	}
+
+	var order *models.Order
+	var restock []models.OrderItem
+	var refund *models.Refund
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		orderReturn, err := repos.Returns.GetReturnByID(returnID)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Orders.LockOrder(orderReturn.OrderID.String()); err != nil {
+			return err
+		}
+
+		// Read the return again now that concurrent reviews are serialized.
+		orderReturn, err = repos.Returns.GetReturnByID(returnID)
+		if err != nil {
+			return err
+		}
+
+		if orderReturn.Status != models.ReturnStatusRequested {
+			return errors.NewConflictError(fmt.Sprintf("Return has already been %s", orderReturn.Status))
+		}
+
+		var orderItems *[]models.OrderItem
+		order, orderItems, err = repos.Orders.GetOrderByID(orderReturn.OrderID.String())
+		if err != nil {
+			return err
+		}
+
+		if decision == models.ReturnStatusRejected {
+			return repos.Returns.UpdateStatus(returnID, models.ReturnStatusRejected, reason)
+		}
+
+		if err := repos.Returns.UpdateStatus(returnID, models.ReturnStatusApproved, nil); err != nil {
+			return err
+		}
+
+		restock = returnedItems(*orderItems, orderReturn.Items)
+		refund = &models.Refund{
+			OrderID:  order.ID,
+			ReturnID: &orderReturn.ID,
+			Reason:   models.RefundReasonReturn,
+			Amount:   returnRefundAmount(order, *orderItems, orderReturn.Items),
+			Currency: order.Currency,
+			Status:   models.RefundStatusPending,
+		}
+		return repos.Refunds.CreateRefund(refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if refund == nil {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	s.restockItems(ctx, refund.OrderID.String(), restock, "order_returned")
+
+	if err := s.processRefund(ctx, refund, order.CustomerID.String()); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// returnableQuantities returns, per order item ID, the shipped quantity not
+// yet covered by a requested or approved return.
+func returnableQuantities(order *models.Order) map[uuid.UUID]int {
+	returnable := make(map[uuid.UUID]int)
+	for _, shipment := range order.Shipments {
+		for _, item := range shipment.Items {
+			returnable[item.OrderItemID] += item.Quantity
+		}
+	}
+	for _, orderReturn := range order.Returns {
+		if orderReturn.Status == models.ReturnStatusRejected {
+			continue
+		}
+		for _, item := range orderReturn.Items {
+			returnable[item.OrderItemID] -= item.Quantity
+		}
+	}
+	return returnable
+}
+
+// returnRefundAmount is the price of the returned quantities plus their
+// share of the tax charged on each line. Shipping is not refunded.
+func returnRefundAmount(order *models.Order, orderItems []models.OrderItem, returnItems []models.OrderReturnItem) money.Amount {
+	lineTax := make(map[uuid.UUID]money.Amount)
+	for _, line := range order.TaxLines {
+		lineTax[line.OrderItemID] += line.Amount
+	}
+
+	var amount money.Amount
+	for _, returned := range returnItems {
+		for _, item := range orderItems {
+			if item.ID != returned.OrderItemID {
+				continue
+			}
+			amount += item.Price.Mul(returned.Quantity)
+			amount += lineTax[item.ID].MulRatio(int64(returned.Quantity), int64(item.Quantity))
+		}
+	}
+	return amount
+}
+
+// returnedItems returns copies of the order items holding the returned
+// quantities, for restocking.
+func returnedItems(orderItems []models.OrderItem, returnItems []models.OrderReturnItem) []models.OrderItem {
+	var items []models.OrderItem
+	for _, returned := range returnItems {
+		for _, item := range orderItems {
+			if item.ID == returned.OrderItemID {
+				item.Quantity = returned.Quantity
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// shipTestOrder places an order for the items and ships all of it.
+func (ts *testService) shipTestOrder(t *testing.T, customerID uuid.UUID, items ...models.OrderItem) string {
+	t.Helper()
+
+	orderID := ts.placeTestOrder(t, customerID, items...)
+	ts.setStatus(orderID, models.OrderStatusApproved)
+	if err := ts.CreateShipment(orderID, staff(auth.RoleWarehouse), &models.Shipment{Carrier: "Canada Post", TrackingNumber: "CP123"}, nil); err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	return orderID
+}
+
+func TestRequestReturnByItemID(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.shipTestOrder(t, customerID, testItem(product, 1), testItem(product, 3))
+	items := ts.items(orderID)
+
+	orderReturn, err := ts.RequestReturn(orderID, customer(customerID), []ReturnItemRequest{{ItemID: items[1].ID, Quantity: 2, Reason: "Damaged"}})
+	if err != nil {
+		t.Fatalf("RequestReturn: %v", err)
+	}
+	if len(orderReturn.Items) != 1 || orderReturn.Items[0].OrderItemID != items[1].ID {
+		t.Errorf("return items = %+v, want the second line", orderReturn.Items)
+	}
+
+	// Only 1 of the first line shipped, so 2 of it cannot be returned even
+	// though the product has more units on the order.
+	_, err = ts.RequestReturn(orderID, customer(customerID), []ReturnItemRequest{{ItemID: items[0].ID, Quantity: 2, Reason: "Damaged"}})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Details["items[0].quantity"] == "" {
+		t.Fatalf("RequestReturn error = %v, want a quantity error", err)
+	}
+
+	_, err = ts.RequestReturn(orderID, customer(customerID), []ReturnItemRequest{{ItemID: uuid.New(), Quantity: 1, Reason: "Damaged"}})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Details["items[0].item_id"] == "" {
+		t.Fatalf("RequestReturn error = %v, want an item_id error", err)
+	}
+}
@@ -2,59 +2,266 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/PharmaKart/order-svc/internal/address"
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/inventory"
 	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
 	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/query"
+	"github.com/PharmaKart/order-svc/internal/rbac"
 	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/shipping"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/internal/tax"
 	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/PharmaKart/order-svc/pkg/utils"
 	"github.com/google/uuid"
 )
 
 type OrderService interface {
-	CreateOrder(order models.Order, orderItems []models.OrderItem) (string, string, error)
-	GetOrderByID(orderID string) (*models.Order, *[]models.OrderItem, error)
-	ListCustomersOrders(customerID string, filter models.Filter, sortBy string, sortOrder string, page, limit int32) (*[]OrderResponse, int32, error)
-	ListAllOrders(filter models.Filter, sortBy string, sortOrder string, page, limit int32) (*[]OrderResponse, int32, error)
-	UpdateOrderStatus(orderID, customerID, status string) error
-	GenerateNewPaymentUrl(orderID, customerID string) (string, error)
+	CreateOrder(order models.Order, orderItems []models.OrderItem, idempotencyKey string) (string, string, error)
+	GetOrderByID(orderID string, caller *auth.Principal) (*models.Order, *[]models.OrderItem, error)
+	ListCustomersOrders(caller *auth.Principal, customerID string, spec query.Spec) (*[]OrderResponse, int32, string, error)
+	ListAllOrders(caller *auth.Principal, spec query.Spec) (*[]OrderResponse, int32, string, error)
+	UpdateOrderStatus(orderID string, caller *auth.Principal, status string) error
+	GetOrderHistory(orderID string, caller *auth.Principal) ([]models.OrderStatusChange, error)
+	GenerateNewPaymentUrl(orderID string, caller *auth.Principal) (string, error)
+	UpdateShippingAddress(orderID string, caller *auth.Principal, shippingAddress models.Address) error
+	CreateShipment(orderID string, caller *auth.Principal, shipment *models.Shipment, items []ShipmentItemRequest) error
+	RecordDeliveryEvent(shipmentID string, caller *auth.Principal, event models.ShipmentEvent) error
+	RequestReturn(orderID string, caller *auth.Principal, items []ReturnItemRequest) (*models.OrderReturn, error)
+	ApproveReturn(returnID string, caller *auth.Principal, decision string, reason *string) (*models.Refund, error)
+	ListRefunds(caller *auth.Principal, status string, page, limit int32) ([]models.Refund, int32, error)
+	RetryRefund(refundID string, caller *auth.Principal) (*models.Refund, error)
+	CancelOrderItems(orderID string, caller *auth.Principal, items []CancelItemRequest) (*models.Refund, string, error)
+	AmendOrder(orderID string, caller *auth.Principal, items []models.OrderItem) (string, error)
+	ExpirePendingOrders(ctx context.Context, createdBefore time.Time, limit int) (int, error)
+	QuoteShipping(orderItems []models.OrderItem, method, region string) (*shipping.Quote, money.Amount, error)
+	ReviewPrescription(orderID string, caller *auth.Principal, decision string, reason *string) error
+	ListPendingPrescriptions(caller *auth.Principal, page, limit int32) (*[]OrderResponse, int32, error)
 }
 
 type orderService struct {
 	orderRepo     repositories.OrderRepository
 	orderItemRepo repositories.OrderItemRepository
+	unitOfWork    repositories.UnitOfWork
 	productClient proto.ProductServiceClient
 	paymentClient proto.PaymentServiceClient
+	stockService  inventory.StockService
+	reserver      *inventory.Reserver
+	policy        *rbac.Policy
+
+	idempotencyKeyRepo repositories.IdempotencyKeyRepository
+	idempotencyKeyTTL  time.Duration
+	shippingCalculator shipping.ShippingCalculator
+	taxCalculator      tax.TaxCalculator
+	addressValidator   address.Validator
+
+	// partialRefunds is set when the payment service can refund part of a
+	// payment. Without it, only whole payments are refunded.
+	partialRefunds bool
 }
 
 type OrderResponse struct {
-	OrderID         string
-	CustomerID      string
-	Status          string
-	PrescriptionURL *string
-	ShippingCost    float64
-	Subtotal        float64
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
-	Items           []models.OrderItem
-}
-
-func NewOrderService(orderRepo repositories.OrderRepository, orderItemRepo repositories.OrderItemRepository, productClient *proto.ProductServiceClient, paymentClient *proto.PaymentServiceClient) OrderService {
+	OrderID              string
+	CustomerID           string
+	Status               string
+	PrescriptionURL      *string
+	RequiresPrescription bool
+	ShippingAddress      models.Address
+	ShippingMethod       string
+	Currency             string
+	ShippingCost         money.Amount
+	Subtotal             money.Amount
+	TaxTotal             money.Amount
+	GrandTotal           money.Amount
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Items                []models.OrderItem
+}
+
+func newOrderResponse(order models.Order, items []models.OrderItem) OrderResponse {
+	return OrderResponse{
+		OrderID:              order.ID.String(),
+		CustomerID:           order.CustomerID.String(),
+		Status:               order.Status,
+		PrescriptionURL:      order.PrescriptionURL,
+		RequiresPrescription: order.RequiresPrescription,
+		ShippingAddress:      order.ShippingAddress,
+		ShippingMethod:       order.ShippingMethod,
+		Currency:             order.Currency,
+		ShippingCost:         order.ShippingCost,
+		Subtotal:             order.Subtotal,
+		TaxTotal:             order.TaxTotal,
+		GrandTotal:           order.GrandTotal(),
+		CreatedAt:            order.CreatedAt,
+		UpdatedAt:            order.UpdatedAt,
+		Items:                items,
+	}
+}
+
+func NewOrderService(orderRepo repositories.OrderRepository, orderItemRepo repositories.OrderItemRepository, unitOfWork repositories.UnitOfWork, idempotencyKeyRepo repositories.IdempotencyKeyRepository, productClient *proto.ProductServiceClient, paymentClient *proto.PaymentServiceClient, stockService inventory.StockService, reserver *inventory.Reserver, policy *rbac.Policy, shippingCalculator shipping.ShippingCalculator, taxCalculator tax.TaxCalculator, addressValidator address.Validator, idempotencyKeyTTL time.Duration, partialRefunds bool) OrderService {
 	return &orderService{
-		orderRepo:     orderRepo,
-		orderItemRepo: orderItemRepo,
-		productClient: *productClient,
-		paymentClient: *paymentClient,
+		orderRepo:          orderRepo,
+		orderItemRepo:      orderItemRepo,
+		unitOfWork:         unitOfWork,
+		productClient:      *productClient,
+		paymentClient:      *paymentClient,
+		stockService:       stockService,
+		reserver:           reserver,
+		policy:             policy,
+		idempotencyKeyRepo: idempotencyKeyRepo,
+		idempotencyKeyTTL:  idempotencyKeyTTL,
+		shippingCalculator: shippingCalculator,
+		taxCalculator:      taxCalculator,
+		addressValidator:   addressValidator,
+		partialRefunds:     partialRefunds,
+	}
+}
+
+// CreateOrder places the order. When an idempotency key is given, a repeat of
+// the same request returns the original order ID and payment URL, and a
+// different request with the same key is rejected.
+func (s *orderService) CreateOrder(order models.Order, orderItems []models.OrderItem, idempotencyKey string) (string, string, error) {
+	if idempotencyKey == "" {
+		return s.placeOrder(order, orderItems)
+	}
+
+	requestHash := hashOrderRequest(order, orderItems)
+
+	key, reserved, err := s.idempotencyKeyRepo.Reserve(&models.IdempotencyKey{
+		CustomerID:  order.CustomerID,
+		Key:         idempotencyKey,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.idempotencyKeyTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if !reserved {
+		if key.RequestHash != requestHash {
+			return "", "", errors.NewConflictError("Idempotency key was already used for a different order")
+		}
+		if key.OrderID == nil {
+			// Either the first request is still running or it stored its
+			// order but failed to record it on the key. In the second case
+			// the order carries the key, so the retry picks it up.
+			placed, err := s.orderRepo.GetOrderByIdempotencyKey(order.CustomerID, idempotencyKey)
+			if err != nil {
+				if appErr, ok := errors.IsAppError(err); ok && appErr.Type == errors.NotFoundError {
+					return "", "", errors.NewConflictError("An order with this idempotency key is still being processed")
+				}
+				return "", "", err
+			}
+			return s.reissuePaymentURL(placed, idempotencyKey)
+		}
+		if key.PaymentURL == nil {
+			// The order was amended after it was placed and its old payment
+			// URL is no longer valid.
+			placed, _, err := s.orderRepo.GetOrderByID(key.OrderID.String())
+			if err != nil {
+				return "", "", err
+			}
+			return s.reissuePaymentURL(placed, idempotencyKey)
+		}
+		return key.OrderID.String(), *key.PaymentURL, nil
+	}
+
+	order.IdempotencyKey = &idempotencyKey
+	orderID, paymentURL, err := s.placeOrder(order, orderItems)
+	if err != nil {
+		if releaseErr := s.idempotencyKeyRepo.Release(order.CustomerID, idempotencyKey); releaseErr != nil {
+			utils.Error("Failed to release idempotency key", map[string]interface{}{
+				"customer_id": order.CustomerID.String(),
+				"key":         idempotencyKey,
+				"error":       releaseErr.Error(),
+			})
+		}
+		return "", "", err
+	}
+
+	s.completeIdempotencyKey(order.CustomerID, idempotencyKey, uuid.MustParse(orderID), paymentURL)
+
+	return orderID, paymentURL, nil
+}
+
+// reissuePaymentURL answers a repeated PlaceOrder request for an order that
+// has no stored payment URL with a new one, and stores it on the key.
+func (s *orderService) reissuePaymentURL(order *models.Order, idempotencyKey string) (string, string, error) {
+	paymentURL, err := s.generatePaymentURL(order)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.completeIdempotencyKey(order.CustomerID, idempotencyKey, order.ID, paymentURL)
+
+	return order.ID.String(), paymentURL, nil
+}
+
+// completeIdempotencyKey records the placed order on the key. A failure is
+// only logged: the order carries the key, so a retry still finds it.
+func (s *orderService) completeIdempotencyKey(customerID uuid.UUID, idempotencyKey string, orderID uuid.UUID, paymentURL string) {
+	if err := s.idempotencyKeyRepo.Complete(customerID, idempotencyKey, orderID, paymentURL); err != nil {
+		utils.Error("Failed to store idempotency key result", map[string]interface{}{
+			"customer_id": customerID.String(),
+			"key":         idempotencyKey,
+			"order_id":    orderID.String(),
+			"error":       err.Error(),
+		})
+	}
+}
+
+// hashOrderRequest fingerprints the parts of a PlaceOrder request that define
+// the order, independent of item order.
+func hashOrderRequest(order models.Order, orderItems []models.OrderItem) string {
+	items := make([]string, len(orderItems))
+	for i, item := range orderItems {
+		prescriptionFile := ""
+		if item.Prescription != nil {
+			prescriptionFile = item.Prescription.FileURL
+		}
+		items[i] = fmt.Sprintf("%s:%s:%d:%s", item.ProductID, item.ProductName, item.Quantity, prescriptionFile)
+	}
+	sort.Strings(items)
+
+	prescriptionURL := ""
+	if order.PrescriptionURL != nil {
+		prescriptionURL = *order.PrescriptionURL
 	}
+
+	shipTo := order.ShippingAddress
+	line2 := ""
+	if shipTo.Line2 != nil {
+		line2 = *shipTo.Line2
+	}
+	shippingAddress := strings.Join([]string{shipTo.Recipient, shipTo.Line1, line2, shipTo.City, shipTo.Region, shipTo.PostalCode, shipTo.Country, shipTo.Phone}, ";")
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%s|%s|%s", order.CustomerID, prescriptionURL, order.ShippingMethod, shippingAddress, strings.Join(items, ","))
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
-func (s *orderService) CreateOrder(order models.Order, orderItems []models.OrderItem) (string, string, error) {
+func (s *orderService) placeOrder(order models.Order, orderItems []models.OrderItem) (string, string, error) {
+	order.ShippingAddress = address.Normalize(order.ShippingAddress)
+	if fields := s.addressValidator.Validate(order.ShippingAddress); len(fields) > 0 {
+		return "", "", errors.NewValidationErrors(prefixFields("shipping_address", fields))
+	}
+
 	// Check Product Service for product stock
 	ctx := context.Background()
 	orderItemsList := []models.OrderItem{}
-	subtotal := 0.0
-	for _, item := range orderItems {
+	subtotal := money.Amount(0)
+	for i, item := range orderItems {
 		if err := uuid.Validate("uuid..."); err == nil {
 			return "", "", errors.NewValidationError("product_id", "Invalid product ID")
 		}
@@ -71,78 +278,148 @@ func (s *orderService) CreateOrder(order models.Order, orderItems []models.Order
 		if err != nil {
 			return "", "", err
 		}
+		if !product.Success || product.Product == nil {
+			return "", "", errors.NewValidationError(fmt.Sprintf("items[%d].product_id", i), "Product not found")
+		}
 		if int(product.Product.Stock) < item.Quantity {
 			return "", "", errors.NewValidationError("stock", fmt.Sprintf("Not enough stock for product %s", item.ProductName))
 		}
 
-		// Check if product is prescription based
-		if product.Product.RequiresPrescription && order.PrescriptionURL == nil {
-			return "", "", errors.NewValidationError("prescription", fmt.Sprintf("Prescription required for product %s", item.ProductName))
+		if item.Prescription != nil {
+			if fields := validatePrescription(fmt.Sprintf("items[%d].prescription", i), item.Prescription, time.Now()); len(fields) > 0 {
+				return "", "", errors.NewValidationErrors(fields)
+			}
 		}
 
-		// Deduct stock from product
-		_, err = s.productClient.UpdateStock(ctx, &proto.UpdateStockRequest{
-			ProductId:      item.ProductID.String(),
-			QuantityChange: int32(item.Quantity) * -1,
-			Reason:         "order_placed",
-		})
-		if err != nil {
-			return "", "", err
+		item.Price = money.FromFloat(product.Product.Price)
+		item.WeightGrams = int(product.Product.WeightGrams)
+		item.TaxCategory = models.TaxCategoryOTC
+		if product.Product.RequiresPrescription {
+			item.TaxCategory = models.TaxCategoryPrescription
 		}
-		item.Price = product.Product.Price
 		orderItemsList = append(orderItemsList, item)
-		subtotal += item.Price * float64(item.Quantity)
+		subtotal += item.Price.Mul(item.Quantity)
+	}
+
+	// Every prescription line needs its own prescription.
+	if missing := missingPrescriptions(&order, orderItemsList); len(missing) > 0 {
+		fields := map[string]string{}
+		for _, i := range missing {
+			fields[fmt.Sprintf("items[%d].prescription", i)] = fmt.Sprintf("Prescription required for product %s", orderItemsList[i].ProductName)
+		}
+		return "", "", errors.NewValidationErrors(fields)
 	}
+	order.RequiresPrescription = len(prescriptionLines(orderItemsList)) > 0
 
+	order.Currency = money.DefaultCurrency
 	order.Subtotal = subtotal
 
-	if subtotal > 40.00 {
-		order.ShippingCost = 0.00
-	} else {
-		order.ShippingCost = 10.00
+	quote, err := s.shippingCalculator.Quote(shippingQuoteRequest(order.ShippingMethod, order.ShippingAddress.Region, subtotal, orderItemsList))
+	if err != nil {
+		return "", "", err
 	}
+	order.ShippingMethod = quote.Method
+	order.ShippingCost = quote.Cost
 
-	order_id, err := s.orderRepo.CreateOrder(&order)
+	taxLines, taxTotal, err := s.taxCalculator.Calculate(order.ShippingAddress.Region, taxItems(orderItemsList), time.Now())
 	if err != nil {
 		return "", "", err
 	}
+	order.TaxTotal = taxTotal
+
+	var order_id string
+	err = s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		var err error
+		order_id, err = repos.Orders.CreateOrder(&order)
+		if err != nil {
+			return err
+		}
 
-	for _, item := range orderItemsList {
+		for i := range orderItemsList {
+			item := &orderItemsList[i]
+			item.OrderID = order.ID
+			if item.Prescription != nil {
+				item.Prescription.OrderID = order.ID
+			}
 
-		item.OrderID = order.ID
+			if err := repos.OrderItems.AddOrderItem(item); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.OrderTaxLines.AddTaxLines(orderTaxLines(order.ID, orderItemsList, taxLines)); err != nil {
+			return err
+		}
+
+		// Hold the stock until the order is paid
+		if err := s.reserver.Reserve(ctx, repos, &order, orderItemsList); err != nil {
+			return err
+		}
 
-		s.orderItemRepo.AddOrderItem(&item)
+		event, err := outbox.NewOrderPlacedEvent(&order, orderItemsList)
+		if err != nil {
+			return err
+		}
+
+		return repos.OrderEvents.AddEvent(event)
+	})
+	if err != nil {
+		return "", "", err
 	}
 
+	// The order is stored now, so it is marked failed if no payment URL can
+	// be issued for it.
+	placeOrder := newSaga("place_order")
+	placeOrder.Completed("create_order", func() error {
+		return s.orderRepo.UpdateOrderStatus(order_id, models.OrderStatusFailed, statemachine.ActorSystem, string(statemachine.ActorSystem), "order placement failed")
+	})
+
 	paymentURL, err := s.paymentClient.GeneratePaymentURL(ctx, &proto.GeneratePaymentURLRequest{
 		OrderId:    order_id,
 		CustomerId: order.CustomerID.String(),
 	})
 	if err != nil {
-		return "", "", err
+		return "", "", placeOrder.Abort(err)
+	}
+
+	if !paymentURL.Success {
+		return "", "", placeOrder.Abort(&errors.AppError{
+			Type:    errors.InternalError,
+			Message: paymentURL.Error.Message,
+		})
 	}
 
 	return order_id, paymentURL.Url, nil
 }
 
-func (s *orderService) GenerateNewPaymentUrl(orderID, customerID string) (string, error) {
-	ctx := context.Background()
-
+func (s *orderService) GenerateNewPaymentUrl(orderID string, caller *auth.Principal) (string, error) {
 	// First, get the order to check its status
 	order, _, err := s.orderRepo.GetOrderByID(orderID)
 	if err != nil {
 		return "", err
 	}
 
+	if !s.policy.CanAccessOrder(caller, rbac.RPCGenerateNewPaymentUrl, order.CustomerID.String()) {
+		return "", errors.NewAuthError("You are not authorized to pay for this order")
+	}
+
+	return s.generatePaymentURL(order)
+}
+
+// generatePaymentURL asks the payment service for a new payment URL for an
+// order that is still awaiting payment.
+func (s *orderService) generatePaymentURL(order *models.Order) (string, error) {
+	ctx := context.Background()
+
 	// Check if order status is payment_pending
-	if order.Status != "payment_pending" {
+	if order.Status != models.OrderStatusPaymentPending {
 		return "", errors.NewConflictError("Order already paid for")
 	}
 
 	// Proceed with generating payment URL
 	paymentURL, err := s.paymentClient.GeneratePaymentURL(ctx, &proto.GeneratePaymentURLRequest{
-		OrderId:    orderID,
-		CustomerId: customerID,
+		OrderId:    order.ID.String(),
+		CustomerId: order.CustomerID.String(),
 	})
 	if err != nil {
 		return "", err
@@ -158,97 +435,267 @@ func (s *orderService) GenerateNewPaymentUrl(orderID, customerID string) (string
 	return paymentURL.Url, nil
 }
 
-func (s *orderService) GetOrderByID(orderID string) (*models.Order, *[]models.OrderItem, error) {
+// expirePaymentURLs asks the payment service to stop accepting payments
+// through the URLs issued so far for an unpaid order, before its total
+// changes. A payment that gets through anyway is refunded, see
+// UpdateOrderStatus.
+func (s *orderService) expirePaymentURLs(order *models.Order) error {
+	resp, err := s.paymentClient.ExpirePaymentURLs(context.Background(), &proto.ExpirePaymentURLsRequest{
+		OrderId:    order.ID.String(),
+		CustomerId: order.CustomerID.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return &errors.AppError{
+			Type:    errors.InternalError,
+			Message: resp.GetError().GetMessage(),
+		}
+	}
+
+	return nil
+}
+
+// replacePaymentURL issues a new payment URL for an unpaid order whose total
+// changed. The URL stored for PlaceOrder retries was for the old total, so
+// it is forgotten.
+func (s *orderService) replacePaymentURL(orderID string) (string, error) {
+	order, _, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.idempotencyKeyRepo.ClearPaymentURL(order.ID); err != nil {
+		utils.Error("Failed to clear stored payment URL", map[string]interface{}{
+			"order_id": orderID,
+			"error":    err.Error(),
+		})
+	}
+
+	return s.generatePaymentURL(order)
+}
+
+func (s *orderService) GetOrderByID(orderID string, caller *auth.Principal) (*models.Order, *[]models.OrderItem, error) {
 	order, items, err := s.orderRepo.GetOrderByID(orderID)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if !s.policy.CanAccessOrder(caller, rbac.RPCGetOrder, order.CustomerID.String()) {
+		return nil, nil, errors.NewAuthError("You are not authorized to view this order")
+	}
+
 	return order, items, nil
 }
 
-func (s *orderService) ListCustomersOrders(customerID string, filter models.Filter, sortBy string, sortOrder string, page, limit int32) (*[]OrderResponse, int32, error) {
+func (s *orderService) ListCustomersOrders(caller *auth.Principal, customerID string, spec query.Spec) (*[]OrderResponse, int32, string, error) {
+	if !s.policy.CanAccessOrder(caller, rbac.RPCListCustomersOrders, customerID) {
+		return nil, 0, "", errors.NewAuthError("You are not authorized to view these orders")
+	}
+
 	ordersResponse := []OrderResponse{}
 
-	orders, total, err := s.orderRepo.ListCustomersOrders(customerID, filter, sortBy, sortOrder, page, limit)
+	orders, total, nextCursor, err := s.orderRepo.ListCustomersOrders(customerID, spec)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
 	for _, order := range orders {
-		items, err := s.orderItemRepo.GetItemsByOrderID(order.ID.String())
-		if err != nil {
-			return nil, 0, err
-		}
-		ordersResponse = append(ordersResponse, OrderResponse{
-			OrderID:         order.ID.String(),
-			CustomerID:      order.CustomerID.String(),
-			Status:          order.Status,
-			PrescriptionURL: order.PrescriptionURL,
-			ShippingCost:    order.ShippingCost,
-			Subtotal:        order.Subtotal,
-			CreatedAt:       order.CreatedAt,
-			UpdatedAt:       order.UpdatedAt,
-			Items:           items,
-		})
+		ordersResponse = append(ordersResponse, newOrderResponse(order, order.Items))
 	}
 
-	return &ordersResponse, total, nil
+	return &ordersResponse, total, nextCursor, nil
 }
 
-func (s *orderService) ListAllOrders(filter models.Filter, sortBy string, sortOrder string, page, limit int32) (*[]OrderResponse, int32, error) {
+func (s *orderService) ListAllOrders(caller *auth.Principal, spec query.Spec) (*[]OrderResponse, int32, string, error) {
+	if !s.policy.Allows(caller, rbac.RPCListAllOrders) {
+		return nil, 0, "", errors.NewAuthError("Access denied")
+	}
+
 	ordersResponse := []OrderResponse{}
 
-	orders, total, err := s.orderRepo.ListAllOrders(filter, sortBy, sortOrder, page, limit)
+	orders, total, nextCursor, err := s.orderRepo.ListAllOrders(spec)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
 	for _, order := range orders {
-		items, err := s.orderItemRepo.GetItemsByOrderID(order.ID.String())
+		ordersResponse = append(ordersResponse, newOrderResponse(order, order.Items))
+	}
+
+	return &ordersResponse, total, nextCursor, nil
+}
+
+func (s *orderService) UpdateOrderStatus(orderID string, caller *auth.Principal, status string) error {
+	var payment *proto.GetPaymentResponse
+	if status == models.OrderStatusPaid {
+		var err error
+		if payment, err = s.capturedPayment(orderID); err != nil {
+			return err
+		}
+	}
+
+	var c *cancellation
+	var stale *models.Refund
+	var mismatch bool
+	var customerID string
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		order, orderItems, err := repos.Orders.GetOrderByID(orderID)
 		if err != nil {
-			return nil, 0, err
-		}
-		ordersResponse = append(ordersResponse, OrderResponse{
-			OrderID:         order.ID.String(),
-			CustomerID:      order.CustomerID.String(),
-			Status:          order.Status,
-			PrescriptionURL: order.PrescriptionURL,
-			ShippingCost:    order.ShippingCost,
-			Subtotal:        order.Subtotal,
-			CreatedAt:       order.CreatedAt,
-			UpdatedAt:       order.UpdatedAt,
-			Items:           items,
-		})
+			return err
+		}
+		customerID = order.CustomerID.String()
+
+		if !s.policy.CanAccessOrder(caller, rbac.RPCUpdateOrderStatus, order.CustomerID.String()) {
+			return errors.NewAuthError("Access denied")
+		}
+
+		actor, err := s.transitionActor(caller, order.Status, status)
+		if err != nil {
+			return err
+		}
+
+		// A payment URL handed out before an amendment can still be paid at
+		// the old amount; such a payment does not pay for the order and is
+		// given back. The order keeps waiting for payment.
+		if payment != nil && money.FromFloat(payment.Amount) != order.GrandTotal() {
+			utils.Warn("Captured payment does not match the order total", map[string]interface{}{
+				"order_id":       orderID,
+				"transaction_id": payment.TransactionId,
+				"amount":         payment.Amount,
+				"grand_total":    order.GrandTotal().String(),
+			})
+			mismatch = true
+			stale, err = recordStalePaymentRefund(repos, order, payment)
+			return err
+		}
+
+		if status == models.OrderStatusPaid {
+			renewed, err := s.renewExpiredHolds(repos, orderID, *orderItems)
+			if err != nil {
+				return err
+			}
+			if err := repos.Orders.UpdateOrderStatus(orderID, status, actor, caller.ID(), ""); err != nil {
+				return err
+			}
+			if renewed {
+				return nil
+			}
+
+			// The stock was sold to someone else after the hold expired; the
+			// payment is kept on the order so that it can be refunded.
+			utils.Warn("Cancelling paid order whose stock is no longer available", map[string]interface{}{
+				"order_id": orderID,
+			})
+			c, err = cancelOrder(repos, orderID, statemachine.ActorSystem, string(statemachine.ActorSystem), models.CancellationReasonOutOfStock)
+			return err
+		}
+
+		if status != models.OrderStatusCancelled {
+			return repos.Orders.UpdateOrderStatus(orderID, status, actor, caller.ID(), "")
+		}
+
+		reason := models.CancellationReasonCustomerRequest
+		if actor != statemachine.Actor(auth.RoleCustomer) {
+			reason = models.CancellationReasonAdminRequest
+		}
+		c, err = cancelOrder(repos, orderID, actor, caller.ID(), reason)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if mismatch {
+		if stale != nil {
+			if err := s.processRefund(context.Background(), stale, customerID); err != nil {
+				utils.Error("Failed to record refund outcome", map[string]interface{}{
+					"order_id":  orderID,
+					"refund_id": stale.ID.String(),
+					"error":     err.Error(),
+				})
+			}
+		}
+		return errors.NewConflictError("The captured payment does not match the order total and is refunded")
 	}
 
-	return &ordersResponse, total, nil
+	if c != nil {
+		s.completeCancellation(context.Background(), c)
+	}
+	return nil
 }
 
-func (s *orderService) UpdateOrderStatus(orderID, customerID, status string) error {
+// capturedPayment returns the payment captured for the order. An order can
+// only become paid once the payment service has recorded one.
+func (s *orderService) capturedPayment(orderID string) (*proto.GetPaymentResponse, error) {
 	order, _, err := s.orderRepo.GetOrderByID(orderID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if order.Status == "cancelled" {
-		return errors.NewConflictError("Order already cancelled")
+	payment, err := s.paymentClient.GetPaymentByOrderID(context.Background(), &proto.GetPaymentByOrderIDRequest{
+		OrderId:    orderID,
+		CustomerId: order.CustomerID.String(),
+	})
+	if err != nil {
+		return nil, err
 	}
-	if order.Status == "completed" {
-		return errors.NewConflictError("Order already completed")
+	if !payment.Success {
+		if payment.Error != nil && payment.Error.Type == string(errors.NotFoundError) {
+			return nil, errors.NewConflictError("No payment has been recorded for this order")
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("payment lookup failed: %s", payment.GetError().GetMessage()))
+	}
+	if payment.Status != paymentStatusCaptured {
+		return nil, errors.NewConflictError(fmt.Sprintf("The order's payment is '%s', not captured", payment.Status))
 	}
 
-	switch {
-	case customerID == "admin":
-		return s.orderRepo.UpdateOrderStatus(orderID, status)
+	return payment, nil
+}
 
-	case customerID == "payment_service" && status == "paid":
-		return s.orderRepo.UpdateOrderStatus(orderID, status)
+// renewExpiredHolds holds the stock of the order's reservations that were
+// released because the payment took longer than the hold again. It reports
+// false when a product no longer has enough available stock.
+func (s *orderService) renewExpiredHolds(repos repositories.TxRepositories, orderID string, orderItems []models.OrderItem) (bool, error) {
+	reservations, err := repos.StockReservations.LockReservationsByOrderID(orderID)
+	if err != nil {
+		return false, err
+	}
 
-	case customerID == order.CustomerID.String() && status == "cancelled" && order.Status != "shipping":
-		return s.orderRepo.UpdateOrderStatus(orderID, status)
+	for _, reservation := range reservations {
+		if reservation.Status != models.ReservationStatusReleased || reservation.Quantity == 0 {
+			continue
+		}
+
+		productName := reservation.ProductID.String()
+		if item := findItem(orderItems, reservation.OrderItemID); item != nil {
+			productName = item.ProductName
+		}
+
+		err := s.reserver.Renew(context.Background(), repos, reservation, productName)
+		if appErr, ok := errors.IsAppError(err); ok && appErr.Type == errors.ValidationError {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
 
-	default:
-		return errors.NewAuthError("Access denied")
+// transitionActor returns the actor a status change requested by the caller
+// is made as: the role the access policy grants the change to.
+func (s *orderService) transitionActor(caller *auth.Principal, from, to string) (statemachine.Actor, error) {
+	role, ok := s.policy.TransitionRole(caller, from, to)
+	if !ok {
+		return "", errors.NewAuthError(fmt.Sprintf("You are not allowed to move an order from '%s' to '%s'", from, to))
 	}
+	return statemachine.Actor(role), nil
 }
@@ -0,0 +1,342 @@
+package services
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestSagaAbortCompensatesInReverse(t *testing.T) {
+	var ran []string
+	s := newSaga("test")
+	s.Completed("first", func() error {
+		ran = append(ran, "first")
+		return nil
+	})
+	s.Completed("second", func() error {
+		ran = append(ran, "second")
+		return stderrors.New("compensation failed")
+	})
+	s.Completed("third", func() error {
+		ran = append(ran, "third")
+		return nil
+	})
+
+	cause := stderrors.New("step failed")
+	if err := s.Abort(cause); err != cause {
+		t.Fatalf("Abort returned %v, want the cause", err)
+	}
+
+	want := []string{"third", "second", "first"}
+	if len(ran) != len(want) {
+		t.Fatalf("compensations ran %v, want %v", ran, want)
+	}
+	for i := range want {
+		if ran[i] != want[i] {
+			t.Fatalf("compensations ran %v, want %v", ran, want)
+		}
+	}
+
+	ran = nil
+	s.Abort(cause)
+	if len(ran) != 0 {
+		t.Fatalf("second Abort ran %v again", ran)
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	customerID := uuid.New()
+
+	orderID, paymentURL, err := ts.placeOrder(testOrder(customerID), []models.OrderItem{testItem(product, 2)})
+	if err != nil {
+		t.Fatalf("placeOrder: %v", err)
+	}
+	if paymentURL != "https://pay.example/"+orderID {
+		t.Errorf("payment URL = %q", paymentURL)
+	}
+
+	order := ts.order(orderID)
+	if order.Status != models.OrderStatusPaymentPending {
+		t.Errorf("status = %s, want %s", order.Status, models.OrderStatusPaymentPending)
+	}
+	if order.Subtotal != 2000 {
+		t.Errorf("subtotal = %d, want 2000", order.Subtotal)
+	}
+	if len(ts.store.items) != 1 {
+		t.Fatalf("stored %d items, want 1", len(ts.store.items))
+	}
+	if len(ts.store.reservations) != 1 || ts.store.reservations[0].Quantity != 2 || ts.store.reservations[0].Status != models.ReservationStatusHeld {
+		t.Errorf("reservations = %+v, want one held reservation of 2", ts.store.reservations)
+	}
+	if len(ts.store.events) != 1 || ts.store.events[0].EventType != models.OrderEventPlaced {
+		t.Errorf("events = %+v, want one %s event", ts.store.events, models.OrderEventPlaced)
+	}
+}
+
+func TestPlaceOrderCompensatesWhenPaymentURLFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*fakePaymentClient)
+	}{
+		{"transport error", func(c *fakePaymentClient) { c.urlErr = stderrors.New("connection refused") }},
+		{"unsuccessful response", func(c *fakePaymentClient) { c.urlFail = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := testProduct("Ibuprofen", 10.00, 5)
+			ts := newTestService(product)
+			tt.setup(ts.payments)
+
+			_, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{testItem(product, 2)})
+			if err == nil {
+				t.Fatal("placeOrder succeeded, want an error")
+			}
+
+			if len(ts.store.orders) != 1 {
+				t.Fatalf("stored %d orders, want the placed order to be kept", len(ts.store.orders))
+			}
+			for _, order := range ts.store.orders {
+				if order.Status != models.OrderStatusFailed {
+					t.Errorf("status = %s, want %s", order.Status, models.OrderStatusFailed)
+				}
+			}
+			for _, reservation := range ts.store.reservations {
+				if reservation.Status != models.ReservationStatusReleased {
+					t.Errorf("reservation status = %s, want %s", reservation.Status, models.ReservationStatusReleased)
+				}
+			}
+		})
+	}
+}
+
+func TestPlaceOrderRollsBackWhenATransactionStepFails(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	ts.store.fail["AddOrderItem"] = stderrors.New("disk full")
+
+	_, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{testItem(product, 2)})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.InternalError {
+		t.Fatalf("placeOrder error = %v, want an internal error", err)
+	}
+
+	if len(ts.store.orders) != 0 || len(ts.store.reservations) != 0 || len(ts.store.events) != 0 {
+		t.Errorf("store kept %d orders, %d reservations and %d events after a rollback", len(ts.store.orders), len(ts.store.reservations), len(ts.store.events))
+	}
+}
+
+func TestPlaceOrderRejectsInsufficientStock(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 1)
+	ts := newTestService(product)
+
+	_, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{testItem(product, 2)})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("placeOrder error = %v, want a validation error", err)
+	}
+	if len(ts.store.orders) != 0 {
+		t.Errorf("stored %d orders, want none", len(ts.store.orders))
+	}
+}
+
+func TestPlaceOrderCountsHeldStock(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 3)
+	ts := newTestService(product)
+
+	if _, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{testItem(product, 2)}); err != nil {
+		t.Fatalf("first placeOrder: %v", err)
+	}
+
+	_, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{testItem(product, 2)})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("second placeOrder error = %v, want a validation error", err)
+	}
+	if len(ts.store.orders) != 1 {
+		t.Errorf("stored %d orders, want 1", len(ts.store.orders))
+	}
+}
+
+func TestPaymentAfterHoldExpiredRenewsTheHold(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 2))
+	ts.store.reservations[0].Status = models.ReservationStatusReleased
+	ts.capturePayment(orderID)
+
+	if err := ts.UpdateOrderStatus(orderID, service(auth.ServicePayment), models.OrderStatusPaid); err != nil {
+		t.Fatalf("UpdateOrderStatus(paid): %v", err)
+	}
+
+	if got := ts.order(orderID).Status; got != models.OrderStatusPaid {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusPaid)
+	}
+	if got := ts.store.reservations[0].Status; got != models.ReservationStatusCommitted {
+		t.Errorf("reservation status = %s, want %s", got, models.ReservationStatusCommitted)
+	}
+}
+
+func TestPaymentAfterStockWasSoldCancelsAndRefunds(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 3)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 2))
+	ts.store.reservations[0].Status = models.ReservationStatusReleased
+	ts.placeTestOrder(t, uuid.New(), testItem(product, 2))
+	ts.capturePayment(orderID)
+
+	if err := ts.UpdateOrderStatus(orderID, service(auth.ServicePayment), models.OrderStatusPaid); err != nil {
+		t.Fatalf("UpdateOrderStatus(paid): %v", err)
+	}
+
+	order := ts.order(orderID)
+	if order.Status != models.OrderStatusCancelled || order.CancellationReason == nil || *order.CancellationReason != models.CancellationReasonOutOfStock {
+		t.Fatalf("order = %s (%v), want cancelled for %s", order.Status, order.CancellationReason, models.CancellationReasonOutOfStock)
+	}
+	if got := ts.store.reservations[0].Status; got != models.ReservationStatusReleased {
+		t.Errorf("reservation status = %s, want it still %s", got, models.ReservationStatusReleased)
+	}
+	if len(ts.payments.refunds) != 1 || ts.payments.refunds[0].Amount != nil {
+		t.Errorf("refund requests = %+v, want the whole payment refunded", ts.payments.refunds)
+	}
+}
+
+func TestCreateOrderWithIdempotencyKey(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	customerID := uuid.New()
+	items := []models.OrderItem{testItem(product, 2)}
+
+	tests := []struct {
+		name string
+		// between runs after the first request and before the retry.
+		between   func(ts *testService)
+		retry     []models.OrderItem
+		wantErr   errors.ErrorType
+		wantSame  bool
+		wantCount int
+	}{
+		{
+			name:      "repeat returns the original order",
+			retry:     items,
+			wantSame:  true,
+			wantCount: 1,
+		},
+		{
+			name:      "different request is a conflict",
+			retry:     []models.OrderItem{testItem(product, 3)},
+			wantErr:   errors.ConflictError,
+			wantCount: 1,
+		},
+		{
+			name: "expired key is reusable",
+			between: func(ts *testService) {
+				for _, key := range ts.keys.keys {
+					key.ExpiresAt = time.Now().Add(-time.Minute)
+				}
+			},
+			retry:     []models.OrderItem{testItem(product, 3)},
+			wantCount: 2,
+		},
+		{
+			name: "unstored result is recovered from the order",
+			between: func(ts *testService) {
+				for _, key := range ts.keys.keys {
+					key.OrderID = nil
+					key.PaymentURL = nil
+				}
+			},
+			retry:     items,
+			wantSame:  true,
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(product)
+
+			firstID, firstURL, err := ts.CreateOrder(testOrder(customerID), items, "key-1")
+			if err != nil {
+				t.Fatalf("first CreateOrder: %v", err)
+			}
+			if tt.between != nil {
+				tt.between(ts)
+			}
+
+			orderID, paymentURL, err := ts.CreateOrder(testOrder(customerID), tt.retry, "key-1")
+			if tt.wantErr != "" {
+				if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != tt.wantErr {
+					t.Fatalf("retry error = %v, want %s", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+
+			if tt.wantSame && (orderID != firstID || paymentURL != firstURL) {
+				t.Errorf("retry = %s %s, want the original %s %s", orderID, paymentURL, firstID, firstURL)
+			}
+			if !tt.wantSame && tt.wantErr == "" && orderID == firstID {
+				t.Errorf("retry returned the original order %s, want a new one", firstID)
+			}
+			if len(ts.store.orders) != tt.wantCount {
+				t.Errorf("stored %d orders, want %d", len(ts.store.orders), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestCreateOrderRecoversWhenCompletingTheKeyFails(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	items := []models.OrderItem{testItem(product, 2)}
+
+	ts.keys.completeErr = stderrors.New("connection reset")
+	firstID, _, err := ts.CreateOrder(testOrder(customerID), items, "key-1")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	ts.keys.completeErr = nil
+	orderID, paymentURL, err := ts.CreateOrder(testOrder(customerID), items, "key-1")
+	if err != nil {
+		t.Fatalf("retry: %v, want the original order", err)
+	}
+	if orderID != firstID || paymentURL != "https://pay.example/"+firstID {
+		t.Errorf("retry = %s %s, want order %s", orderID, paymentURL, firstID)
+	}
+
+	key := ts.keys.keys[customerID.String()+"/key-1"]
+	if key.OrderID == nil || key.OrderID.String() != firstID {
+		t.Errorf("key order = %v, want the retry to record %s", key.OrderID, firstID)
+	}
+}
+
+func TestCreateOrderReportsAKeyStillInProgress(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	items := []models.OrderItem{testItem(product, 2)}
+
+	// Another request holds the key but has not stored its order yet.
+	if _, _, err := ts.keys.Reserve(&models.IdempotencyKey{
+		CustomerID:  customerID,
+		Key:         "key-1",
+		RequestHash: hashOrderRequest(testOrder(customerID), items),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	_, _, err := ts.CreateOrder(testOrder(customerID), items, "key-1")
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("CreateOrder error = %v, want a conflict", err)
+	}
+	if len(ts.store.orders) != 0 {
+		t.Errorf("stored %d orders, want none", len(ts.store.orders))
+	}
+}
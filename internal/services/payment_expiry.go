@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+// expiryRetryDelay is how long an unpaid order whose cancellation failed is
+// left alone before it is tried again.
+const expiryRetryDelay = 15 * time.Minute
+
+// ExpirePendingOrders cancels up to limit orders that have been waiting for
+// payment since before createdBefore and returns their stock. Each order is
+// cancelled in its own transaction, so one that fails is logged and tried
+// again after expiryRetryDelay without holding up the others. It returns the
+// number of orders cancelled, and an error when any of them could not be.
+func (s *orderService) ExpirePendingOrders(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	orders, err := s.orderRepo.ListExpiredPaymentPending(createdBefore, time.Now().Add(-expiryRetryDelay), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled, failed := 0, 0
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			break
+		}
+
+		c, err := s.expireOrder(order.ID.String())
+		if err != nil {
+			failed++
+			utils.Error("Failed to cancel unpaid order", map[string]interface{}{
+				"order_id": order.ID.String(),
+				"error":    err.Error(),
+			})
+			if err := s.orderRepo.MarkExpiryFailed(order.ID.String(), time.Now()); err != nil {
+				utils.Error("Failed to record failed order expiry", map[string]interface{}{
+					"order_id": order.ID.String(),
+					"error":    err.Error(),
+				})
+			}
+			continue
+		}
+		if c == nil {
+			continue
+		}
+
+		s.completeCancellation(ctx, c)
+		cancelled++
+	}
+
+	if failed > 0 {
+		return cancelled, fmt.Errorf("failed to cancel %d of %d unpaid orders", failed, len(orders))
+	}
+	return cancelled, nil
+}
+
+// expireOrder cancels the unpaid order in a transaction of its own. It
+// returns nil when the order was paid, changed or claimed by another replica
+// since it was listed.
+func (s *orderService) expireOrder(orderID string) (*cancellation, error) {
+	var c *cancellation
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		claimed, err := repos.Orders.ClaimPaymentPending(orderID)
+		if err != nil || !claimed {
+			return err
+		}
+
+		c, err = cancelOrder(repos, orderID, statemachine.ActorSystem, string(statemachine.ActorSystem), models.CancellationReasonPaymentTimeout)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestExpirePendingOrdersCancelsEachOrderOnItsOwn(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	failing := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+	expiring := ts.placeTestOrder(t, uuid.New(), testItem(product, 2))
+	ts.store.fail["UpdateOrderStatus "+failing] = stderrors.New("deadlock detected")
+
+	cancelled, err := ts.ExpirePendingOrders(context.Background(), time.Now().Add(time.Minute), 10)
+	if err == nil {
+		t.Error("ExpirePendingOrders did not report the failed order")
+	}
+	if cancelled != 1 {
+		t.Errorf("cancelled %d orders, want 1", cancelled)
+	}
+
+	if got := ts.order(expiring).Status; got != models.OrderStatusCancelled {
+		t.Errorf("expired order status = %s, want %s", got, models.OrderStatusCancelled)
+	}
+	if got := ts.order(failing).Status; got != models.OrderStatusPaymentPending {
+		t.Errorf("failed order status = %s, want it left %s for the next run", got, models.OrderStatusPaymentPending)
+	}
+
+	// The failed order is tried again once its retry delay has passed.
+	delete(ts.store.fail, "UpdateOrderStatus "+failing)
+	if cancelled, _ := ts.ExpirePendingOrders(context.Background(), time.Now().Add(time.Minute), 10); cancelled != 0 {
+		t.Fatalf("cancelled %d orders before the retry delay passed, want 0", cancelled)
+	}
+	ts.rewindExpiryFailure(failing, expiryRetryDelay)
+	cancelled, err = ts.ExpirePendingOrders(context.Background(), time.Now().Add(time.Minute), 10)
+	if err != nil || cancelled != 1 {
+		t.Fatalf("second run cancelled %d orders, err = %v; want the failed order cancelled", cancelled, err)
+	}
+	if got := ts.order(failing).Status; got != models.OrderStatusCancelled {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusCancelled)
+	}
+}
+
+func TestExpirePendingOrdersIsNotHeldUpByFailingOrders(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	failing := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+	ts.rewindCreation(failing, time.Hour)
+	expiring := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+	ts.store.fail["UpdateOrderStatus "+failing] = stderrors.New("deadlock detected")
+
+	// Batches of one: the oldest order fails, and the next batch goes on
+	// with the other order instead of trying the failing one again.
+	createdBefore := time.Now().Add(time.Minute)
+	if _, err := ts.ExpirePendingOrders(context.Background(), createdBefore, 1); err == nil {
+		t.Fatal("ExpirePendingOrders did not report the failed order")
+	}
+	cancelled, err := ts.ExpirePendingOrders(context.Background(), createdBefore, 1)
+	if err != nil || cancelled != 1 {
+		t.Fatalf("second batch cancelled %d orders, err = %v; want the other order cancelled", cancelled, err)
+	}
+	if got := ts.order(expiring).Status; got != models.OrderStatusCancelled {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusCancelled)
+	}
+
+	// Once its delay has passed, an order that failed comes after those
+	// never tried.
+	ts.rewindExpiryFailure(failing, expiryRetryDelay)
+	fresh := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+	if _, err := ts.ExpirePendingOrders(context.Background(), createdBefore, 1); err != nil {
+		t.Fatalf("third batch: %v", err)
+	}
+	if got := ts.order(fresh).Status; got != models.OrderStatusCancelled {
+		t.Errorf("never tried order status = %s, want it cancelled before the failing one is retried", got)
+	}
+}
+
+// rewindCreation moves the order's creation back by d.
+func (ts *testService) rewindCreation(orderID string, d time.Duration) {
+	order := ts.order(orderID)
+	order.CreatedAt = order.CreatedAt.Add(-d)
+	ts.store.orders[order.ID] = order
+}
+
+// rewindExpiryFailure moves the order's last failed expiry back by d.
+func (ts *testService) rewindExpiryFailure(orderID string, d time.Duration) {
+	order := ts.order(orderID)
+	failedAt := order.ExpiryFailedAt.Add(-d)
+	order.ExpiryFailedAt = &failedAt
+	ts.store.orders[order.ID] = order
+}
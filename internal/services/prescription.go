@@ -0,0 +1,74 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+)
+
+// prescriptionLines returns the items still on order that need a
+// prescription.
+func prescriptionLines(orderItems []models.OrderItem) []models.OrderItem {
+	var lines []models.OrderItem
+	for _, item := range activeItems(orderItems) {
+		if item.TaxCategory == models.TaxCategoryPrescription {
+			lines = append(lines, item)
+		}
+	}
+	return lines
+}
+
+// missingPrescriptions returns the indexes of the prescription lines in
+// orderItems that have no prescription of their own. The order-level
+// prescription URL sent by older clients cannot say which product it is
+// for, so it only stands in for the prescription of an order's single
+// prescription line.
+func missingPrescriptions(order *models.Order, orderItems []models.OrderItem) []int {
+	if order.PrescriptionURL != nil && len(prescriptionLines(orderItems)) == 1 {
+		return nil
+	}
+
+	var missing []int
+	for i, item := range orderItems {
+		if item.Quantity > 0 && item.TaxCategory == models.TaxCategoryPrescription && item.Prescription == nil && item.PrescriptionID == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// validatePrescription checks a prescription attached to an order line and
+// returns the failing fields, prefixed with field, e.g.
+// "items[0].prescription.expires_at".
+func validatePrescription(field string, prescription *models.Prescription, now time.Time) map[string]string {
+	fields := map[string]string{}
+
+	if strings.TrimSpace(prescription.PrescriberName) == "" {
+		fields[field+".prescriber_name"] = "Prescriber name is required"
+	}
+
+	if strings.TrimSpace(prescription.FileURL) == "" {
+		fields[field+".file_url"] = "Prescription file is required"
+	}
+
+	if prescription.IssuedAt.IsZero() {
+		fields[field+".issued_at"] = "Issue date is required"
+	} else if prescription.IssuedAt.After(now) {
+		fields[field+".issued_at"] = "Issue date cannot be in the future"
+	}
+
+	if prescription.ExpiresAt.IsZero() {
+		fields[field+".expires_at"] = "Expiry date is required"
+	} else if !prescription.ExpiresAt.After(now) {
+		fields[field+".expires_at"] = "Prescription has expired"
+	} else if prescription.ExpiresAt.Before(prescription.IssuedAt) {
+		fields[field+".expires_at"] = "Expiry date must be after the issue date"
+	}
+
+	if prescription.RefillsAllowed < 0 {
+		fields[field+".refills_allowed"] = "Refills allowed cannot be negative"
+	}
+
+	return fields
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// ReviewPrescription records a pharmacist's decision on a paid order's
+// prescription. Approval releases the order for fulfilment; rejection
+// cancels it and returns its stock.
+func (s *orderService) ReviewPrescription(orderID string, caller *auth.Principal, decision string, reason *string) error {
+	if !s.policy.Allows(caller, rbac.RPCReviewPrescription) {
+		return errors.NewAuthError("Access denied")
+	}
+
+	reviewerID := caller.Subject
+	reviewerUUID, err := uuid.Parse(reviewerID)
+	if err != nil {
+		return errors.NewValidationError("reviewer_id", "Invalid reviewer ID")
+	}
+
+	var status string
+	switch decision {
+	case models.PrescriptionDecisionApproved:
+		status = models.OrderStatusApproved
+	case models.PrescriptionDecisionRejected:
+		status = models.OrderStatusCancelled
+		if reason == nil || *reason == "" {
+			return errors.NewValidationError("reason", "A reason is required when rejecting a prescription")
+		}
+	default:
+		return errors.NewValidationError("decision", "Decision must be 'approved' or 'rejected'")
+	}
+
+	var c *cancellation
+	err = s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		order, _, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if !order.RequiresPrescription {
+			return errors.NewBadRequestError("Order does not require a prescription")
+		}
+
+		if order.Status != models.OrderStatusPaid {
+			return errors.NewConflictError("Only paid orders awaiting review can have their prescription reviewed")
+		}
+
+		actor, err := s.transitionActor(caller, order.Status, status)
+		if err != nil {
+			return err
+		}
+
+		err = repos.PrescriptionReviews.AddReview(&models.PrescriptionReview{
+			OrderID:    order.ID,
+			ReviewerID: reviewerUUID,
+			Decision:   decision,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		if status == models.OrderStatusCancelled {
+			c, err = cancelOrder(repos, orderID, actor, reviewerID, models.CancellationReasonPrescriptionRejected)
+			return err
+		}
+		return repos.Orders.UpdateOrderStatus(orderID, status, actor, reviewerID, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	if c != nil {
+		s.completeCancellation(context.Background(), c)
+	}
+
+	return nil
+}
+
+func (s *orderService) ListPendingPrescriptions(caller *auth.Principal, page, limit int32) (*[]OrderResponse, int32, error) {
+	if !s.policy.Allows(caller, rbac.RPCListPendingPrescriptions) {
+		return nil, 0, errors.NewAuthError("Access denied")
+	}
+
+	ordersResponse := []OrderResponse{}
+
+	orders, total, err := s.orderRepo.ListPendingPrescriptions(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, order := range orders {
+		ordersResponse = append(ordersResponse, newOrderResponse(order, order.Items))
+	}
+
+	return &ordersResponse, total, nil
+}
+
+// restockItems returns the stock held by the given items. Failures are logged
+// so an operator can correct the inventory by hand.
+func (s *orderService) restockItems(ctx context.Context, orderID string, items []models.OrderItem, reason string) {
+	for _, item := range items {
+		if item.Quantity == 0 {
+			continue
+		}
+		if err := s.stockService.AdjustStock(ctx, item.ProductID.String(), item.Quantity, reason); err != nil {
+			utils.Error("Failed to restock order item", map[string]interface{}{
+				"order_id":   orderID,
+				"product_id": item.ProductID.String(),
+				"quantity":   item.Quantity,
+				"reason":     reason,
+				"error":      err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestPlaceOrderLegacyPrescriptionURL(t *testing.T) {
+	legacyURL := "https://files.example/legacy.pdf"
+
+	tests := []struct {
+		name    string
+		items   func(rx1, rx2, otc *models.OrderItem) []models.OrderItem
+		wantErr bool
+	}{
+		{
+			name:  "covers a single prescription line",
+			items: func(rx1, rx2, otc *models.OrderItem) []models.OrderItem { return []models.OrderItem{*rx1, *otc} },
+		},
+		{
+			name:    "does not cover two prescription lines",
+			items:   func(rx1, rx2, otc *models.OrderItem) []models.OrderItem { return []models.OrderItem{*rx1, *rx2} },
+			wantErr: true,
+		},
+		{
+			name: "does not cover one of two lines when the other has its own",
+			items: func(rx1, rx2, otc *models.OrderItem) []models.OrderItem {
+				rx2.Prescription = testPrescription()
+				return []models.OrderItem{*rx1, *rx2}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amoxicillin := testRxProduct("Amoxicillin", 12.00, 5)
+			insulin := testRxProduct("Insulin", 30.00, 5)
+			ibuprofen := testProduct("Ibuprofen", 10.00, 5)
+			ts := newTestService(amoxicillin, insulin, ibuprofen)
+
+			rx1, rx2, otc := testItem(amoxicillin, 1), testItem(insulin, 1), testItem(ibuprofen, 1)
+			order := testOrder(uuid.New())
+			order.PrescriptionURL = &legacyURL
+
+			_, _, err := ts.placeOrder(order, tt.items(&rx1, &rx2, &otc))
+			if tt.wantErr {
+				if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+					t.Fatalf("placeOrder error = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("placeOrder: %v", err)
+			}
+		})
+	}
+}
+
+func TestAmendOrderRecomputesRequiresPrescription(t *testing.T) {
+	amoxicillin := testRxProduct("Amoxicillin", 12.00, 5)
+	ibuprofen := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(amoxicillin, ibuprofen)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testRxItem(amoxicillin, 1), testItem(ibuprofen, 1))
+
+	if !ts.order(orderID).RequiresPrescription {
+		t.Fatal("order with a prescription line does not require a prescription")
+	}
+
+	removeRx := models.OrderItem{ID: ts.items(orderID)[0].ID}
+	if _, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{removeRx}); err != nil {
+		t.Fatalf("AmendOrder: %v", err)
+	}
+
+	if ts.order(orderID).RequiresPrescription {
+		t.Error("order still requires a prescription after its prescription line was removed")
+	}
+}
+
+func TestAmendOrderLegacyPrescriptionURLCoversOneLine(t *testing.T) {
+	amoxicillin := testRxProduct("Amoxicillin", 12.00, 5)
+	insulin := testRxProduct("Insulin", 30.00, 5)
+	ts := newTestService(amoxicillin, insulin)
+	customerID := uuid.New()
+
+	legacyURL := "https://files.example/legacy.pdf"
+	order := testOrder(customerID)
+	order.PrescriptionURL = &legacyURL
+	orderID, _, err := ts.placeOrder(order, []models.OrderItem{testItem(amoxicillin, 1)})
+	if err != nil {
+		t.Fatalf("placeOrder: %v", err)
+	}
+
+	_, err = ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{testItem(insulin, 1)})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("AmendOrder error = %v, want a validation error", err)
+	}
+
+	if _, err := ts.AmendOrder(orderID, customer(customerID), []models.OrderItem{testRxItem(insulin, 1)}); err == nil {
+		t.Fatal("AmendOrder accepted a second prescription line while the first is only covered by the order's prescription URL")
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+// ListRefunds lets an operator find refunds, typically the failed ones that
+// need a retry.
+func (s *orderService) ListRefunds(caller *auth.Principal, status string, page, limit int32) ([]models.Refund, int32, error) {
+	if !s.policy.Allows(caller, rbac.RPCListRefunds) {
+		return nil, 0, errors.NewAuthError("Access denied")
+	}
+
+	switch status {
+	case "", models.RefundStatusPending, models.RefundStatusSucceeded, models.RefundStatusFailed, models.RefundStatusNotRequired:
+	default:
+		return nil, 0, errors.NewValidationError("status", fmt.Sprintf("Unknown refund status '%s'", status))
+	}
+
+	var refunds []models.Refund
+	var total int32
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		var err error
+		refunds, total, err = repos.Refunds.ListRefunds(status, page, limit)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return refunds, total, nil
+}
+
+// RetryRefund sends a failed refund to the payment service again.
+func (s *orderService) RetryRefund(refundID string, caller *auth.Principal) (*models.Refund, error) {
+	if !s.policy.Allows(caller, rbac.RPCRetryRefund) {
+		return nil, errors.NewAuthError("Access denied")
+	}
+
+	var refund *models.Refund
+	err := s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Refunds.ClaimForRetry(refundID); err != nil {
+			if _, getErr := repos.Refunds.GetRefundByID(refundID); getErr != nil {
+				return getErr
+			}
+			return err
+		}
+
+		var err error
+		refund, err = repos.Refunds.GetRefundByID(refundID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order, _, err := s.orderRepo.GetOrderByID(refund.OrderID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.processRefund(context.Background(), refund, order.CustomerID.String()); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// paymentStatusCaptured is the status of a payment whose money has been
+// taken from the customer.
+const paymentStatusCaptured = "captured"
+
+// notCapturedError is returned by refundPayment when the order has no
+// captured payment, so there is nothing to refund.
+type notCapturedError struct {
+	reason string
+}
+
+func (e *notCapturedError) Error() string {
+	return e.reason
+}
+
+// processRefund sends a recorded refund to the payment service and stores
+// the outcome on the refund and the order. A failed refund is kept with its
+// error so it can be retried; only a failure to store the outcome is
+// returned.
+func (s *orderService) processRefund(ctx context.Context, refund *models.Refund, customerID string) error {
+	transactionID, err := s.refundPayment(ctx, refund, customerID)
+	if notCaptured, ok := err.(*notCapturedError); ok {
+		utils.Warn("Refund not required", map[string]interface{}{
+			"refund_id": refund.ID.String(),
+			"order_id":  refund.OrderID.String(),
+			"amount":    refund.Amount.String(),
+			"reason":    notCaptured.reason,
+		})
+
+		refund.Status = models.RefundStatusNotRequired
+		refund.LastError = &notCaptured.reason
+		refund.Attempts++
+
+		return s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+			if err := repos.Refunds.MarkNotRequired(refund.ID.String(), notCaptured.reason); err != nil {
+				return err
+			}
+			return addRefundEvent(repos, refund)
+		})
+	}
+	if err != nil {
+		utils.Error("Refund failed", map[string]interface{}{
+			"refund_id": refund.ID.String(),
+			"order_id":  refund.OrderID.String(),
+			"amount":    refund.Amount.String(),
+			"error":     err.Error(),
+		})
+
+		refund.Status = models.RefundStatusFailed
+		reason := err.Error()
+		refund.LastError = &reason
+		refund.Attempts++
+
+		return s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+			if err := repos.Refunds.MarkFailed(refund.ID.String(), reason); err != nil {
+				return err
+			}
+			return addRefundEvent(repos, refund)
+		})
+	}
+
+	refund.Status = models.RefundStatusSucceeded
+	refund.TransactionID = &transactionID
+	refund.LastError = nil
+	refund.Attempts++
+
+	err = s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Refunds.MarkSucceeded(refund.ID.String(), transactionID); err != nil {
+			return err
+		}
+		// A stale payment never paid for the order, so returning it does
+		// not reduce what the order has been paid.
+		if refund.Reason != models.RefundReasonStalePayment {
+			if err := repos.Orders.AddRefundedAmount(refund.OrderID.String(), refund.Amount); err != nil {
+				return err
+			}
+		}
+		return addRefundEvent(repos, refund)
+	})
+	if err != nil {
+		// The customer has been refunded; the record must not be retried.
+		utils.Error("Failed to record successful refund", map[string]interface{}{
+			"refund_id":      refund.ID.String(),
+			"order_id":       refund.OrderID.String(),
+			"transaction_id": transactionID,
+			"error":          err.Error(),
+		})
+	}
+
+	return err
+}
+
+// recordStalePaymentRefund records a refund of the whole of a captured
+// payment that does not pay for the order. A payment that already has a
+// refund is not recorded again, since the payment service may report the
+// same payment more than once; nil is returned then.
+func recordStalePaymentRefund(repos repositories.TxRepositories, order *models.Order, payment *proto.GetPaymentResponse) (*models.Refund, error) {
+	_, err := repos.Refunds.GetRefundByTransactionID(payment.TransactionId)
+	if err == nil {
+		return nil, nil
+	}
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.NotFoundError {
+		return nil, err
+	}
+
+	transactionID := payment.TransactionId
+	refund := &models.Refund{
+		OrderID:       order.ID,
+		Reason:        models.RefundReasonStalePayment,
+		Amount:        money.FromFloat(payment.Amount),
+		Currency:      order.Currency,
+		Status:        models.RefundStatusPending,
+		TransactionID: &transactionID,
+	}
+	if err := repos.Refunds.CreateRefund(refund); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+func addRefundEvent(repos repositories.TxRepositories, refund *models.Refund) error {
+	event, err := outbox.NewRefundEvent(refund)
+	if err != nil {
+		return err
+	}
+	return repos.OrderEvents.AddEvent(event)
+}
+
+// refundPayment looks up the order's payment, or the refund's payment when
+// it names one, and refunds the amount of the given refund, or returns a
+// *notCapturedError when no payment was captured. A refund of the whole
+// payment is sent without an amount, so a payment service that ignores the
+// amount cannot turn a partial refund into a full one. It returns the
+// transaction ID of the refunded payment.
+func (s *orderService) refundPayment(ctx context.Context, refund *models.Refund, customerID string) (string, error) {
+	var payment *proto.GetPaymentResponse
+	var err error
+	if refund.TransactionID != nil {
+		payment, err = s.paymentClient.GetPaymentByTransactionID(ctx, &proto.GetPaymentByTransactionIDRequest{
+			TransactionId: *refund.TransactionID,
+			CustomerId:    customerID,
+		})
+	} else {
+		payment, err = s.paymentClient.GetPaymentByOrderID(ctx, &proto.GetPaymentByOrderIDRequest{
+			OrderId:    refund.OrderID.String(),
+			CustomerId: customerID,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	if !payment.Success {
+		if payment.Error != nil {
+			if payment.Error.Type == string(errors.NotFoundError) {
+				return "", &notCapturedError{reason: "the order has no payment"}
+			}
+			return "", fmt.Errorf("payment lookup failed: %s", payment.Error.Message)
+		}
+		return "", fmt.Errorf("payment lookup failed")
+	}
+	if payment.Status != paymentStatusCaptured {
+		return "", &notCapturedError{reason: fmt.Sprintf("payment status is '%s'", payment.Status)}
+	}
+
+	request := &proto.RefundPaymentRequest{TransactionId: payment.TransactionId}
+	if refund.Amount < money.FromFloat(payment.Amount) {
+		if !s.partialRefunds {
+			return "", fmt.Errorf("partial refunds are not supported by the payment service")
+		}
+		request.Amount = &proto.Money{
+			CurrencyCode: refund.Currency,
+			AmountMinor:  int64(refund.Amount),
+		}
+	}
+
+	resp, err := s.paymentClient.RefundPayment(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return "", fmt.Errorf("refund rejected: %s", resp.Error.Message)
+		}
+		return "", fmt.Errorf("refund rejected")
+	}
+
+	return payment.TransactionId, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestRefundPaymentSendsAmountOnlyForPartialRefunds(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 3))
+	ts.payTestOrder(t, orderID)
+	order := ts.order(orderID)
+
+	full := &models.Refund{OrderID: order.ID, Amount: order.GrandTotal(), Currency: "CAD"}
+	if _, err := ts.refundPayment(context.Background(), full, customerID.String()); err != nil {
+		t.Fatalf("full refund: %v", err)
+	}
+	if request := ts.payments.refunds[0]; request.Amount != nil {
+		t.Errorf("full refund sent amount %+v, want none", request.Amount)
+	}
+
+	partial := &models.Refund{OrderID: order.ID, Amount: 1234, Currency: "CAD"}
+	if _, err := ts.refundPayment(context.Background(), partial, customerID.String()); err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	request := ts.payments.refunds[1]
+	if request.Amount == nil || request.Amount.AmountMinor != 1234 || request.Amount.CurrencyCode != "CAD" {
+		t.Errorf("partial refund sent amount %+v, want CAD 1234 minor units", request.Amount)
+	}
+}
+
+func TestRefundPaymentRefusesPartialRefundsWhenDisabled(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	ts.partialRefunds = false
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 3))
+	ts.payTestOrder(t, orderID)
+
+	partial := &models.Refund{OrderID: ts.order(orderID).ID, Amount: 1000, Currency: "CAD"}
+	if _, err := ts.refundPayment(context.Background(), partial, customerID.String()); err == nil {
+		t.Fatal("partial refund succeeded with partial refunds disabled")
+	}
+	if len(ts.payments.refunds) != 0 {
+		t.Errorf("sent %d refunds to the payment service, want none", len(ts.payments.refunds))
+	}
+}
+
+func TestPartialRefundOperationsRefusedWhenDisabled(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	ts.partialRefunds = false
+	customerID := uuid.New()
+	orderID := ts.placeTestOrder(t, customerID, testItem(product, 3))
+	ts.payTestOrder(t, orderID)
+	item := ts.items(orderID)[0]
+
+	_, _, err := ts.CancelOrderItems(orderID, customer(customerID), []CancelItemRequest{{ItemID: item.ID, Quantity: 1}})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("CancelOrderItems error = %v, want a conflict", err)
+	}
+	if got := ts.items(orderID)[0].Quantity; got != 3 {
+		t.Errorf("quantity = %d, want the line unchanged", got)
+	}
+
+	_, err = ts.ApproveReturn(uuid.NewString(), staff(auth.RoleAdmin), models.ReturnStatusApproved, nil)
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("ApproveReturn error = %v, want a conflict", err)
+	}
+}
+
+func TestRefundNotRequiredWithoutCapturedPayment(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(ts *testService, orderID string)
+	}{
+		{"payment not captured", func(ts *testService, orderID string) {
+			ts.payments.payments[orderID].Status = "authorized"
+		}},
+		{"no payment", func(ts *testService, orderID string) {
+			delete(ts.payments.payments, orderID)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := testProduct("Ibuprofen", 10.00, 10)
+			ts := newTestService(product)
+			customerID := uuid.New()
+			orderID := ts.placeTestOrder(t, customerID, testItem(product, 3))
+			ts.payTestOrder(t, orderID)
+			tt.setup(ts, orderID)
+
+			if err := ts.UpdateOrderStatus(orderID, customer(customerID), models.OrderStatusCancelled); err != nil {
+				t.Fatalf("UpdateOrderStatus(cancelled): %v", err)
+			}
+
+			if len(ts.payments.refunds) != 0 {
+				t.Errorf("sent %d refunds to the payment service, want none", len(ts.payments.refunds))
+			}
+			if len(ts.store.refunds) != 1 || ts.store.refunds[0].Status != models.RefundStatusNotRequired {
+				t.Fatalf("refunds = %+v, want one that is not required", ts.store.refunds)
+			}
+			if got := ts.order(orderID).RefundedTotal; got != 0 {
+				t.Errorf("refunded total = %s, want 0", got)
+			}
+			types := ts.eventTypes(orderID)
+			if types[len(types)-1] != models.OrderEventRefundNotRequired {
+				t.Errorf("events = %v, want %s last", types, models.OrderEventRefundNotRequired)
+			}
+		})
+	}
+}
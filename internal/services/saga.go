@@ -0,0 +1,46 @@
+package services
+
+import (
+	"github.com/PharmaKart/order-svc/pkg/utils"
+)
+
+// saga records the compensating action of every step that has completed so a
+// multi-service operation can be undone when a later step fails.
+type saga struct {
+	name  string
+	steps []sagaStep
+}
+
+type sagaStep struct {
+	name       string
+	compensate func() error
+}
+
+func newSaga(name string) *saga {
+	return &saga{name: name}
+}
+
+// Completed registers the compensation for a step that has just succeeded.
+func (s *saga) Completed(step string, compensate func() error) {
+	s.steps = append(s.steps, sagaStep{name: step, compensate: compensate})
+}
+
+// Abort runs the recorded compensations in reverse order and returns the
+// original error. Compensation failures are logged and do not stop the
+// remaining compensations from running.
+func (s *saga) Abort(cause error) error {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if err := step.compensate(); err != nil {
+			utils.Error("Saga compensation failed", map[string]interface{}{
+				"saga":  s.name,
+				"step":  step.name,
+				"cause": cause.Error(),
+				"error": err.Error(),
+			})
+		}
+	}
+	s.steps = nil
+
+	return cause
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/internal/statemachine"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// ShipmentItemRequest is a quantity of one order item put into a shipment.
+type ShipmentItemRequest struct {
+	ItemID   uuid.UUID
+	Quantity int
+}
+
+// CreateShipment records a parcel sent to the customer. The first shipment
+// moves an approved order to shipped; later ones ship whatever is left. When
+// no items are given, every unshipped quantity goes into the shipment.
+func (s *orderService) CreateShipment(orderID string, caller *auth.Principal, shipment *models.Shipment, items []ShipmentItemRequest) error {
+	if !s.policy.Allows(caller, rbac.RPCCreateShipment) {
+		return errors.NewAuthError("Access denied")
+	}
+
+	fields := map[string]string{}
+	if shipment.Carrier == "" {
+		fields["carrier"] = "Carrier is required"
+	}
+	if shipment.TrackingNumber == "" {
+		fields["tracking_number"] = "Tracking number is required"
+	}
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			fields[fmt.Sprintf("items[%d].quantity", i)] = "Quantity must be greater than zero"
+		}
+	}
+	if len(fields) > 0 {
+		return errors.NewValidationErrors(fields)
+	}
+
+	return s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		order, orderItems, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderStatusApproved && order.Status != models.OrderStatusShipped {
+			return errors.NewConflictError(fmt.Sprintf("Cannot ship an order with status '%s'", order.Status))
+		}
+
+		shipmentItems, err := buildShipmentItems(*orderItems, unshippedQuantities(order, *orderItems), items)
+		if err != nil {
+			return err
+		}
+
+		shipment.OrderID = order.ID
+		shipment.Items = shipmentItems
+		if shipment.ShippedAt.IsZero() {
+			shipment.ShippedAt = time.Now()
+		}
+		if err := repos.Shipments.CreateShipment(shipment); err != nil {
+			return err
+		}
+
+		if order.Status == models.OrderStatusApproved {
+			actor, err := s.transitionActor(caller, order.Status, models.OrderStatusShipped)
+			if err != nil {
+				return err
+			}
+			return repos.Orders.UpdateOrderStatus(orderID, models.OrderStatusShipped, actor, caller.ID(), "")
+		}
+		return nil
+	})
+}
+
+// RecordDeliveryEvent appends a carrier scan to a shipment. A delivery scan
+// marks the shipment delivered, and the order completes once all of its
+// items have shipped and every shipment has been delivered.
+func (s *orderService) RecordDeliveryEvent(shipmentID string, caller *auth.Principal, event models.ShipmentEvent) error {
+	if !s.policy.Allows(caller, rbac.RPCRecordDeliveryEvent) {
+		return errors.NewAuthError("Access denied")
+	}
+
+	switch event.Status {
+	case models.ShipmentEventPickedUp, models.ShipmentEventInTransit, models.ShipmentEventOutForDelivery,
+		models.ShipmentEventDelivered, models.ShipmentEventException:
+	default:
+		return errors.NewValidationError("status", fmt.Sprintf("Unknown shipment event status '%s'", event.Status))
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	return s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		shipment, err := repos.Shipments.GetShipmentByID(shipmentID)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Orders.LockOrder(shipment.OrderID.String()); err != nil {
+			return err
+		}
+
+		event.ShipmentID = shipment.ID
+		if err := repos.Shipments.AddEvent(&event); err != nil {
+			return err
+		}
+
+		if event.Status != models.ShipmentEventDelivered || shipment.DeliveredAt != nil {
+			return nil
+		}
+
+		if err := repos.Shipments.MarkDelivered(shipment.ID.String(), event.OccurredAt); err != nil {
+			return err
+		}
+
+		order, orderItems, err := repos.Orders.GetOrderByID(shipment.OrderID.String())
+		if err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderStatusShipped || !fullyDelivered(order, *orderItems) {
+			return nil
+		}
+
+		return repos.Orders.UpdateOrderStatus(order.ID.String(), models.OrderStatusCompleted, statemachine.ActorSystem, string(statemachine.ActorSystem), "all shipments delivered")
+	})
+}
+
+// unshippedQuantities returns, per order item ID, the quantity not yet put
+// into any shipment.
+func unshippedQuantities(order *models.Order, orderItems []models.OrderItem) map[uuid.UUID]int {
+	remaining := make(map[uuid.UUID]int, len(orderItems))
+	for _, item := range orderItems {
+		remaining[item.ID] = item.Quantity
+	}
+	for _, shipment := range order.Shipments {
+		for _, item := range shipment.Items {
+			remaining[item.OrderItemID] -= item.Quantity
+		}
+	}
+	return remaining
+}
+
+func buildShipmentItems(orderItems []models.OrderItem, remaining map[uuid.UUID]int, requested []ShipmentItemRequest) ([]models.ShipmentItem, error) {
+	var shipmentItems []models.ShipmentItem
+
+	if len(requested) == 0 {
+		for _, item := range orderItems {
+			if remaining[item.ID] > 0 {
+				shipmentItems = append(shipmentItems, models.ShipmentItem{OrderItemID: item.ID, Quantity: remaining[item.ID]})
+			}
+		}
+		if len(shipmentItems) == 0 {
+			return nil, errors.NewConflictError("All items of this order have already shipped")
+		}
+		return shipmentItems, nil
+	}
+
+	fields := map[string]string{}
+	for i, request := range requested {
+		field := fmt.Sprintf("items[%d]", i)
+
+		orderItem := findItem(orderItems, request.ItemID)
+		if orderItem == nil {
+			fields[field+".item_id"] = "Item is not part of this order"
+			continue
+		}
+
+		if request.Quantity > remaining[orderItem.ID] {
+			fields[field+".quantity"] = fmt.Sprintf("Only %d left to ship", remaining[orderItem.ID])
+			continue
+		}
+		remaining[orderItem.ID] -= request.Quantity
+
+		shipmentItems = append(shipmentItems, models.ShipmentItem{OrderItemID: orderItem.ID, Quantity: request.Quantity})
+	}
+	if len(fields) > 0 {
+		return nil, errors.NewValidationErrors(fields)
+	}
+
+	return shipmentItems, nil
+}
+
+// fullyDelivered reports whether every item has shipped and every shipment
+// has been delivered. The order's shipments must be loaded after the latest
+// delivery was recorded.
+func fullyDelivered(order *models.Order, orderItems []models.OrderItem) bool {
+	for _, quantity := range unshippedQuantities(order, orderItems) {
+		if quantity > 0 {
+			return false
+		}
+	}
+	for _, shipment := range order.Shipments {
+		if shipment.DeliveredAt == nil {
+			return false
+		}
+	}
+	return len(order.Shipments) > 0
+}
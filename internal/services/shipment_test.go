@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestCreateShipmentByItemID(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 2), testItem(product, 3))
+	ts.setStatus(orderID, models.OrderStatusApproved)
+	items := ts.items(orderID)
+
+	shipment := &models.Shipment{Carrier: "Canada Post", TrackingNumber: "CP123"}
+	err := ts.CreateShipment(orderID, staff(auth.RoleWarehouse), shipment, []ShipmentItemRequest{{ItemID: items[1].ID, Quantity: 3}})
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	if len(shipment.Items) != 1 || shipment.Items[0].OrderItemID != items[1].ID || shipment.Items[0].Quantity != 3 {
+		t.Errorf("shipment items = %+v, want 3 of the second line", shipment.Items)
+	}
+	if got := ts.order(orderID).Status; got != models.OrderStatusShipped {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusShipped)
+	}
+
+	// The second line is fully shipped now; the first still has 2 to go.
+	err = ts.CreateShipment(orderID, staff(auth.RoleWarehouse), &models.Shipment{Carrier: "Canada Post", TrackingNumber: "CP124"}, []ShipmentItemRequest{{ItemID: items[1].ID, Quantity: 1}})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Details["items[0].quantity"] == "" {
+		t.Fatalf("CreateShipment error = %v, want a quantity error on the shipped line", err)
+	}
+}
+
+func TestCreateShipmentRejectsUnknownItem(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 10)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 2))
+	ts.setStatus(orderID, models.OrderStatusApproved)
+
+	shipment := &models.Shipment{Carrier: "Canada Post", TrackingNumber: "CP123"}
+	err := ts.CreateShipment(orderID, staff(auth.RoleWarehouse), shipment, []ShipmentItemRequest{{ItemID: uuid.New(), Quantity: 1}})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Details["items[0].item_id"] == "" {
+		t.Fatalf("CreateShipment error = %v, want an item_id error", err)
+	}
+}
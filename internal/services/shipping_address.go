@@ -0,0 +1,68 @@
+package services
+
+import (
+	"github.com/PharmaKart/order-svc/internal/address"
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/outbox"
+	"github.com/PharmaKart/order-svc/internal/rbac"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+)
+
+// UpdateShippingAddress lets an admin correct the address of an order that
+// has not shipped yet. The region and country cannot change because the
+// order's tax and shipping were charged for them.
+func (s *orderService) UpdateShippingAddress(orderID string, caller *auth.Principal, shippingAddress models.Address) error {
+	if !s.policy.Allows(caller, rbac.RPCUpdateShippingAddress) {
+		return errors.NewAuthError("Access denied")
+	}
+
+	shippingAddress = address.Normalize(shippingAddress)
+	if fields := s.addressValidator.Validate(shippingAddress); len(fields) > 0 {
+		return errors.NewValidationErrors(prefixFields("shipping_address", fields))
+	}
+
+	return s.unitOfWork.WithTx(func(repos repositories.TxRepositories) error {
+		if err := repos.Orders.LockOrder(orderID); err != nil {
+			return err
+		}
+
+		order, _, err := repos.Orders.GetOrderByID(orderID)
+		if err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case models.OrderStatusShipped, models.OrderStatusCompleted, models.OrderStatusCancelled, models.OrderStatusFailed:
+			return errors.NewConflictError("Shipping address can only be changed before the order ships")
+		}
+
+		if order.ShippingAddress.Country != shippingAddress.Country || order.ShippingAddress.Region != shippingAddress.Region {
+			return errors.NewValidationErrors(map[string]string{
+				"shipping_address.region":  "Region and country cannot be changed after the order is placed",
+				"shipping_address.country": "Region and country cannot be changed after the order is placed",
+			})
+		}
+
+		if err := repos.Orders.UpdateShippingAddress(orderID, shippingAddress); err != nil {
+			return err
+		}
+
+		event, err := outbox.NewShippingAddressChangedEvent(order.ID, shippingAddress)
+		if err != nil {
+			return err
+		}
+		return repos.OrderEvents.AddEvent(event)
+	})
+}
+
+// prefixFields namespaces validation error fields, e.g. "city" becomes
+// "shipping_address.city".
+func prefixFields(prefix string, fields map[string]string) map[string]string {
+	prefixed := make(map[string]string, len(fields))
+	for field, message := range fields {
+		prefixed[prefix+"."+field] = message
+	}
+	return prefixed
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/auth"
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestUpdateShippingAddress(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+
+	shipTo := testAddress()
+	shipTo.Line1 = "2 King Street"
+	if err := ts.UpdateShippingAddress(orderID, staff(auth.RoleSupport), shipTo); err != nil {
+		t.Fatalf("UpdateShippingAddress: %v", err)
+	}
+
+	if access := ts.store.access; len(access) < 2 || access[0] != "lock "+orderID || access[1] != "read "+orderID {
+		t.Errorf("access = %v, want the order locked before it is read", access)
+	}
+	if got := ts.order(orderID).ShippingAddress.Line1; got != "2 King Street" {
+		t.Errorf("line1 = %q, want the new address", got)
+	}
+	types := ts.eventTypes(orderID)
+	if len(types) != 2 || types[1] != models.OrderEventShippingAddressChanged {
+		t.Errorf("events = %v, want %s after %s", types, models.OrderEventShippingAddressChanged, models.OrderEventPlaced)
+	}
+}
+
+func TestUpdateShippingAddressRejectsRegionChange(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+	orderID := ts.placeTestOrder(t, uuid.New(), testItem(product, 1))
+
+	shipTo := testAddress()
+	shipTo.Region = "BC"
+	shipTo.PostalCode = "V6B 1A1"
+	err := ts.UpdateShippingAddress(orderID, staff(auth.RoleSupport), shipTo)
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("UpdateShippingAddress error = %v, want a validation error", err)
+	}
+	if len(ts.eventTypes(orderID)) != 1 {
+		t.Errorf("events = %v, want no event for a rejected change", ts.eventTypes(orderID))
+	}
+}
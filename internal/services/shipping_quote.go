@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/proto"
+	"github.com/PharmaKart/order-svc/internal/shipping"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+)
+
+// QuoteShipping prices shipping for a prospective cart with the same rules
+// used when the order is placed. It returns the quote and the cart subtotal.
+func (s *orderService) QuoteShipping(orderItems []models.OrderItem, method, region string) (*shipping.Quote, money.Amount, error) {
+	ctx := context.Background()
+
+	if len(orderItems) == 0 {
+		return nil, 0, errors.NewValidationError("items", "At least one item is required")
+	}
+
+	pricedItems := make([]models.OrderItem, len(orderItems))
+	subtotal := money.Amount(0)
+	for i, item := range orderItems {
+		if item.Quantity <= 0 {
+			return nil, 0, errors.NewValidationError("quantity", "Quantity must be greater than 0")
+		}
+
+		product, err := s.productClient.GetProduct(ctx, &proto.GetProductRequest{ProductId: item.ProductID.String()})
+		if err != nil {
+			return nil, 0, err
+		}
+		if !product.Success || product.Product == nil {
+			return nil, 0, errors.NewValidationError(fmt.Sprintf("items[%d].product_id", i), "Product not found")
+		}
+
+		item.Price = money.FromFloat(product.Product.Price)
+		item.WeightGrams = int(product.Product.WeightGrams)
+		pricedItems[i] = item
+		subtotal += item.Price.Mul(item.Quantity)
+	}
+
+	quote, err := s.shippingCalculator.Quote(shippingQuoteRequest(method, region, subtotal, pricedItems))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return quote, subtotal, nil
+}
+
+func shippingQuoteRequest(method, region string, subtotal money.Amount, orderItems []models.OrderItem) shipping.QuoteRequest {
+	items := make([]shipping.Item, len(orderItems))
+	for i, item := range orderItems {
+		items[i] = shipping.Item{
+			ProductID:   item.ProductID.String(),
+			Quantity:    item.Quantity,
+			Price:       item.Price,
+			WeightGrams: item.WeightGrams,
+		}
+	}
+
+	return shipping.QuoteRequest{
+		Method:   method,
+		Region:   region,
+		Subtotal: subtotal,
+		Items:    items,
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestQuoteShipping(t *testing.T) {
+	product := testProduct("Ibuprofen", 10.00, 5)
+	ts := newTestService(product)
+
+	quote, subtotal, err := ts.QuoteShipping([]models.OrderItem{testItem(product, 2)}, "", "ON")
+	if err != nil {
+		t.Fatalf("QuoteShipping: %v", err)
+	}
+	if subtotal != 2000 || quote.Cost != 1000 {
+		t.Errorf("subtotal = %s, cost = %s, want 20.00 and 10.00", subtotal, quote.Cost)
+	}
+}
+
+func TestQuoteShippingRejectsUnknownProduct(t *testing.T) {
+	ts := newTestService()
+
+	unknown := models.OrderItem{ProductID: uuid.New(), ProductName: "Unknown", Quantity: 1}
+	_, _, err := ts.QuoteShipping([]models.OrderItem{unknown}, "", "ON")
+	appErr, ok := errors.IsAppError(err)
+	if !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("QuoteShipping error = %v, want a validation error", err)
+	}
+	if _, ok := appErr.Details["items[0].product_id"]; !ok {
+		t.Errorf("details = %v, want items[0].product_id", appErr.Details)
+	}
+}
+
+func TestPlaceOrderRejectsUnknownProduct(t *testing.T) {
+	ts := newTestService()
+
+	unknown := models.OrderItem{ProductID: uuid.New(), ProductName: "Unknown", Quantity: 1}
+	_, _, err := ts.placeOrder(testOrder(uuid.New()), []models.OrderItem{unknown})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("placeOrder error = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/tax"
+	"github.com/google/uuid"
+)
+
+func taxItems(orderItems []models.OrderItem) []tax.Item {
+	items := make([]tax.Item, len(orderItems))
+	for i, item := range orderItems {
+		items[i] = tax.Item{
+			Index:    i,
+			Category: item.TaxCategory,
+			Amount:   item.Price.Mul(item.Quantity),
+		}
+	}
+	return items
+}
+
+// orderTaxLines links computed tax lines to the stored order items. The items
+// must already have their IDs.
+func orderTaxLines(orderID uuid.UUID, orderItems []models.OrderItem, lines []tax.Line) []models.OrderTaxLine {
+	taxLines := make([]models.OrderTaxLine, len(lines))
+	for i, line := range lines {
+		taxLines[i] = models.OrderTaxLine{
+			OrderID:     orderID,
+			OrderItemID: orderItems[line.Index].ID,
+			TaxRateID:   line.Rate.ID,
+			Name:        line.Rate.Name,
+			Region:      line.Rate.Region,
+			Category:    line.Category,
+			RatePPM:     line.Rate.RatePPM,
+			Amount:      line.Amount,
+		}
+	}
+	return taxLines
+}
@@ -0,0 +1,104 @@
+package shipping
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+)
+
+type Item struct {
+	ProductID string
+	Quantity  int
+	Price     money.Amount
+	// WeightGrams is the weight of one unit, 0 when the product has none.
+	WeightGrams int
+}
+
+type QuoteRequest struct {
+	Method   string
+	Region   string
+	Subtotal money.Amount
+	Items    []Item
+}
+
+type Quote struct {
+	Method string
+	Cost   money.Amount
+}
+
+type ShippingCalculator interface {
+	Quote(req QuoteRequest) (*Quote, error)
+}
+
+type rulesCalculator struct {
+	rules             Rules
+	regions           map[string]map[string]Rate
+	surchargeProducts map[string][]Surcharge
+}
+
+func NewRulesCalculator(rules Rules) ShippingCalculator {
+	regions := make(map[string]map[string]Rate)
+	for region, rates := range rules.Regions {
+		regions[strings.ToUpper(region)] = rates
+	}
+
+	surchargeProducts := make(map[string][]Surcharge)
+	for _, surcharge := range rules.Surcharges {
+		for _, productID := range surcharge.ProductIDs {
+			surchargeProducts[productID] = append(surchargeProducts[productID], surcharge)
+		}
+	}
+
+	return &rulesCalculator{
+		rules:             rules,
+		regions:           regions,
+		surchargeProducts: surchargeProducts,
+	}
+}
+
+func (c *rulesCalculator) Quote(req QuoteRequest) (*Quote, error) {
+	method := req.Method
+	if method == "" {
+		method = c.rules.DefaultMethod
+	}
+
+	rate, ok := c.rules.Methods[method]
+	if !ok {
+		return nil, errors.NewValidationError("shipping_method", fmt.Sprintf("Unsupported shipping method '%s'", method))
+	}
+
+	if override, ok := c.regions[strings.ToUpper(req.Region)][method]; ok {
+		rate = override
+	}
+
+	cost := rate.FlatRate + rate.PerKilogram.Mul(kilograms(req.Items))
+	if rate.FreeShippingThreshold != nil && req.Subtotal > *rate.FreeShippingThreshold {
+		cost = 0
+	}
+
+	for _, item := range req.Items {
+		for _, surcharge := range c.surchargeProducts[item.ProductID] {
+			if surcharge.PerUnit {
+				cost += surcharge.Amount.Mul(item.Quantity)
+			} else {
+				cost += surcharge.Amount
+			}
+		}
+	}
+
+	return &Quote{
+		Method: method,
+		Cost:   cost,
+	}, nil
+}
+
+// kilograms returns the weight of the items in started kilograms.
+func kilograms(items []Item) int {
+	grams := 0
+	for _, item := range items {
+		grams += item.WeightGrams * item.Quantity
+	}
+	return (grams + 999) / 1000
+}
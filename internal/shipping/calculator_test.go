@@ -0,0 +1,98 @@
+package shipping
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"github.com/PharmaKart/order-svc/pkg/money"
+)
+
+func TestRulesCalculatorQuote(t *testing.T) {
+	threshold := money.Amount(4000)
+	rules := Rules{
+		DefaultMethod: MethodStandard,
+		Methods: map[string]Rate{
+			MethodStandard: {FlatRate: 1000, FreeShippingThreshold: &threshold},
+			MethodExpress:  {FlatRate: 2500, PerKilogram: 250},
+		},
+		Regions: map[string]map[string]Rate{
+			"NU": {MethodStandard: {FlatRate: 3000}},
+		},
+		Surcharges: []Surcharge{
+			{Name: "cold_chain", ProductIDs: []string{"insulin"}, Amount: 500},
+			{Name: "hazmat", ProductIDs: []string{"spray"}, Amount: 100, PerUnit: true},
+		},
+	}
+	calculator := NewRulesCalculator(rules)
+
+	tests := []struct {
+		name       string
+		req        QuoteRequest
+		wantMethod string
+		wantCost   money.Amount
+	}{
+		{
+			name:       "default method",
+			req:        QuoteRequest{Region: "ON", Subtotal: 2000},
+			wantMethod: MethodStandard,
+			wantCost:   1000,
+		},
+		{
+			name:       "free above the threshold",
+			req:        QuoteRequest{Method: MethodStandard, Region: "ON", Subtotal: 4001},
+			wantMethod: MethodStandard,
+			wantCost:   0,
+		},
+		{
+			name:       "region override",
+			req:        QuoteRequest{Method: MethodStandard, Region: "nu", Subtotal: 5000},
+			wantMethod: MethodStandard,
+			wantCost:   3000,
+		},
+		{
+			name: "per started kilogram",
+			req: QuoteRequest{Method: MethodExpress, Region: "ON", Items: []Item{
+				{ProductID: "a", Quantity: 2, WeightGrams: 600},
+				{ProductID: "b", Quantity: 1, WeightGrams: 900},
+			}},
+			wantMethod: MethodExpress,
+			wantCost:   2500 + 3*250,
+		},
+		{
+			name: "no weight charge for unknown weights",
+			req: QuoteRequest{Method: MethodExpress, Region: "ON", Items: []Item{
+				{ProductID: "a", Quantity: 3},
+			}},
+			wantMethod: MethodExpress,
+			wantCost:   2500,
+		},
+		{
+			name: "surcharges apply above the threshold",
+			req: QuoteRequest{Region: "ON", Subtotal: 9000, Items: []Item{
+				{ProductID: "insulin", Quantity: 2},
+				{ProductID: "spray", Quantity: 3},
+			}},
+			wantMethod: MethodStandard,
+			wantCost:   500 + 3*100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := calculator.Quote(tt.req)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if quote.Method != tt.wantMethod || quote.Cost != tt.wantCost {
+				t.Errorf("quote = %s %s, want %s %s", quote.Method, quote.Cost, tt.wantMethod, tt.wantCost)
+			}
+		})
+	}
+}
+
+func TestRulesCalculatorRejectsUnknownMethod(t *testing.T) {
+	_, err := NewRulesCalculator(DefaultRules()).Quote(QuoteRequest{Method: "drone"})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ValidationError {
+		t.Fatalf("Quote error = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,98 @@
+package shipping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/PharmaKart/order-svc/pkg/money"
+)
+
+const (
+	MethodStandard = "standard"
+	MethodExpress  = "express"
+)
+
+// Rate is the price of one shipping method.
+type Rate struct {
+	FlatRate money.Amount `json:"flat_rate"`
+	// PerKilogram is charged on top of the flat rate for every started
+	// kilogram the order weighs.
+	PerKilogram money.Amount `json:"per_kilogram,omitempty"`
+	// FreeShippingThreshold waives the rate when the subtotal is above it.
+	FreeShippingThreshold *money.Amount `json:"free_shipping_threshold,omitempty"`
+}
+
+// Surcharge is added on top of the rate for every order that contains one of
+// the listed products, e.g. cold-chain medicines.
+type Surcharge struct {
+	Name       string       `json:"name"`
+	ProductIDs []string     `json:"product_ids"`
+	Amount     money.Amount `json:"amount"`
+	// PerUnit charges the amount for every unit instead of once per line.
+	PerUnit bool `json:"per_unit"`
+}
+
+// Rules is the shipping configuration. Region overrides replace the default
+// rate of a method for orders shipped to that region.
+type Rules struct {
+	DefaultMethod string                     `json:"default_method"`
+	Methods       map[string]Rate            `json:"methods"`
+	Regions       map[string]map[string]Rate `json:"regions"`
+	Surcharges    []Surcharge                `json:"surcharges"`
+}
+
+// DefaultRules charges 10.00 for standard shipping, free above 40.00.
+func DefaultRules() Rules {
+	threshold := money.Amount(4000)
+	return Rules{
+		DefaultMethod: MethodStandard,
+		Methods: map[string]Rate{
+			MethodStandard: {FlatRate: money.Amount(1000), FreeShippingThreshold: &threshold},
+		},
+	}
+}
+
+// LoadRules reads the rules from a JSON file. An empty path returns the
+// default rules.
+func LoadRules(path string) (Rules, error) {
+	if path == "" {
+		return DefaultRules(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, fmt.Errorf("failed to read shipping rules: %w", err)
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, fmt.Errorf("failed to parse shipping rules: %w", err)
+	}
+
+	if err := rules.validate(); err != nil {
+		return Rules{}, err
+	}
+
+	return rules, nil
+}
+
+func (r Rules) validate() error {
+	if len(r.Methods) == 0 {
+		return fmt.Errorf("shipping rules define no methods")
+	}
+
+	if _, ok := r.Methods[r.DefaultMethod]; !ok {
+		return fmt.Errorf("default shipping method '%s' is not defined", r.DefaultMethod)
+	}
+
+	for region, rates := range r.Regions {
+		for method := range rates {
+			if _, ok := r.Methods[method]; !ok {
+				return fmt.Errorf("region '%s' overrides unknown shipping method '%s'", region, method)
+			}
+		}
+	}
+
+	return nil
+}
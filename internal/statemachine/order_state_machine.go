@@ -0,0 +1,128 @@
+package statemachine
+
+import (
+	"fmt"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Actor identifies who is asking for a status change: the access policy
+// role that allowed it, or ActorSystem for changes the service makes on its
+// own. Who may request which change is decided by the rbac package.
+type Actor string
+
+const ActorSystem Actor = "system"
+
+// Event describes a single status change of an order.
+type Event struct {
+	OrderID string
+	From    string
+	To      string
+	Actor   Actor
+}
+
+// Hook runs inside the transaction that performs the status change. Returning
+// an error aborts the change.
+type Hook func(tx *gorm.DB, event Event) error
+
+type OrderStateMachine interface {
+	CanTransition(from, to string) error
+	Transition(tx *gorm.DB, event Event, apply func() error) error
+	OnEnter(state string, hook Hook)
+	OnExit(state string, hook Hook)
+}
+
+type transitionKey struct {
+	from string
+	to   string
+}
+
+type orderStateMachine struct {
+	transitions map[transitionKey]bool
+	states      map[string]bool
+	enterHooks  map[string][]Hook
+	exitHooks   map[string][]Hook
+}
+
+// NewOrderStateMachine returns the state machine with every legal order
+// transition.
+func NewOrderStateMachine() OrderStateMachine {
+	sm := &orderStateMachine{
+		transitions: make(map[transitionKey]bool),
+		states:      make(map[string]bool),
+		enterHooks:  make(map[string][]Hook),
+		exitHooks:   make(map[string][]Hook),
+	}
+
+	// Happy path
+	sm.allow(models.OrderStatusPending, models.OrderStatusPaid)
+	sm.allow(models.OrderStatusPaymentPending, models.OrderStatusPaid)
+	sm.allow(models.OrderStatusPaid, models.OrderStatusApproved)
+	sm.allow(models.OrderStatusApproved, models.OrderStatusShipped)
+	sm.allow(models.OrderStatusShipped, models.OrderStatusCompleted)
+
+	// Cancellation
+	sm.allow(models.OrderStatusPending, models.OrderStatusCancelled)
+	sm.allow(models.OrderStatusPaymentPending, models.OrderStatusCancelled)
+	sm.allow(models.OrderStatusPaid, models.OrderStatusCancelled)
+	sm.allow(models.OrderStatusApproved, models.OrderStatusCancelled)
+
+	// Order placement rolled back
+	sm.allow(models.OrderStatusPaymentPending, models.OrderStatusFailed)
+
+	return sm
+}
+
+func (sm *orderStateMachine) allow(from, to string) {
+	sm.transitions[transitionKey{from, to}] = true
+	sm.states[from] = true
+	sm.states[to] = true
+}
+
+func (sm *orderStateMachine) CanTransition(from, to string) error {
+	if !sm.states[to] {
+		return errors.NewValidationError("status", fmt.Sprintf("Unknown order status '%s'", to))
+	}
+
+	if !sm.transitions[transitionKey{from, to}] {
+		return errors.NewConflictError(fmt.Sprintf("Cannot transition order from '%s' to '%s'", from, to))
+	}
+
+	return nil
+}
+
+// Transition validates the event, runs the exit hooks of the current state,
+// applies the change and then runs the entry hooks of the new state.
+func (sm *orderStateMachine) Transition(tx *gorm.DB, event Event, apply func() error) error {
+	if err := sm.CanTransition(event.From, event.To); err != nil {
+		return err
+	}
+
+	for _, hook := range sm.exitHooks[event.From] {
+		if err := hook(tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	for _, hook := range sm.enterHooks[event.To] {
+		if err := hook(tx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sm *orderStateMachine) OnEnter(state string, hook Hook) {
+	sm.enterHooks[state] = append(sm.enterHooks[state], hook)
+}
+
+func (sm *orderStateMachine) OnExit(state string, hook Hook) {
+	sm.exitHooks[state] = append(sm.exitHooks[state], hook)
+}
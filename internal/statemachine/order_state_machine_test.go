@@ -0,0 +1,174 @@
+package statemachine
+
+import (
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+func TestCanTransition(t *testing.T) {
+	sm := NewOrderStateMachine()
+
+	tests := []struct {
+		from, to string
+		wantErr  errors.ErrorType
+	}{
+		// Legal edges.
+		{models.OrderStatusPending, models.OrderStatusPaid, ""},
+		{models.OrderStatusPaymentPending, models.OrderStatusPaid, ""},
+		{models.OrderStatusPaid, models.OrderStatusApproved, ""},
+		{models.OrderStatusApproved, models.OrderStatusShipped, ""},
+		{models.OrderStatusShipped, models.OrderStatusCompleted, ""},
+		{models.OrderStatusPending, models.OrderStatusCancelled, ""},
+		{models.OrderStatusPaymentPending, models.OrderStatusCancelled, ""},
+		{models.OrderStatusPaid, models.OrderStatusCancelled, ""},
+		{models.OrderStatusApproved, models.OrderStatusCancelled, ""},
+		{models.OrderStatusPaymentPending, models.OrderStatusFailed, ""},
+
+		// Illegal jumps.
+		{models.OrderStatusPending, models.OrderStatusCompleted, errors.ConflictError},
+		{models.OrderStatusShipped, models.OrderStatusPending, errors.ConflictError},
+		{models.OrderStatusPaid, models.OrderStatusShipped, errors.ConflictError},
+		{models.OrderStatusShipped, models.OrderStatusCancelled, errors.ConflictError},
+		{models.OrderStatusCompleted, models.OrderStatusCancelled, errors.ConflictError},
+		{models.OrderStatusCancelled, models.OrderStatusPaid, errors.ConflictError},
+		{models.OrderStatusFailed, models.OrderStatusPaymentPending, errors.ConflictError},
+		{models.OrderStatusPaid, models.OrderStatusFailed, errors.ConflictError},
+		{models.OrderStatusPaid, models.OrderStatusPaid, errors.ConflictError},
+
+		// Unknown target status.
+		{models.OrderStatusPaid, "refunded", errors.ValidationError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			err := sm.CanTransition(tt.from, tt.to)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CanTransition = %v, want nil", err)
+				}
+				return
+			}
+
+			appErr, ok := errors.IsAppError(err)
+			if !ok || appErr.Type != tt.wantErr {
+				t.Fatalf("CanTransition = %v, want a %s", err, tt.wantErr)
+			}
+			if tt.wantErr == errors.ConflictError && (!strings.Contains(appErr.Message, "'"+tt.from+"'") || !strings.Contains(appErr.Message, "'"+tt.to+"'")) {
+				t.Errorf("message %q does not name %s and %s", appErr.Message, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestTransitionRunsHooksInOrder(t *testing.T) {
+	sm := NewOrderStateMachine()
+
+	var ran []string
+	record := func(name string) Hook {
+		return func(tx *gorm.DB, event Event) error {
+			ran = append(ran, name+" "+event.From+"->"+event.To)
+			return nil
+		}
+	}
+	sm.OnExit(models.OrderStatusPaymentPending, record("exit"))
+	sm.OnEnter(models.OrderStatusPaid, record("enter"))
+	sm.OnEnter(models.OrderStatusPaid, record("enter again"))
+	sm.OnEnter(models.OrderStatusCancelled, record("enter cancelled"))
+
+	event := Event{OrderID: "order", From: models.OrderStatusPaymentPending, To: models.OrderStatusPaid, Actor: ActorSystem}
+	err := sm.Transition(nil, event, func() error {
+		ran = append(ran, "apply")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+
+	want := []string{"exit payment_pending->paid", "apply", "enter payment_pending->paid", "enter again payment_pending->paid"}
+	if strings.Join(ran, ", ") != strings.Join(want, ", ") {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+}
+
+func TestTransitionAbortsOnError(t *testing.T) {
+	failure := stderrors.New("hook failed")
+
+	tests := []struct {
+		name      string
+		setup     func(OrderStateMachine)
+		apply     error
+		wantRan   []string
+		wantError error
+	}{
+		{
+			name: "exit hook fails",
+			setup: func(sm OrderStateMachine) {
+				sm.OnExit(models.OrderStatusPaid, func(*gorm.DB, Event) error { return failure })
+			},
+			wantRan:   nil,
+			wantError: failure,
+		},
+		{
+			name:      "apply fails",
+			apply:     failure,
+			wantRan:   []string{"apply"},
+			wantError: failure,
+		},
+		{
+			name: "enter hook fails",
+			setup: func(sm OrderStateMachine) {
+				sm.OnEnter(models.OrderStatusApproved, func(*gorm.DB, Event) error { return failure })
+			},
+			wantRan:   []string{"apply"},
+			wantError: failure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewOrderStateMachine()
+			if tt.setup != nil {
+				tt.setup(sm)
+			}
+
+			var ran []string
+			event := Event{From: models.OrderStatusPaid, To: models.OrderStatusApproved}
+			err := sm.Transition(nil, event, func() error {
+				ran = append(ran, "apply")
+				return tt.apply
+			})
+			if err != tt.wantError {
+				t.Fatalf("Transition = %v, want %v", err, tt.wantError)
+			}
+			if strings.Join(ran, ",") != strings.Join(tt.wantRan, ",") {
+				t.Errorf("ran %v, want %v", ran, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestTransitionRejectsIllegalEventsBeforeHooks(t *testing.T) {
+	sm := NewOrderStateMachine()
+	hookRan := false
+	sm.OnExit(models.OrderStatusPending, func(*gorm.DB, Event) error {
+		hookRan = true
+		return nil
+	})
+
+	applied := false
+	err := sm.Transition(nil, Event{From: models.OrderStatusPending, To: models.OrderStatusCompleted}, func() error {
+		applied = true
+		return nil
+	})
+	if appErr, ok := errors.IsAppError(err); !ok || appErr.Type != errors.ConflictError {
+		t.Fatalf("Transition = %v, want a conflict", err)
+	}
+	if hookRan || applied {
+		t.Errorf("hook ran = %t, applied = %t; want neither for an illegal transition", hookRan, applied)
+	}
+}
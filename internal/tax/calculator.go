@@ -0,0 +1,76 @@
+package tax
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PharmaKart/order-svc/internal/models"
+	"github.com/PharmaKart/order-svc/internal/repositories"
+	"github.com/PharmaKart/order-svc/pkg/money"
+)
+
+const ppm = 1_000_000
+
+// Item is an order line to be taxed.
+type Item struct {
+	Index    int
+	Category string
+	Amount   money.Amount
+}
+
+// Line is the tax owed on one item under one rate. Index refers back to the
+// item it was computed for.
+type Line struct {
+	Index    int
+	Rate     models.TaxRate
+	Amount   money.Amount
+	Category string
+}
+
+type TaxCalculator interface {
+	Calculate(region string, items []Item, at time.Time) ([]Line, money.Amount, error)
+}
+
+type tableCalculator struct {
+	taxRateRepo repositories.TaxRateRepository
+}
+
+// NewTableCalculator returns a calculator backed by the tax_rates table.
+func NewTableCalculator(taxRateRepo repositories.TaxRateRepository) TaxCalculator {
+	return &tableCalculator{taxRateRepo}
+}
+
+// Calculate applies every rate in force for the region at the given time to
+// each item of the matching category. Each line is rounded separately.
+func (c *tableCalculator) Calculate(region string, items []Item, at time.Time) ([]Line, money.Amount, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region == "" {
+		return nil, 0, nil
+	}
+
+	rates, err := c.taxRateRepo.GetEffectiveRates(region, at)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lines := []Line{}
+	total := money.Amount(0)
+	for _, item := range items {
+		for _, rate := range rates {
+			if rate.Category != item.Category {
+				continue
+			}
+
+			amount := item.Amount.MulRatio(rate.RatePPM, ppm)
+			lines = append(lines, Line{
+				Index:    item.Index,
+				Rate:     rate,
+				Amount:   amount,
+				Category: item.Category,
+			})
+			total += amount
+		}
+	}
+
+	return lines, total, nil
+}
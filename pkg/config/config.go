@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +15,35 @@ type Config struct {
 	DBConnString      string
 	ProductServiceURL string
 	PaymentServiceURL string
+
+	OutboxSink          string
+	OutboxFilePath      string
+	OutboxRelayInterval time.Duration
+	OutboxBatchSize     int
+	OutboxMaxAttempts   int
+
+	IdempotencyKeyTTL time.Duration
+
+	ShippingRulesPath string
+
+	PaymentTimeout         time.Duration
+	PaymentExpiryInterval  time.Duration
+	PaymentExpiryBatchSize int
+	PaymentPartialRefunds  bool
+
+	StockReservationTTL      time.Duration
+	ReservationSyncInterval  time.Duration
+	ReservationSyncBatchSize int
+
+	MetricsAddr string
+
+	AuthJWTAlgorithm     string
+	AuthJWTSecret        string
+	AuthJWTPublicKeyPath string
+	AuthJWTIssuer        string
+	AuthJWTAudience      string
+
+	AccessPolicyPath string
 }
 
 // LoadConfig loads configuration from environment variables or a .env file.
@@ -27,6 +58,35 @@ func LoadConfig() *Config {
 		DBConnString:      getDBConnString(),
 		ProductServiceURL: getEnv("PRODUCT_SERVICE_URL", "localhost:50052"),
 		PaymentServiceURL: getEnv("PAYMENT_SERVICE_URL", "localhost:50054"),
+
+		OutboxSink:          getEnv("OUTBOX_SINK", "stdout"),
+		OutboxFilePath:      getEnv("OUTBOX_FILE_PATH", "order_events.log"),
+		OutboxRelayInterval: getEnvDuration("OUTBOX_RELAY_INTERVAL", 5*time.Second),
+		OutboxBatchSize:     getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxMaxAttempts:   getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+		ShippingRulesPath: getEnv("SHIPPING_RULES_PATH", ""),
+
+		PaymentTimeout:         getEnvDuration("PAYMENT_TIMEOUT", 30*time.Minute),
+		PaymentExpiryInterval:  getEnvDuration("PAYMENT_EXPIRY_INTERVAL", time.Minute),
+		PaymentExpiryBatchSize: getEnvInt("PAYMENT_EXPIRY_BATCH_SIZE", 50),
+		PaymentPartialRefunds:  getEnvBool("PAYMENT_PARTIAL_REFUNDS", false),
+
+		StockReservationTTL:      getEnvDuration("STOCK_RESERVATION_TTL", 30*time.Minute),
+		ReservationSyncInterval:  getEnvDuration("RESERVATION_SYNC_INTERVAL", 30*time.Second),
+		ReservationSyncBatchSize: getEnvInt("RESERVATION_SYNC_BATCH_SIZE", 100),
+
+		MetricsAddr: getEnv("METRICS_ADDR", ""),
+
+		AuthJWTAlgorithm:     getEnv("AUTH_JWT_ALGORITHM", "HS256"),
+		AuthJWTSecret:        getEnv("AUTH_JWT_SECRET", ""),
+		AuthJWTPublicKeyPath: getEnv("AUTH_JWT_PUBLIC_KEY_PATH", ""),
+		AuthJWTIssuer:        getEnv("AUTH_JWT_ISSUER", ""),
+		AuthJWTAudience:      getEnv("AUTH_JWT_AUDIENCE", ""),
+
+		AccessPolicyPath: getEnv("ACCESS_POLICY_PATH", ""),
 	}
 }
 
@@ -50,3 +110,30 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt retrieves an integer environment variable or returns a default value.
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool retrieves a boolean environment variable (e.g. "true" or "1") or returns a default value.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration retrieves a duration environment variable (e.g. "30s") or returns a default value.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
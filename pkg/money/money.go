@@ -0,0 +1,190 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the ISO 4217 code orders are priced in.
+const DefaultCurrency = "CAD"
+
+// minorUnits is the number of minor units in one major unit. Every supported
+// currency has two decimal places.
+const minorUnits = 100
+
+// Amount is an exact monetary amount in minor units (cents).
+//
+// It is stored as a numeric(10,2) column and serialized to JSON as a decimal
+// number, so existing rows and payloads keep their format.
+type Amount int64
+
+// FromFloat converts a float, e.g. a price from another service, to an
+// Amount rounded to the nearest cent.
+func FromFloat(f float64) Amount {
+	amount, _ := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	return amount
+}
+
+// Parse reads a decimal string such as "12.5" or "-0.125". Digits beyond
+// the second decimal place are rounded half away from zero.
+func Parse(s string) (Amount, error) {
+	input := strings.TrimSpace(s)
+	if input == "" {
+		return 0, fmt.Errorf("invalid amount: empty string")
+	}
+
+	s = input
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	// Only one sign is allowed, so both parts must be plain digits.
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid amount: %q", input)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount: %q", input)
+	}
+
+	padded := fraction + "00"
+	cents := int64(padded[0]-'0')*10 + int64(padded[1]-'0')
+
+	total := units*minorUnits + cents
+	if len(fraction) > 2 && fraction[2] >= '5' {
+		total++
+	}
+
+	if negative {
+		total = -total
+	}
+
+	return Amount(total), nil
+}
+
+// MulRatio multiplies the amount by numerator/denominator and rounds the
+// result half away from zero. All fractional arithmetic on amounts goes
+// through this function so rounding is applied consistently.
+func (a Amount) MulRatio(numerator, denominator int64) Amount {
+	product := int64(a) * numerator
+	quotient := product / denominator
+	remainder := product % denominator
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= abs(denominator) {
+		if (product < 0) != (denominator < 0) {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Amount(quotient)
+}
+
+// Mul multiplies the amount by a quantity.
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// Minor returns the amount in minor units.
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Float64 returns the amount in major units for APIs that still expect a
+// floating point value.
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// String formats the amount with two decimal places, e.g. "12.30".
+func (a Amount) String() string {
+	sign := ""
+	value := int64(a)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/minorUnits, value%minorUnits)
+}
+
+// Value implements driver.Valuer.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case string:
+		amount, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = amount
+		return nil
+	case []byte:
+		amount, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = amount
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	case int64:
+		*a = Amount(v * minorUnits)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+// MarshalJSON writes the amount as a decimal number, e.g. 12.30.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a decimal number or a quoted decimal string.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	amount, err := Parse(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
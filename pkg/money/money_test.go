@@ -0,0 +1,205 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"12.30", 1230, false},
+		{" 0.01 ", 1, false},
+		{".5", 50, false},
+		{"7.", 700, false},
+		{"+3.20", 320, false},
+		{"-3.20", -320, false},
+		{"0.125", 13, false},
+		{"0.124", 12, false},
+		{"-0.125", -13, false},
+		{"9.995", 1000, false},
+		{"", 0, true},
+		{"   ", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"--5", 0, true},
+		{"+-5", 0, true},
+		{"-+5", 0, true},
+		{"5.-1", 0, true},
+		{"1.2.3", 0, true},
+		{"1,50", 0, true},
+		{"abc", 0, true},
+		{"1e3", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Amount
+	}{
+		{0, 0},
+		{12.3, 1230},
+		{19.99, 1999},
+		{0.125, 13},
+		{-0.125, -13},
+		{1.005, 101},
+		{-1.005, -101},
+		{2.675, 268},
+		{0.004, 0},
+		{-0.004, 0},
+	}
+
+	for _, tt := range tests {
+		if got := FromFloat(tt.in); got != tt.want {
+			t.Errorf("FromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1230, "12.30"},
+		{-5, "-0.05"},
+		{-1230, "-12.30"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		amount                 Amount
+		numerator, denominator int64
+		want                   Amount
+	}{
+		{1000, 13, 100, 130},
+		{100, 1, 3, 33},
+		{200, 1, 3, 67},
+		{5, 1, 2, 3},
+		{-5, 1, 2, -3},
+		{5, -1, 2, -3},
+		{5, 1, -2, -3},
+		{-5, -1, 2, 3},
+		{-200, 1, 3, -67},
+		{1999, 0, 7, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.MulRatio(tt.numerator, tt.denominator); got != tt.want {
+			t.Errorf("Amount(%d).MulRatio(%d, %d) = %d, want %d", tt.amount, tt.numerator, tt.denominator, got, tt.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Amount
+		wantErr bool
+	}{
+		{"nil", nil, 0, false},
+		{"numeric string", "12.30", 1230, false},
+		{"numeric bytes", []byte("12.30"), 1230, false},
+		{"negative numeric", []byte("-0.05"), -5, false},
+		{"float", 12.3, 1230, false},
+		{"integer", int64(12), 1200, false},
+		{"malformed numeric", []byte("12,30"), 0, true},
+		{"unsupported type", true, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Amount
+			err := got.Scan(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Scan(%v) = %d, want an error", tt.src, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v): %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	value, err := Amount(-1230).Value()
+	if err != nil {
+		t.Fatalf("Value: %v", err)
+	}
+	if value != "-12.30" {
+		t.Errorf("Value() = %v, want -12.30", value)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	type payload struct {
+		Total Amount `json:"total"`
+	}
+
+	for _, amount := range []Amount{0, 5, 1230, -1230} {
+		data, err := json.Marshal(payload{Total: amount})
+		if err != nil {
+			t.Fatalf("Marshal(%d): %v", amount, err)
+		}
+		if want := `{"total":` + amount.String() + `}`; string(data) != want {
+			t.Errorf("Marshal(%d) = %s, want %s", amount, data, want)
+		}
+
+		var decoded payload
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if decoded.Total != amount {
+			t.Errorf("round trip of %d = %d", amount, decoded.Total)
+		}
+	}
+
+	var quoted payload
+	if err := json.Unmarshal([]byte(`{"total":"12.30"}`), &quoted); err != nil || quoted.Total != 1230 {
+		t.Errorf("Unmarshal of a quoted amount = %d, %v; want 1230", quoted.Total, err)
+	}
+
+	var invalid payload
+	if err := json.Unmarshal([]byte(`{"total":"--1"}`), &invalid); err == nil {
+		t.Errorf("Unmarshal of \"--1\" succeeded, want an error")
+	}
+}